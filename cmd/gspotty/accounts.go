@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/iamgaru/gspotty/internal/account"
+	"github.com/iamgaru/gspotty/internal/cli"
+)
+
+// accountsUsage describes the accounts command
+const accountsUsage = `Usage: gspotty accounts <command> [arguments]
+
+Manage the named Spotify accounts selected with -account.
+
+Commands:
+  list                                  List accounts; * marks the default
+  add [-client-id ID] [-default] NAME   Add an account, optionally with its own client ID
+  remove NAME                           Remove an account and its stored token
+  default NAME                          Use NAME when -account is not given
+`
+
+// runAccountsCommand runs "gspotty accounts ..." and returns the process exit code
+func runAccountsCommand(args []string, stdout, stderr io.Writer) int {
+	if err := accountsCommand(args, stdout, stderr); err != nil {
+		return reportError(stderr, err)
+	}
+	return 0
+}
+
+// accountsCommand dispatches an accounts subcommand
+func accountsCommand(args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, accountsUsage)
+		return errors.New("missing accounts command")
+	}
+
+	registry, err := account.Load()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		if len(registry.Accounts) == 0 {
+			fmt.Fprintln(stdout, "No accounts configured; the default account is used.")
+			return nil
+		}
+		for _, acct := range registry.Accounts {
+			marker := " "
+			if acct.Name == registry.Default {
+				marker = "*"
+			}
+			if acct.ClientID != "" {
+				fmt.Fprintf(stdout, "%s %s (client ID %s)\n", marker, acct.Name, acct.ClientID)
+			} else {
+				fmt.Fprintf(stdout, "%s %s\n", marker, acct.Name)
+			}
+		}
+		return nil
+
+	case "add":
+		flags := flag.NewFlagSet("accounts add", flag.ContinueOnError)
+		flags.SetOutput(stderr)
+		clientID := flags.String("client-id", "", "Spotify client ID for this account (default SPOTIFY_ID)")
+		makeDefault := flags.Bool("default", false, "Make this the default account")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			return errors.New("usage: gspotty accounts add [-client-id ID] [-default] NAME")
+		}
+
+		name := flags.Arg(0)
+		if err := registry.Add(account.Account{Name: name, ClientID: *clientID}); err != nil {
+			return err
+		}
+		if *makeDefault {
+			registry.Default = name
+		}
+		if err := registry.Save(); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Added account %s. Log in with: gspotty auth login -account %s\n", name, name)
+		return nil
+
+	case "remove":
+		if len(args) != 2 {
+			return errors.New("usage: gspotty accounts remove NAME")
+		}
+		name := args[1]
+		if err := registry.Remove(name); err != nil {
+			return err
+		}
+		if err := registry.Save(); err != nil {
+			return err
+		}
+
+		// Forget the account's login too
+		if err := cli.DeleteToken(name); err != nil {
+			return fmt.Errorf("removed account %s but could not delete its token: %v", name, err)
+		}
+		fmt.Fprintf(stdout, "Removed account %s\n", name)
+		return nil
+
+	case "default":
+		if len(args) != 2 {
+			return errors.New("usage: gspotty accounts default NAME")
+		}
+		if err := registry.SetDefault(args[1]); err != nil {
+			return err
+		}
+		if err := registry.Save(); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Default account is now %s\n", args[1])
+		return nil
+
+	default:
+		fmt.Fprint(stderr, accountsUsage)
+		return fmt.Errorf("unknown accounts command %q", args[0])
+	}
+}
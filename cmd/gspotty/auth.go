@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/iamgaru/gspotty/internal/account"
+	"github.com/iamgaru/gspotty/internal/cli"
+)
+
+// authUsage describes the auth command
+const authUsage = `Usage: gspotty auth <command> [-account NAME] [options]
+
+Manage the stored Spotify login of an account.
+
+Commands:
+  login [-no-browser] [-scopes LIST]
+                        Authorize again, replacing the stored token and
+                        requesting extra comma-separated scopes
+  status [-json]        Show the user, granted scopes and token expiry
+  refresh [-json]       Refresh the access token now
+  logout                Delete the stored token
+`
+
+// resolveAccount returns the named account, or the configured default when name is empty
+func resolveAccount(name string) (account.Account, error) {
+	registry, err := account.Load()
+	if err != nil {
+		return account.Account{}, err
+	}
+	return registry.Resolve(name)
+}
+
+// runAuthCommand runs "gspotty auth ..." and returns the process exit code
+func runAuthCommand(args []string, stdout, stderr io.Writer) int {
+	if err := authCommand(context.Background(), args, stdout, stderr); err != nil {
+		return reportError(stderr, err)
+	}
+	return 0
+}
+
+// authCommand dispatches an auth subcommand
+func authCommand(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, authUsage)
+		return errors.New("missing auth command")
+	}
+
+	command := args[0]
+	flags := flag.NewFlagSet("auth "+command, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	accountName := flags.String("account", "", "Named account to use")
+	noBrowser := flags.Bool("no-browser", false, "Log in by pasting the redirected URL instead of opening a browser")
+	jsonOutput := flags.Bool("json", false, "Print the result as JSON")
+	scopes := flags.String("scopes", "", "Extra scopes to request, comma-separated")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	acct, err := resolveAccount(*accountName)
+	if err != nil {
+		return err
+	}
+	opts := cli.AuthOptions{NoBrowser: *noBrowser, Account: acct}
+	if *scopes != "" {
+		opts.Scopes = strings.Split(*scopes, ",")
+	}
+
+	switch command {
+	case "login":
+		return cli.Login(ctx, opts)
+
+	case "logout":
+		if err := cli.Logout(opts); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Logged out of account %s\n", acct.Name)
+		return nil
+
+	case "refresh":
+		token, err := cli.Refresh(ctx, opts)
+		if err != nil {
+			return err
+		}
+		if *jsonOutput {
+			return writeJSON(stdout, map[string]interface{}{"account": acct.Name, "expiry": token.Expiry})
+		}
+		fmt.Fprintf(stdout, "Token refreshed; it expires %s\n", formatExpiry(token.Expiry))
+		return nil
+
+	case "status":
+		status, err := cli.Status(ctx, opts)
+		if err != nil {
+			return err
+		}
+		if *jsonOutput {
+			return writeJSON(stdout, status)
+		}
+		fmt.Fprintf(stdout, "Account:      %s\n", status.Account)
+		fmt.Fprintf(stdout, "User:         %s (%s)\n", status.DisplayName, status.UserID)
+		fmt.Fprintf(stdout, "Scopes:       %s\n", strings.Join(status.Scopes, " "))
+		fmt.Fprintf(stdout, "Token expiry: %s\n", formatExpiry(status.Expiry))
+		fmt.Fprintf(stdout, "Token file:   %s\n", status.TokenPath)
+		return nil
+
+	default:
+		fmt.Fprint(stderr, authUsage)
+		return fmt.Errorf("unknown auth command %q", command)
+	}
+}
+
+// formatExpiry shows a token expiry along with how long is left
+func formatExpiry(expiry time.Time) string {
+	remaining := time.Until(expiry).Round(time.Second)
+	if remaining <= 0 {
+		return fmt.Sprintf("%s (expired)", expiry.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("%s (in %s)", expiry.Format(time.RFC3339), remaining)
+}
+
+// writeJSON prints a value as indented JSON
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
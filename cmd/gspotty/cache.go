@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/iamgaru/gspotty/internal/config"
+	"github.com/iamgaru/gspotty/internal/httpcache"
+)
+
+// cacheUsage describes the cache command
+const cacheUsage = `Usage: gspotty cache <command>
+
+Manage the cache of Spotify catalog responses. Use -no-cache to bypass it.
+
+Commands:
+  clear   Remove every cached response
+`
+
+// runCacheCommand runs "gspotty cache ..." and returns the process exit code
+func runCacheCommand(args []string, stdout, stderr io.Writer) int {
+	if err := cacheCommand(args, stdout, stderr); err != nil {
+		return reportError(stderr, err)
+	}
+	return 0
+}
+
+// cacheCommand dispatches a cache subcommand
+func cacheCommand(args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, cacheUsage)
+		return errors.New("missing cache command")
+	}
+
+	switch args[0] {
+	case "clear":
+		dir, err := config.ResponseCacheDir()
+		if err != nil {
+			return err
+		}
+		removed, err := httpcache.Clear(dir)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Removed %d cached responses from %s\n", removed, dir)
+		return nil
+
+	default:
+		fmt.Fprint(stderr, cacheUsage)
+		return fmt.Errorf("unknown cache command %q", args[0])
+	}
+}
@@ -0,0 +1,578 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/iamgaru/gspotty/internal/api"
+	"github.com/iamgaru/gspotty/internal/cli"
+	"github.com/iamgaru/gspotty/internal/config"
+	"github.com/iamgaru/gspotty/internal/device"
+	"github.com/iamgaru/gspotty/internal/menu"
+	"github.com/iamgaru/gspotty/internal/output"
+	"github.com/iamgaru/gspotty/internal/profile"
+	"golang.org/x/term"
+)
+
+// command is a gspotty subcommand
+type command struct {
+	name     string
+	synopsis string
+	summary  string
+	run      func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+	// usage is the help of a command that has subcommands of its own
+	usage string
+}
+
+// commands are the subcommands in the order the usage lists them. It is
+// filled in by init, since the help command refers back to it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"search", "[options] QUERY", "Search for tracks, albums or playlists and browse the results", playerCommand(searchCommand), ""},
+		{"play", "[options] [QUERY]", "Play the first result for QUERY, or resume playback without one", playerCommand(playCommand), ""},
+		{"pause", "[options]", "Pause playback", playerCommand(pauseCommand), ""},
+		{"next", "[options]", "Skip to the next track", playerCommand(nextCommand), ""},
+		{"previous", "[options]", "Go back to the previous track", playerCommand(previousCommand), ""},
+		{"status", "[options]", "Show what is playing and where", playerCommand(statusCommand), ""},
+		{"watch", "[options]", "Stream playback changes as JSON lines", playerCommand(watchCommand), ""},
+		{"devices", "[options]", "List the devices Spotify can play on", playerCommand(devicesCommand), ""},
+		{"transfer", "[options] DEVICE", "Move playback to another device, keeping its position", playerCommand(transferCommand), ""},
+		{"profile", "[options] USER", "Show a user's public profile", playerCommand(profileCommand), ""},
+		{"menu", "[options]", "Open the interactive menu", playerCommand(menuCommand), ""},
+		{"accounts", "<command> [arguments]", "Manage named accounts", func(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+			return runAccountsCommand(args, stdout, stderr)
+		}, accountsUsage},
+		{"auth", "<command> [options]", "Log in, inspect or remove the stored login", func(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+			return runAuthCommand(args, stdout, stderr)
+		}, authUsage},
+		{"setup", "", "Set up the Spotify app credentials", func(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+			return runSetupCommand(stdin, stdout, stderr)
+		}, setupUsage},
+		{"cache", "<command>", "Manage the response cache", func(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+			return runCacheCommand(args, stdout, stderr)
+		}, cacheUsage},
+		{"help", "[COMMAND]", "Show help for a command", runHelpCommand, ""},
+	}
+}
+
+// findCommand returns the command with the name
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// usage prints the list of commands
+func usage(w io.Writer) {
+	fmt.Fprint(w, "Usage: gspotty <command> [options] [arguments]\n\n")
+	fmt.Fprint(w, "A CLI tool to search and play Spotify tracks, albums, and playlists.\n\n")
+	fmt.Fprint(w, "Commands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprint(w, "\nRun gspotty help COMMAND for the options of a command.\n")
+	fmt.Fprint(w, "\nExamples:\n")
+	fmt.Fprint(w, "  gspotty search \"Bohemian Rhapsody\"\n")
+	fmt.Fprint(w, "  gspotty search -a Queen \"Bohemian Rhapsody\"\n")
+	fmt.Fprint(w, "  gspotty search -t album -l 3 \"Dark Side of the Moon\"\n")
+	fmt.Fprint(w, "  gspotty search -t playlist -d workout\n")
+	fmt.Fprint(w, "  gspotty search -o csv -l 20 \"Dark Side\" > results.csv\n")
+	fmt.Fprint(w, "  gspotty play \"Bohemian Rhapsody\"\n")
+	fmt.Fprint(w, "  gspotty pause\n")
+	fmt.Fprint(w, "  gspotty play -device Kitchen \"Bohemian Rhapsody\"\n")
+	fmt.Fprint(w, "  gspotty transfer Laptop\n")
+	fmt.Fprint(w, "  gspotty watch -interval 5s\n")
+	fmt.Fprint(w, "  gspotty profile spotify\n")
+	fmt.Fprint(w, "  gspotty menu\n")
+	fmt.Fprint(w, "  gspotty search -account work -t playlist workout\n")
+	fmt.Fprint(w, "  gspotty search -offline -t album \"Dark Side\"\n")
+	fmt.Fprint(w, "  gspotty auth status -json\n")
+	fmt.Fprint(w, "\nThe flags of earlier versions, such as -q, -t, -p, -s, -u and -i, still work.\n")
+}
+
+// run runs the command named by the first argument and returns the process exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	// Flags before any command are the single-command interface of earlier versions
+	if len(args) > 0 && isLegacyFlag(args[0]) {
+		mapped, err := legacyArgs(args, stderr)
+		if errors.Is(err, flag.ErrHelp) {
+			usage(stderr)
+			return 0
+		}
+		if err != nil {
+			return exitUsage
+		}
+		args = mapped
+	}
+
+	if len(args) == 0 {
+		usage(stderr)
+		return exitUsage
+	}
+	cmd, ok := findCommand(args[0])
+	if !ok {
+		fmt.Fprintf(stderr, "Error: unknown command %q\n\n", args[0])
+		usage(stderr)
+		return exitUsage
+	}
+	return cmd.run(args[1:], stdin, stdout, stderr)
+}
+
+// runHelpCommand runs "gspotty help [COMMAND]"
+func runHelpCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stdout)
+		return 0
+	}
+	cmd, ok := findCommand(args[0])
+	if !ok || cmd.name == "help" {
+		fmt.Fprintf(stderr, "Error: unknown command %q\n", args[0])
+		return exitUsage
+	}
+	if cmd.usage != "" {
+		fmt.Fprint(stdout, cmd.usage)
+		return 0
+	}
+	return cmd.run([]string{"-h"}, stdin, stdout, stdout)
+}
+
+// playerContext is what a command that talks to Spotify gets to work with
+type playerContext struct {
+	ctx      context.Context
+	flags    *flag.FlagSet
+	settings *config.Settings
+	stdin    io.Reader
+	stdout   io.Writer
+	stderr   io.Writer
+}
+
+// client returns the Spotify client for the command. needsUser asks for a
+// user login even if the command could otherwise run as the app alone.
+func (p *playerContext) client(needsUser bool) (api.Client, error) {
+	// Flags take precedence; record the result for the menu and player
+	config.SetActive(*p.settings)
+
+	acct, err := resolveAccount(p.settings.Account)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(p.ctx, acct, *p.settings, needsUser, p.stdin, p.stderr)
+}
+
+// playerCommand adapts a command that talks to Spotify. Its flag set starts
+// with the flags every such command shares, defaulting to the settings, and
+// the command adds its own before parsing.
+func playerCommand(fn func(p *playerContext, args []string) error) func(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	return func(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+		settings, err := config.LoadSettings()
+		if err != nil {
+			return reportError(stderr, err)
+		}
+
+		flags := flag.NewFlagSet("", flag.ContinueOnError)
+		flags.SetOutput(stderr)
+		flags.StringVar(&settings.Account, "account", settings.Account, "Named account to use (see: gspotty accounts list)")
+		flags.BoolVar(&settings.NoBrowser, "no-browser", settings.NoBrowser, "Log in by pasting the redirected URL instead of opening a browser (for SSH and containers)")
+		flags.BoolVar(&settings.NoCache, "no-cache", settings.NoCache, "Fetch every track, album and playlist from Spotify instead of the response cache")
+		flags.BoolVar(&settings.Offline, "offline", settings.Offline, "Search the cached tracks, albums and playlists without contacting Spotify")
+
+		p := &playerContext{ctx: context.Background(), flags: flags, settings: &settings, stdin: stdin, stdout: stdout, stderr: stderr}
+		if err := fn(p, args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return 0
+			}
+			if errors.Is(err, errUsage) {
+				return exitUsage
+			}
+			return reportError(stderr, err)
+		}
+		return 0
+	}
+}
+
+// errUsage means the command line was invalid; the flag set already said why
+var errUsage = errors.New("invalid usage")
+
+// parse sets the usage message of the command and parses its arguments
+func (p *playerContext) parse(name string, args []string) error {
+	cmd, _ := findCommand(name)
+	p.flags.Init(name, flag.ContinueOnError)
+	p.flags.Usage = func() {
+		fmt.Fprintf(p.flags.Output(), "Usage: gspotty %s %s\n\n%s.\n\nOptions:\n", cmd.name, cmd.synopsis, cmd.summary)
+		printFlags(p.flags)
+	}
+	if err := p.flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	return nil
+}
+
+// usageError prints a problem with the arguments and the command's usage
+func (p *playerContext) usageError(format string, args ...interface{}) error {
+	fmt.Fprintf(p.stderr, "Error: "+format+"\n", args...)
+	p.flags.Usage()
+	return errUsage
+}
+
+// addDeviceFlag adds the flag that aims playback at a device other than the active one
+func (p *playerContext) addDeviceFlag() {
+	p.flags.StringVar(&p.settings.Device, "device", p.settings.Device, "Name or ID of the device to play on (see: gspotty devices)")
+}
+
+// searchOptions are the flags of the commands that search
+type searchOptions struct {
+	searchType *string
+	artist     *string
+}
+
+// addSearchFlags adds the flags that pick what to search for
+func (p *playerContext) addSearchFlags() searchOptions {
+	s := p.settings
+	opts := searchOptions{
+		searchType: p.flags.String("t", s.SearchType, "Type of search: track, album, or playlist"),
+		artist:     p.flags.String("a", "", "Artist name to filter results (only for track search)"),
+	}
+	// Long aliases are accepted but not listed
+	p.flags.StringVar(opts.searchType, "type", s.SearchType, "")
+	p.flags.StringVar(opts.artist, "artist", "", "")
+	p.flags.BoolVar(&s.ReturnToMenu, "r", s.ReturnToMenu, "Return to the interactive menu after viewing the results")
+	p.flags.BoolVar(&s.KeepPlaying, "k", s.KeepPlaying, "Keep music playing when exiting the player interface")
+	p.addDeviceFlag()
+	return opts
+}
+
+// setSearchType checks the -t flag and applies it to the settings
+func (p *playerContext) setSearchType(opts searchOptions) error {
+	valid := false
+	for _, searchType := range config.SearchTypes {
+		valid = valid || *opts.searchType == searchType
+	}
+	if !valid {
+		return p.usageError("invalid search type %q. Must be one of: %s", *opts.searchType, strings.Join(config.SearchTypes, ", "))
+	}
+	p.settings.SearchType = *opts.searchType
+	return nil
+}
+
+// search runs the query and shows or plays the results
+func (p *playerContext) search(opts searchOptions, query string, autoPlay bool) error {
+	s := p.settings
+	if err := p.setSearchType(opts); err != nil {
+		return err
+	}
+	s.AutoPlay = autoPlay
+
+	// The menu and the player act for a user; browsing results does not
+	client, err := p.client(autoPlay || s.ReturnToMenu)
+	if err != nil {
+		return err
+	}
+	if autoPlay && api.IsOffline(client) {
+		return fmt.Errorf("%w: playing a result needs a connection to Spotify", api.ErrOffline)
+	}
+
+	if s.ReturnToMenu {
+		switch s.SearchType {
+		case "track":
+			cli.SearchTracksWithMenu(p.ctx, client, query, *opts.artist, s.Limit, s.ShowDetails, s.KeepPlaying, autoPlay)
+		case "album":
+			cli.SearchAlbumsWithMenu(p.ctx, client, query, s.Limit, s.ShowDetails, s.KeepPlaying, autoPlay)
+		case "playlist":
+			cli.SearchPlaylistsWithMenu(p.ctx, client, query, s.Limit, s.ShowDetails, s.KeepPlaying, autoPlay)
+		}
+		return nil
+	}
+	switch s.SearchType {
+	case "track":
+		cli.SearchTracks(p.ctx, client, query, *opts.artist, s.Limit, s.ShowDetails, s.KeepPlaying, autoPlay)
+	case "album":
+		cli.SearchAlbums(p.ctx, client, query, s.Limit, s.ShowDetails, s.KeepPlaying, autoPlay)
+	case "playlist":
+		cli.SearchPlaylists(p.ctx, client, query, s.Limit, s.ShowDetails, s.KeepPlaying, autoPlay)
+	}
+	return nil
+}
+
+// searchCommand runs "gspotty search"
+func searchCommand(p *playerContext, args []string) error {
+	opts := p.addSearchFlags()
+	s := p.settings
+	p.flags.IntVar(&s.Limit, "l", s.Limit, "Number of results to display")
+	p.flags.IntVar(&s.Limit, "limit", s.Limit, "")
+	p.flags.BoolVar(&s.ShowDetails, "d", s.ShowDetails, "Show detailed information about the results")
+	p.flags.BoolVar(&s.AutoPlay, "p", s.AutoPlay, "Play the first result and exit, like gspotty play")
+	format := p.flags.String("o", "", "Print the results as "+strings.Join(output.Formats, ", ")+
+		" instead of opening the results view (default plain when the output is not a terminal)")
+	p.flags.StringVar(format, "output", "", "")
+	if err := p.parse("search", args); err != nil {
+		return err
+	}
+
+	query := strings.Join(p.flags.Args(), " ")
+	if query == "" {
+		return p.usageError("missing search query")
+	}
+	if err := s.Validate(); err != nil {
+		return p.usageError("%v", err)
+	}
+
+	switch {
+	case *format != "" && !output.Valid(*format):
+		return p.usageError("invalid output format %q. Must be one of: %s", *format, strings.Join(output.Formats, ", "))
+	case *format != "" && (s.AutoPlay || s.ReturnToMenu):
+		return p.usageError("-o cannot be used with -p or -r")
+	case *format == "" && !s.AutoPlay && !s.ReturnToMenu && !isTerminal(p.stdout):
+		// The results view needs a terminal; a pipe gets text instead
+		*format = "plain"
+	}
+	if *format != "" {
+		return p.print(opts, query, *format)
+	}
+	return p.search(opts, query, s.AutoPlay)
+}
+
+// print runs the query and prints the results in the output format
+func (p *playerContext) print(opts searchOptions, query, format string) error {
+	if err := p.setSearchType(opts); err != nil {
+		return err
+	}
+	client, err := p.client(false)
+	if err != nil {
+		return err
+	}
+	s := p.settings
+	return cli.PrintSearch(p.ctx, client, p.stdout, s.SearchType, query, *opts.artist, s.Limit, format)
+}
+
+// isTerminal reports whether w is a terminal
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(file.Fd()))
+}
+
+// playCommand runs "gspotty play"
+func playCommand(p *playerContext, args []string) error {
+	opts := p.addSearchFlags()
+	if err := p.parse("play", args); err != nil {
+		return err
+	}
+
+	if query := strings.Join(p.flags.Args(), " "); query != "" {
+		return p.search(opts, query, true)
+	}
+
+	client, err := p.client(true)
+	if err != nil {
+		return err
+	}
+	playOpts, err := device.Options(p.ctx, client, p.settings.Device)
+	if err != nil {
+		return err
+	}
+	if err := client.PlayOpt(p.ctx, playOpts); err != nil {
+		return fmt.Errorf("failed to resume playback: %w", err)
+	}
+	fmt.Fprintln(p.stdout, "Playback resumed.")
+	return nil
+}
+
+// pauseCommand runs "gspotty pause"
+func pauseCommand(p *playerContext, args []string) error {
+	p.addDeviceFlag()
+	if err := p.parseNoArgs("pause", args); err != nil {
+		return err
+	}
+	client, err := p.client(true)
+	if err != nil {
+		return err
+	}
+	return cli.StopCurrentlyPlaying(p.ctx, client, p.settings.Device)
+}
+
+// nextCommand runs "gspotty next"
+func nextCommand(p *playerContext, args []string) error {
+	p.addDeviceFlag()
+	if err := p.parseNoArgs("next", args); err != nil {
+		return err
+	}
+	client, err := p.client(true)
+	if err != nil {
+		return err
+	}
+	opts, err := device.Options(p.ctx, client, p.settings.Device)
+	if err != nil {
+		return err
+	}
+	if err := client.NextOpt(p.ctx, opts); err != nil {
+		return fmt.Errorf("failed to skip to the next track: %w", err)
+	}
+	fmt.Fprintln(p.stdout, "Skipped to the next track.")
+	return nil
+}
+
+// previousCommand runs "gspotty previous"
+func previousCommand(p *playerContext, args []string) error {
+	p.addDeviceFlag()
+	if err := p.parseNoArgs("previous", args); err != nil {
+		return err
+	}
+	client, err := p.client(true)
+	if err != nil {
+		return err
+	}
+	opts, err := device.Options(p.ctx, client, p.settings.Device)
+	if err != nil {
+		return err
+	}
+	if err := client.PreviousOpt(p.ctx, opts); err != nil {
+		return fmt.Errorf("failed to go back to the previous track: %w", err)
+	}
+	fmt.Fprintln(p.stdout, "Went back to the previous track.")
+	return nil
+}
+
+// devicesCommand runs "gspotty devices"
+func devicesCommand(p *playerContext, args []string) error {
+	if err := p.parseNoArgs("devices", args); err != nil {
+		return err
+	}
+	client, err := p.client(true)
+	if err != nil {
+		return err
+	}
+
+	devices, err := client.PlayerDevices(p.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list devices: %w", err)
+	}
+	if len(devices) == 0 {
+		fmt.Fprintln(p.stdout, "No devices found. Open Spotify on any device first.")
+		return nil
+	}
+	for _, d := range devices {
+		marker := " "
+		if d.Active {
+			marker = "*"
+		}
+		fmt.Fprintf(p.stdout, "%s %s (%s, volume %d%%)  %s\n", marker, d.Name, d.Type, d.Volume, d.ID)
+	}
+	return nil
+}
+
+// transferCommand runs "gspotty transfer"
+func transferCommand(p *playerContext, args []string) error {
+	if err := p.parse("transfer", args); err != nil {
+		return err
+	}
+	if p.flags.NArg() != 1 {
+		return p.usageError("transfer takes exactly one device name or ID")
+	}
+	client, err := p.client(true)
+	if err != nil {
+		return err
+	}
+
+	target, err := device.Transfer(p.ctx, client, p.flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(p.stdout, "Playback moved to %s.\n", target.Name)
+	return nil
+}
+
+// profileCommand runs "gspotty profile"
+func profileCommand(p *playerContext, args []string) error {
+	if err := p.parse("profile", args); err != nil {
+		return err
+	}
+	if p.flags.NArg() != 1 {
+		return p.usageError("profile takes exactly one user ID")
+	}
+
+	// Profiles are public, so the app can look them up without a login
+	client, err := p.client(false)
+	if err != nil {
+		return err
+	}
+	profile.GetProfileWithClient(p.ctx, client, p.flags.Arg(0))
+	return nil
+}
+
+// menuCommand runs "gspotty menu"
+func menuCommand(p *playerContext, args []string) error {
+	s := p.settings
+	p.flags.BoolVar(&s.KeepPlaying, "k", s.KeepPlaying, "Keep music playing when exiting the player interface")
+	p.addDeviceFlag()
+	if err := p.parseNoArgs("menu", args); err != nil {
+		return err
+	}
+	client, err := p.client(true)
+	if err != nil {
+		return err
+	}
+
+	interactiveMenu := menu.NewInteractiveMenu(p.ctx, client)
+	interactiveMenu.SetKeepPlayingFlag(s.KeepPlaying)
+	if err := interactiveMenu.Run(); err != nil {
+		return fmt.Errorf("error running interactive menu: %w", err)
+	}
+	return nil
+}
+
+// printFlags prints the flags that have a description, like
+// flag.PrintDefaults but leaving out the undocumented aliases
+func printFlags(flags *flag.FlagSet) {
+	w := flags.Output()
+	flags.VisitAll(func(f *flag.Flag) {
+		if f.Usage == "" {
+			return
+		}
+		fmt.Fprintf(w, "  -%s", f.Name)
+		name, usage := flag.UnquoteUsage(f)
+		if len(name) > 0 {
+			fmt.Fprintf(w, " %s", name)
+		}
+		// Boolean flags of one ASCII letter are so common we
+		// treat them specially, putting their usage on the same line.
+		if len(f.Name) <= 1 && f.DefValue == "false" {
+			fmt.Fprintf(w, "\t%s", usage)
+		} else {
+			fmt.Fprintf(w, "\n\t%s", usage)
+			if f.DefValue != "" && f.DefValue != "0" && f.DefValue != "false" {
+				fmt.Fprintf(w, " (default %v)", f.DefValue)
+			}
+		}
+		fmt.Fprint(w, "\n")
+	})
+}
+
+// parseNoArgs parses the flags of a command that takes no arguments
+func (p *playerContext) parseNoArgs(name string, args []string) error {
+	if err := p.parse(name, args); err != nil {
+		return err
+	}
+	if p.flags.NArg() > 0 {
+		return p.usageError("%s takes no arguments", name)
+	}
+	return nil
+}
+
+// formatMillis formats a duration in milliseconds as M:SS
+func formatMillis(ms int) string {
+	d := time.Duration(ms) * time.Millisecond
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/iamgaru/gspotty/internal/api"
+)
+
+// Exit codes, so scripts can tell why gspotty failed. 2 means the command
+// line was invalid, as it does for the flag package.
+const (
+	exitError                = 1
+	exitUsage                = 2
+	exitMissingCredentials   = 3
+	exitAuthorizationDenied  = 4
+	exitStateMismatch        = 5
+	exitAuthorizationTimeout = 6
+	exitTokenExchange        = 7
+	exitLoginRequired        = 8
+	exitOffline              = 9
+	exitNoDevice             = 10
+)
+
+// exitCode maps an error to the process exit code and a hint on how to fix it
+func exitCode(err error) (int, string) {
+	switch {
+	case errors.Is(err, api.ErrMissingCredentials):
+		return exitMissingCredentials, "Run gspotty setup, or create an app at https://developer.spotify.com/dashboard/ and export SPOTIFY_ID and " +
+			"SPOTIFY_SECRET (or SPOTIFY_SECRET_FILE). Export SPOTIFY_AUTH_FLOW=pkce to need only SPOTIFY_ID."
+	case errors.Is(err, api.ErrAuthorizationDenied):
+		return exitAuthorizationDenied, "Access was not granted. Run the command again and approve access on the Spotify page."
+	case errors.Is(err, api.ErrStateMismatch):
+		return exitStateMismatch, "The response belongs to another login attempt. Close old authorization tabs and try again."
+	case errors.Is(err, api.ErrAuthorizationTimeout):
+		return exitAuthorizationTimeout, "Spotify did not answer in time. On a machine without a browser, use -no-browser."
+	case errors.Is(err, api.ErrTokenExchange):
+		return exitTokenExchange, "Check the client ID and secret, and that the redirect URI matches your app settings. " +
+			"If access was revoked, run: gspotty auth login"
+	case errors.Is(err, api.ErrLoginRequired):
+		return exitLoginRequired, "Run gspotty auth login once to let gspotty act for your account."
+	case errors.Is(err, api.ErrOffline):
+		return exitOffline, "Reconnect to use Spotify, or drop -offline. Only tracks, albums and playlists seen before can be browsed offline."
+	case errors.Is(err, api.ErrNoDevice):
+		return exitNoDevice, "Open Spotify on the device you want to play on. See the devices gspotty can use with: gspotty devices"
+	default:
+		return exitError, ""
+	}
+}
+
+// reportError prints an error with its hint and returns the exit code for it
+func reportError(w io.Writer, err error) int {
+	code, hint := exitCode(err)
+	fmt.Fprintf(w, "Error: %v\n", err)
+	if hint != "" {
+		fmt.Fprintln(w, hint)
+	}
+	return code
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// legacyAliases maps the long flags of earlier versions to their short names
+var legacyAliases = map[string]string{
+	"type":           "t",
+	"query":          "q",
+	"artist":         "a",
+	"limit":          "l",
+	"details":        "d",
+	"interactive":    "i",
+	"return-to-menu": "r",
+	"keep-playing":   "k",
+	"auto-play":      "p",
+	"stop":           "s",
+	"user":           "u",
+}
+
+// isLegacyFlag reports whether a command line starts with a flag instead of a
+// command, as it did before gspotty had commands
+func isLegacyFlag(arg string) bool {
+	return strings.HasPrefix(arg, "-") && arg != "-"
+}
+
+// legacyArgs maps a command line of earlier versions, such as
+// "-t album -q Dark Side", onto the command that does the same, such as
+// "search -t=album -- Dark Side". The modes keep their old precedence: -u
+// beats -s, which beats -i, which beats searching. Only flags that were given
+// are passed on, so the rest keep their configured defaults.
+func legacyArgs(args []string, stderr io.Writer) ([]string, error) {
+	flags := flag.NewFlagSet("gspotty", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	// The caller prints the usage of the commands instead
+	flags.Usage = func() {}
+
+	for _, name := range []string{"t", "q", "a", "l", "u", "account"} {
+		flags.String(name, "", "")
+	}
+	for _, name := range []string{"d", "i", "r", "k", "p", "s", "no-browser", "no-cache", "offline"} {
+		flags.Bool(name, false, "")
+	}
+	for alias, name := range legacyAliases {
+		f := flags.Lookup(name)
+		flags.Var(f.Value, alias, "")
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// Collect the flags that were given, under their short names
+	given := make(map[string]string)
+	flags.Visit(func(f *flag.Flag) {
+		name := f.Name
+		if short, ok := legacyAliases[name]; ok {
+			name = short
+		}
+		given[name] = f.Value.String()
+	})
+	isSet := func(name string) bool {
+		return given[name] == "true"
+	}
+
+	// pass returns the named flags that were given, in command line form
+	pass := func(names ...string) []string {
+		var passed []string
+		for _, name := range names {
+			if value, ok := given[name]; ok {
+				passed = append(passed, fmt.Sprintf("-%s=%s", name, value))
+			}
+		}
+		return passed
+	}
+	shared := pass("account", "no-browser", "no-cache", "offline")
+
+	var mapped []string
+	switch {
+	case given["u"] != "":
+		mapped = append(append([]string{"profile"}, shared...), "--", given["u"])
+	case isSet("s"):
+		mapped = append([]string{"pause"}, shared...)
+	case isSet("i"):
+		mapped = append(append([]string{"menu"}, shared...), pass("k")...)
+	default:
+		mapped = append(append([]string{"search"}, shared...), pass("t", "a", "l", "d", "r", "k", "p")...)
+		if query := given["q"]; query != "" {
+			mapped = append(mapped, "--", query)
+		}
+	}
+
+	// Arguments after the flags were ignored before, and still are
+	return mapped, nil
+}
@@ -1,188 +1,137 @@
 package main
 
 import (
-	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/iamgaru/gspotty/internal/account"
+	"github.com/iamgaru/gspotty/internal/api"
 	"github.com/iamgaru/gspotty/internal/cli"
-	"github.com/iamgaru/gspotty/internal/menu"
-	"github.com/iamgaru/gspotty/internal/profile"
+	"github.com/iamgaru/gspotty/internal/config"
+	"github.com/iamgaru/gspotty/internal/offline"
+	"github.com/iamgaru/gspotty/internal/retry"
+	"github.com/iamgaru/gspotty/internal/setup"
 	"golang.org/x/net/context"
+	"golang.org/x/term"
 )
 
-// checkEnvironmentVariables verifies that required Spotify API credentials are set
-func checkEnvironmentVariables() {
-	clientID := os.Getenv("SPOTIFY_ID")
-	clientSecret := os.Getenv("SPOTIFY_SECRET")
-
-	if clientID == "" || clientSecret == "" {
-		fmt.Println("=================================================================")
-		fmt.Println("ERROR: Spotify API credentials not properly configured")
-		fmt.Println("=================================================================")
+// ensureCredentials resolves the Spotify API credentials for the run and makes
+// sure they are configured. When they are missing it runs the setup wizard on
+// a terminal, and otherwise explains how to configure them and returns an error.
+func ensureCredentials(acct account.Account, flow string, stdin io.Reader, stderr io.Writer) (config.Credentials, error) {
+	credentials, err := acct.Credentials(flow)
+	if err != nil {
+		return config.Credentials{}, err
+	}
 
-		if clientID == "" {
-			fmt.Println("Missing SPOTIFY_ID environment variable")
-		}
+	// The PKCE flow is a public client and never uses the secret
+	missingSecret := credentials.ClientSecret == "" && flow != config.AuthFlowPKCE
+	if credentials.ClientID != "" && !missingSecret {
+		return credentials, nil
+	}
 
-		if clientSecret == "" {
-			fmt.Println("Missing SPOTIFY_SECRET environment variable")
+	// The wizard talks on stderr so that stdout stays clean for the results
+	if f, ok := stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		if _, err := setup.Run(context.Background(), stdin, stderr, flow); err != nil {
+			return config.Credentials{}, err
 		}
-
-		fmt.Println("\nTo set up your credentials:")
-		fmt.Println("1. Go to https://developer.spotify.com/dashboard/")
-		fmt.Println("2. Log in and create a new app")
-		fmt.Println("3. Set the redirect URI to http://localhost:8888/callback in your app settings")
-		fmt.Println("4. Set these environment variables with your credentials:")
-		fmt.Println("   export SPOTIFY_ID=your_client_id")
-		fmt.Println("   export SPOTIFY_SECRET=your_client_secret")
-		fmt.Println("=================================================================")
-		os.Exit(1)
+		fmt.Fprintln(stderr)
+		return acct.Credentials(flow)
 	}
-}
 
-func main() {
-	// Check environment variables first
-	checkEnvironmentVariables()
+	var missing []string
+	fmt.Fprintln(stderr, "=================================================================")
+	fmt.Fprintln(stderr, "ERROR: Spotify API credentials not properly configured")
+	fmt.Fprintln(stderr, "=================================================================")
 
-	// Define command line flags
-	var (
-		searchType   = flag.String("t", "track", "Type of search: track, album, or playlist")
-		searchQuery  = flag.String("q", "", "Search query")
-		artistName   = flag.String("a", "", "Artist name to filter results (only for track search)")
-		limit        = flag.Int("l", 5, "Number of results to display")
-		showDetails  = flag.Bool("d", false, "Show detailed information about the results")
-		interactive  = flag.Bool("i", false, "Run in interactive mode with a menu interface")
-		returnToMenu = flag.Bool("r", false, "Return to interactive menu after viewing search results")
-		keepPlaying  = flag.Bool("k", false, "Keep music playing when exiting the player interface")
-		autoPlay     = flag.Bool("p", false, "Automatically play the first result and exit")
-		stopPlayback = flag.Bool("s", false, "Stop the currently playing track")
-		userID       = flag.String("u", "", "Spotify user ID to look up profile information")
-	)
-
-	// Add long flag alternatives (kept for backward compatibility but not documented)
-	flag.StringVar(searchType, "type", "track", "")
-	flag.StringVar(searchQuery, "query", "", "")
-	flag.StringVar(artistName, "artist", "", "")
-	flag.IntVar(limit, "limit", 5, "")
-	flag.BoolVar(showDetails, "details", false, "")
-	flag.BoolVar(interactive, "interactive", false, "")
-	flag.BoolVar(returnToMenu, "return-to-menu", false, "")
-	flag.BoolVar(keepPlaying, "keep-playing", false, "")
-	flag.BoolVar(autoPlay, "auto-play", false, "")
-	flag.BoolVar(stopPlayback, "stop", false, "")
-	flag.StringVar(userID, "user", "", "")
-
-	// Define usage information
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "A CLI tool to search and play Spotify tracks, albums, and playlists.\n\n")
-		fmt.Fprintf(os.Stderr, "Options:\n")
-
-		// Only print flags that have descriptions (the single-letter flags)
-		flag.VisitAll(func(f *flag.Flag) {
-			if f.Usage != "" {
-				fmt.Fprintf(os.Stderr, "  -%s", f.Name)
-				name, usage := flag.UnquoteUsage(f)
-				if len(name) > 0 {
-					fmt.Fprintf(os.Stderr, " %s", name)
-				}
-				// Boolean flags of one ASCII letter are so common we
-				// treat them specially, putting their usage on the same line.
-				if len(f.Name) <= 1 && f.DefValue == "false" {
-					fmt.Fprintf(os.Stderr, "\t%s", usage)
-				} else {
-					fmt.Fprintf(os.Stderr, "\n\t%s", usage)
-					if f.DefValue != "" {
-						if f.DefValue != "0" && f.DefValue != "false" {
-							fmt.Fprintf(os.Stderr, " (default %v)", f.DefValue)
-						}
-					}
-				}
-				fmt.Fprint(os.Stderr, "\n")
-			}
-		})
-
-		fmt.Fprintf(os.Stderr, "\nExamples:\n")
-		fmt.Fprintf(os.Stderr, "  %s -t track -q \"Bohemian Rhapsody\"\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s -t track -q \"Bohemian Rhapsody\" -a \"Queen\"\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s -t album -q \"Dark Side of the Moon\" -l 3\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s -t playlist -q \"workout\" -d\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s -i\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s -q \"Bohemian Rhapsody\" -r\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s -q \"Bohemian Rhapsody\" -k\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s -q \"Bohemian Rhapsody\" -p\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s -s\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s -u spotify\n", os.Args[0])
+	if credentials.ClientID == "" {
+		fmt.Fprintln(stderr, "Missing SPOTIFY_ID (or SPOTIFY_ID_FILE)")
+		missing = append(missing, "SPOTIFY_ID")
 	}
 
-	flag.Parse()
+	if missingSecret {
+		fmt.Fprintln(stderr, "Missing SPOTIFY_SECRET (or SPOTIFY_SECRET_FILE, or the secret_command setting)")
+		missing = append(missing, "SPOTIFY_SECRET")
+	}
 
-	// Initialize Spotify client
-	ctx := context.Background()
-	client := cli.GetSpotifyClient(ctx)
+	fmt.Fprintln(stderr, "\nTo set up your credentials interactively, run: gspotty setup")
+	fmt.Fprintln(stderr, "\nOr configure them by hand:")
+	fmt.Fprintln(stderr, "1. Go to https://developer.spotify.com/dashboard/")
+	fmt.Fprintln(stderr, "2. Log in and create a new app")
+	fmt.Fprintf(stderr, "3. Set the redirect URI to %s in your app settings\n", config.DefaultRedirectURI)
+	fmt.Fprintf(stderr, "   (or register another loopback URI and export %s)\n", config.RedirectURIEnv)
+	fmt.Fprintln(stderr, "4. Set these environment variables with your credentials:")
+	fmt.Fprintln(stderr, "   export SPOTIFY_ID=your_client_id")
+	fmt.Fprintln(stderr, "   export SPOTIFY_SECRET=your_client_secret")
+	fmt.Fprintln(stderr, "   (or point SPOTIFY_SECRET_FILE at a file holding it, such as a Docker secret)")
+	fmt.Fprintln(stderr, "\nTo authorize with PKCE instead, which needs no client secret:")
+	fmt.Fprintln(stderr, "   export SPOTIFY_AUTH_FLOW=pkce")
+	fmt.Fprintln(stderr, "=================================================================")
+	return config.Credentials{}, fmt.Errorf("%w: %s not set", api.ErrMissingCredentials, strings.Join(missing, " and "))
+}
 
-	// Check if user profile lookup is requested
-	if *userID != "" {
-		profile.GetProfile(*userID)
-		return
+// newClient builds the client for a run. Searches and profile lookups only
+// read the catalog, so unless needsUser is set they run without a user login
+// when none is stored. In offline mode, or when Spotify cannot be reached,
+// searches are answered from the response cache.
+func newClient(ctx context.Context, acct account.Account, settings config.Settings, needsUser bool, stdin io.Reader, stderr io.Writer) (api.Client, error) {
+	cacheDir, err := config.ResponseCacheDir()
+	if err != nil {
+		return nil, err
 	}
-
-	// Check if stop playback is requested
-	if *stopPlayback {
-		cli.StopCurrentlyPlaying(ctx, client)
-		return
+	if settings.Offline {
+		return openOffline(cacheDir, settings)
 	}
 
-	// Check if interactive mode is enabled
-	if *interactive {
-		// Start interactive menu
-		interactiveMenu := menu.NewInteractiveMenu(ctx, client)
-		interactiveMenu.SetKeepPlayingFlag(*keepPlaying)
-		if err := interactiveMenu.Run(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error running interactive menu: %v\n", err)
-		}
-		return
+	// Check the credentials before anything talks to Spotify, resolving them
+	// once so that a secret command runs once per run
+	flow, err := config.LoadAuthFlow()
+	if err != nil {
+		return nil, err
 	}
-
-	// Validate search type for non-interactive mode
-	validTypes := map[string]bool{
-		"track":    true,
-		"album":    true,
-		"playlist": true,
+	credentials, err := ensureCredentials(acct, flow, stdin, stderr)
+	if err != nil {
+		return nil, err
 	}
 
-	if !validTypes[*searchType] {
-		fmt.Fprintf(os.Stderr, "Error: invalid search type '%s'. Must be one of: track, album, playlist\n", *searchType)
-		flag.Usage()
-		return
+	authOpts := cli.AuthOptions{NoBrowser: settings.NoBrowser, Account: acct, Credentials: &credentials}
+	var client api.Client
+	if needsUser {
+		client, err = cli.GetSpotifyClient(ctx, authOpts)
+	} else {
+		client, err = cli.GetCatalogClient(ctx, authOpts)
 	}
-
-	// Validate search query for non-interactive mode
-	if *searchQuery == "" {
-		fmt.Fprintf(os.Stderr, "Error: missing search query\n")
-		flag.Usage()
-		return
+	switch {
+	case err != nil && !needsUser && !settings.NoCache && offline.Unreachable(err):
+		fmt.Fprintf(stderr, "Spotify cannot be reached (%v); searching cached results instead.\n", err)
+		return openOffline(cacheDir, settings)
+	case err != nil:
+		return nil, err
+	case settings.NoCache:
+		return client, nil
+	default:
+		return offline.Fallback(client, cacheDir, settings.Limit), nil
 	}
+}
 
-	// Perform search based on type and returnToMenu flag
-	if *returnToMenu {
-		switch *searchType {
-		case "track":
-			cli.SearchTracksWithMenu(ctx, client, *searchQuery, *artistName, *limit, *showDetails, *keepPlaying, *autoPlay)
-		case "album":
-			cli.SearchAlbumsWithMenu(ctx, client, *searchQuery, *limit, *showDetails, *keepPlaying, *autoPlay)
-		case "playlist":
-			cli.SearchPlaylistsWithMenu(ctx, client, *searchQuery, *limit, *showDetails, *keepPlaying, *autoPlay)
-		}
-	} else {
-		switch *searchType {
-		case "track":
-			cli.SearchTracks(ctx, client, *searchQuery, *artistName, *limit, *showDetails, *keepPlaying, *autoPlay)
-		case "album":
-			cli.SearchAlbums(ctx, client, *searchQuery, *limit, *showDetails, *keepPlaying, *autoPlay)
-		case "playlist":
-			cli.SearchPlaylists(ctx, client, *searchQuery, *limit, *showDetails, *keepPlaying, *autoPlay)
-		}
+// openOffline returns a client that searches the response cache
+func openOffline(cacheDir string, settings config.Settings) (api.Client, error) {
+	client, err := offline.Open(cacheDir)
+	if err != nil {
+		return nil, err
 	}
+	client.Limit = settings.Limit
+	return client, nil
+}
+
+func main() {
+	// Outside the full-screen UIs, retry waits are reported on stderr
+	retry.SetNotifier(func(message string, wait time.Duration) {
+		fmt.Fprintf(os.Stderr, "%s\n", message)
+	})
+
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
 }
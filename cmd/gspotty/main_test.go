@@ -1,12 +1,30 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"text/template"
 	"time"
 
+	"github.com/iamgaru/gspotty/internal/account"
+	"github.com/iamgaru/gspotty/internal/api"
+	"github.com/iamgaru/gspotty/internal/cli"
+	"github.com/iamgaru/gspotty/internal/config"
+	"github.com/iamgaru/gspotty/internal/fakespotify"
 	"github.com/iamgaru/gspotty/internal/testutils"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/zmb3/spotify/v2"
 )
 
@@ -48,13 +66,13 @@ func TestMainFunctionality(t *testing.T) {
 		assert.NoError(t, err)
 		assert.True(t, mockClient.PreviousCalled)
 
-		err = mockClient.Seek(context.Background(), time.Second*30)
+		err = mockClient.Seek(context.Background(), int((time.Second * 30).Milliseconds()))
 		assert.NoError(t, err)
 		assert.True(t, mockClient.SeekCalled)
 
-		err = mockClient.SetVolume(context.Background(), 50)
+		err = mockClient.Volume(context.Background(), 50)
 		assert.NoError(t, err)
-		assert.True(t, mockClient.SetVolumeCalled)
+		assert.True(t, mockClient.VolumeCalled)
 	})
 }
 
@@ -91,3 +109,567 @@ func searchPlaylists(ctx context.Context, client *testutils.MockSpotifyClient, q
 func stopCurrentlyPlaying(client *testutils.MockSpotifyClient) error {
 	return client.Pause(context.Background())
 }
+
+// TestAccountsCommand tests managing named accounts from the command line
+func TestAccountsCommand(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	run := func(args ...string) (int, string) {
+		var stdout, stderr bytes.Buffer
+		code := runAccountsCommand(args, &stdout, &stderr)
+		return code, stdout.String() + stderr.String()
+	}
+
+	code, output := run("list")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, output, "No accounts configured")
+
+	code, _ = run("add", "-client-id", "work_id", "-default", "work")
+	assert.Equal(t, 0, code)
+	code, _ = run("add", "home")
+	assert.Equal(t, 0, code)
+	code, output = run("add", "home")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, output, "already exists")
+
+	code, output = run("list")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "  home\n* work (client ID work_id)\n", output)
+
+	code, _ = run("default", "home")
+	assert.Equal(t, 0, code)
+
+	// Removing an account deletes its stored token
+	tokenPath, err := account.TokenPath("work")
+	require.NoError(t, err)
+	assert.NoError(t, os.WriteFile(tokenPath, []byte("{}"), 0600))
+	code, _ = run("remove", "work")
+	assert.Equal(t, 0, code)
+	_, err = os.Stat(tokenPath)
+	assert.True(t, os.IsNotExist(err))
+
+	code, output = run("list")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "* home\n", output)
+
+	code, _ = run("bogus")
+	assert.Equal(t, 1, code)
+}
+
+// TestCacheCommand tests clearing the response cache from the command line
+func TestCacheCommand(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	dir, err := config.ResponseCacheDir()
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(dir, 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "abc.json"), []byte("{}"), 0600))
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, runCacheCommand([]string{"clear"}, &stdout, &stderr))
+	assert.Contains(t, stdout.String(), "Removed 1 cached responses")
+	_, err = os.Stat(filepath.Join(dir, "abc.json"))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Equal(t, 1, runCacheCommand(nil, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "Usage: gspotty cache")
+}
+
+// TestAuthCommand tests auth status, refresh and logout against the fake server
+func TestAuthCommand(t *testing.T) {
+	server := fakespotify.NewServer()
+	defer server.Close()
+	server.AddRefreshToken("stored-refresh-token")
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SPOTIFY_ID", "test_id")
+	t.Setenv("SPOTIFY_SECRET", "test_secret")
+	t.Setenv(config.APIURLEnv, server.APIURL())
+	t.Setenv(config.AccountsURLEnv, server.AccountsURL())
+
+	// An expired token whose refresh response does not repeat the scopes
+	tokenPath, err := account.TokenPath(account.DefaultName)
+	require.NoError(t, err)
+	stored := `{"access_token":"old","refresh_token":"stored-refresh-token","token_type":"Bearer",` +
+		`"expiry":"2020-01-01T00:00:00Z","scope":"user-read-playback-state user-modify-playback-state"}`
+	assert.NoError(t, os.WriteFile(tokenPath, []byte(stored), 0600))
+
+	run := func(args ...string) (int, string) {
+		var stdout, stderr bytes.Buffer
+		code := runAuthCommand(args, &stdout, &stderr)
+		return code, stdout.String() + stderr.String()
+	}
+
+	code, output := run("status")
+	assert.Equal(t, 0, code, output)
+	assert.Contains(t, output, "User:         Fake User (fake_user)")
+	assert.Contains(t, output, "Scopes:       user-read-playback-state user-modify-playback-state")
+	assert.NotContains(t, output, "expired")
+
+	code, output = run("status", "-json")
+	assert.Equal(t, 0, code, output)
+	var status cli.AuthStatus
+	assert.NoError(t, json.Unmarshal([]byte(output), &status))
+	assert.Equal(t, "default", status.Account)
+	assert.Equal(t, []string{"user-read-playback-state", "user-modify-playback-state"}, status.Scopes)
+	assert.True(t, status.Expiry.After(time.Now()))
+
+	code, output = run("refresh")
+	assert.Equal(t, 0, code, output)
+	assert.Contains(t, output, "Token refreshed")
+	assert.Equal(t, []string{"POST /api/token", "GET /v1/me", "GET /v1/me", "POST /api/token"}, server.Requests())
+
+	code, _ = run("logout")
+	assert.Equal(t, 0, code)
+	code, output = run("status")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, output, "not logged in")
+
+	code, _ = run("status", "-account", "missing")
+	assert.Equal(t, 1, code)
+}
+
+// TestLegacyArgs tests that the flags of earlier versions map onto commands
+func TestLegacyArgs(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"-q", "Bohemian Rhapsody"}, []string{"search", "--", "Bohemian Rhapsody"}},
+		{[]string{"-t", "album", "-q", "Dark Side", "-l", "3", "-d"}, []string{"search", "-t=album", "-l=3", "-d=true", "--", "Dark Side"}},
+		{[]string{"--query", "x", "--auto-play", "--keep-playing"}, []string{"search", "-k=true", "-p=true", "--", "x"}},
+		{[]string{"-q", "-starts-with-dash", "-r"}, []string{"search", "-r=true", "--", "-starts-with-dash"}},
+		{[]string{"-account", "work", "-offline", "-q", "x"}, []string{"search", "-account=work", "-offline=true", "--", "x"}},
+		{[]string{"-p"}, []string{"search", "-p=true"}},
+		// -u beats -s, which beats -i
+		{[]string{"-s", "-i", "-u", "spotify"}, []string{"profile", "--", "spotify"}},
+		{[]string{"-i", "-stop", "-no-browser"}, []string{"pause", "-no-browser=true"}},
+		{[]string{"-i", "-k", "-q", "ignored"}, []string{"menu", "-k=true"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.args), func(t *testing.T) {
+			mapped, err := legacyArgs(tt.args, io.Discard)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, mapped)
+		})
+	}
+
+	_, err := legacyArgs([]string{"-x"}, io.Discard)
+	assert.Error(t, err)
+}
+
+// TestRun tests dispatching commands and reporting usage errors
+func TestRun(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	run := func(args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		code := run(args, strings.NewReader(""), &stdout, &stderr)
+		return code, stdout.String(), stderr.String()
+	}
+
+	code, _, stderr := run()
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, "Commands:")
+
+	code, _, stderr = run("bogus")
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, `unknown command "bogus"`)
+
+	code, stdout, _ := run("help")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "search     Search for tracks")
+
+	code, stdout, _ = run("help", "search")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "Usage: gspotty search [options] QUERY")
+	assert.Contains(t, stdout, "-offline")
+	assert.NotContains(t, stdout, "-limit")
+
+	code, stdout, _ = run("help", "accounts")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, accountsUsage, stdout)
+
+	code, _, _ = run("-h")
+	assert.Equal(t, 0, code)
+
+	code, _, stderr = run("search")
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, "missing search query")
+
+	code, _, stderr = run("-t", "song", "-q", "x")
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, `invalid search type "song"`)
+
+	code, _, stderr = run("profile", "a", "b")
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, "exactly one user ID")
+
+	code, _, stderr = run("next", "-bogus")
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, "Usage: gspotty next")
+
+	// Without credentials, and no terminal for the wizard, commands explain how
+	// to set them up on stderr and fail with their exit code
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("SPOTIFY_ID", "")
+	t.Setenv("SPOTIFY_SECRET", "")
+	code, stdout, stderr = run("devices")
+	assert.Equal(t, exitMissingCredentials, code)
+	assert.Empty(t, stdout)
+	assert.Contains(t, stderr, "Missing SPOTIFY_ID")
+	assert.Contains(t, stderr, "Error: missing Spotify credentials: SPOTIFY_ID and SPOTIFY_SECRET not set")
+}
+
+// newPlayerServer returns a fake Spotify with an album and two devices, and
+// points gspotty at it with a stored login
+func newPlayerServer(t *testing.T) *fakespotify.Server {
+	server := fakespotify.NewServer()
+	t.Cleanup(server.Close)
+	server.AddRefreshToken("stored-refresh-token")
+	server.AddAlbum(spotify.SimpleAlbum{ID: "opera", Name: "A Night at the Opera"},
+		spotify.FullTrack{SimpleTrack: spotify.SimpleTrack{ID: "bohemian", Name: "Bohemian Rhapsody", Artists: []spotify.SimpleArtist{{Name: "Queen"}}, Duration: 354000}},
+		spotify.FullTrack{SimpleTrack: spotify.SimpleTrack{ID: "love", Name: "Love of My Life", Artists: []spotify.SimpleArtist{{Name: "Queen"}}}},
+	)
+	server.AddDevice(spotify.PlayerDevice{ID: "kitchen", Name: "Kitchen", Type: "Speaker", Volume: 40, Active: true})
+	server.AddDevice(spotify.PlayerDevice{ID: "laptop", Name: "Laptop", Type: "Computer", Volume: 80})
+
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("SPOTIFY_ID", "test_id")
+	t.Setenv("SPOTIFY_SECRET", "test_secret")
+	t.Setenv(config.APIURLEnv, server.APIURL())
+	t.Setenv(config.AccountsURLEnv, server.AccountsURL())
+
+	tokenPath, err := account.TokenPath(account.DefaultName)
+	require.NoError(t, err)
+	stored := `{"access_token":"old","refresh_token":"stored-refresh-token","token_type":"Bearer",` +
+		`"expiry":"2020-01-01T00:00:00Z","scope":"user-read-playback-state user-modify-playback-state"}`
+	require.NoError(t, os.WriteFile(tokenPath, []byte(stored), 0600))
+	return server
+}
+
+// TestSecretCommand tests that a run resolves the secret once, and not at all
+// under PKCE, which never sends it
+func TestSecretCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test command needs a POSIX shell")
+	}
+	newPlayerServer(t)
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("SPOTIFY_SECRET", "")
+	calls := filepath.Join(t.TempDir(), "calls")
+	t.Setenv("GSPOTTY_SECRET_COMMAND", "echo call >> "+calls+"; echo test_secret")
+
+	countCalls := func() int {
+		data, err := os.ReadFile(calls)
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0
+		}
+		require.NoError(t, err)
+		return strings.Count(string(data), "call\n")
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"devices"}, strings.NewReader(""), &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, 1, countCalls())
+
+	t.Setenv(config.AuthFlowEnv, config.AuthFlowPKCE)
+	code = run([]string{"devices"}, strings.NewReader(""), &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, 1, countCalls())
+}
+
+// TestPlayerCommands tests the playback commands against the fake server
+func TestPlayerCommands(t *testing.T) {
+	server := newPlayerServer(t)
+
+	run := func(args ...string) (int, string) {
+		var stdout, stderr bytes.Buffer
+		code := run(args, strings.NewReader(""), &stdout, &stderr)
+		return code, stdout.String() + stderr.String()
+	}
+
+	code, output := run("devices")
+	assert.Equal(t, 0, code, output)
+	assert.Equal(t, "* Kitchen (Speaker, volume 40%)  kitchen\n  Laptop (Computer, volume 80%)  laptop\n", output)
+
+	// Nothing has played yet, so there is nothing to resume
+	code, _ = run("play")
+	assert.Equal(t, exitError, code)
+
+	require.NoError(t, server.Client().PlayOpt(context.Background(), &spotify.PlayOptions{
+		URIs: []spotify.URI{"spotify:track:bohemian", "spotify:track:love"},
+	}))
+
+	server.SetPlayMode(true, "context")
+	require.NoError(t, server.Client().Seek(context.Background(), 65000))
+
+	code, output = run("status")
+	assert.Equal(t, 0, code, output)
+	assert.Contains(t, output, "Playing: Bohemian Rhapsody by Queen")
+	assert.Contains(t, output, "Progress: 1:05 / 5:54")
+	assert.Contains(t, output, "Device:   Kitchen (Speaker, volume 40%)")
+	assert.Contains(t, output, "Shuffle:  on")
+	assert.Contains(t, output, "Repeat:   context")
+
+	code, output = run("status", "-format", "{{.State}}: {{.Artist}} - {{.Track}} [{{.Progress}}/{{.Duration}}] on {{.Device}}")
+	assert.Equal(t, 0, code, output)
+	assert.Equal(t, "playing: Queen - Bohemian Rhapsody [1:05/5:54] on Kitchen\n", output)
+
+	code, output = run("status", "-json")
+	assert.Equal(t, 0, code, output)
+	var status map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(output), &status))
+	assert.Equal(t, map[string]interface{}{
+		"active":      true,
+		"playing":     true,
+		"track":       "Bohemian Rhapsody",
+		"artists":     []interface{}{"Queen"},
+		"album":       "A Night at the Opera",
+		"uri":         "spotify:track:bohemian",
+		"progress_ms": 65000.0,
+		"duration_ms": 354000.0,
+		"device":      "Kitchen",
+		"device_type": "Speaker",
+		"volume":      40.0,
+		"shuffle":     true,
+		"repeat":      "context",
+	}, status)
+
+	code, output = run("next")
+	assert.Equal(t, 0, code, output)
+	assert.Equal(t, spotify.URI("spotify:track:love"), server.Playback().CurrentURI())
+
+	code, output = run("previous")
+	assert.Equal(t, 0, code, output)
+	assert.Equal(t, spotify.URI("spotify:track:bohemian"), server.Playback().CurrentURI())
+
+	// The legacy -s flag pauses, like the pause command
+	code, _ = run("-s")
+	assert.Equal(t, 0, code)
+	assert.False(t, server.Playback().Playing)
+	code, output = run("status")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, output, "Paused: Bohemian Rhapsody by Queen")
+
+	code, output = run("play")
+	assert.Equal(t, 0, code, output)
+	assert.Contains(t, output, "Playback resumed.")
+	assert.True(t, server.Playback().Playing)
+
+	// Moving playback keeps the track and its position
+	require.NoError(t, server.Client().Seek(context.Background(), 60000))
+	code, output = run("transfer", "laptop")
+	assert.Equal(t, 0, code, output)
+	assert.Contains(t, output, "Playback moved to Laptop.")
+	playback := server.Playback()
+	assert.Equal(t, spotify.ID("laptop"), playback.DeviceID)
+	assert.Equal(t, spotify.URI("spotify:track:bohemian"), playback.CurrentURI())
+	assert.Equal(t, 60000, playback.ProgressMs)
+	assert.True(t, playback.Playing)
+
+	code, output = run("pause", "-device", "Laptop")
+	assert.Equal(t, 0, code, output)
+	assert.False(t, server.Playback().Playing)
+
+	code, output = run("play", "-device", "kitchen")
+	assert.Equal(t, 0, code, output)
+	playback = server.Playback()
+	assert.Equal(t, spotify.ID("kitchen"), playback.DeviceID)
+	assert.True(t, playback.Playing)
+
+	code, output = run("play", "-device", "Toaster")
+	assert.Equal(t, exitNoDevice, code)
+	assert.Contains(t, output, "available devices: Kitchen, Laptop")
+
+	code, _ = run("transfer")
+	assert.Equal(t, exitUsage, code)
+
+	code, _ = run("next", "-account", "missing")
+	assert.Equal(t, exitError, code)
+}
+
+// TestSearchOutput tests printing search results instead of opening the results view
+func TestSearchOutput(t *testing.T) {
+	newPlayerServer(t)
+
+	run := func(args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		code := run(args, strings.NewReader(""), &stdout, &stderr)
+		return code, stdout.String(), stderr.String()
+	}
+
+	// Output that is not a terminal gets plain text
+	code, stdout, stderr := run("search", "bohemian")
+	assert.Equal(t, 0, code, stderr)
+	assert.Equal(t, ""+
+		"NAME               ARTISTS  ALBUM                 DURATION  POPULARITY  ID        URI\n"+
+		"Bohemian Rhapsody  Queen    A Night at the Opera  5:54      0           bohemian  spotify:track:bohemian\n",
+		stdout)
+
+	code, stdout, stderr = run("search", "-output", "json", "-t", "album", "opera")
+	assert.Equal(t, 0, code, stderr)
+	var albums []map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(stdout), &albums))
+	require.Len(t, albums, 1)
+	assert.Equal(t, "spotify:album:opera", albums[0]["uri"])
+	assert.Equal(t, 2.0, albums[0]["total_tracks"])
+
+	// The legacy flags print too
+	code, stdout, stderr = run("-q", "love", "-a", "queen")
+	assert.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "Love of My Life")
+
+	code, _, stderr = run("search", "-o", "xml", "queen")
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, `invalid output format "xml"`)
+
+	code, _, stderr = run("search", "-o", "csv", "-p", "queen")
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, "cannot be used with -p or -r")
+}
+
+// TestWatch tests that watching emits a line for each change to the player
+func TestWatch(t *testing.T) {
+	server := newPlayerServer(t)
+	ctx := context.Background()
+	client := server.Client()
+
+	stdout, events := io.Pipe()
+	var stderr bytes.Buffer
+	done := make(chan int)
+	go func() {
+		done <- run([]string{"watch", "-interval", "5ms", "-idle-interval", "20ms", "-count", "4"}, strings.NewReader(""), events, &stderr)
+		events.Close()
+	}()
+
+	lines := bufio.NewScanner(stdout)
+	next := func() map[string]interface{} {
+		require.True(t, lines.Scan(), stderr.String())
+		var event map[string]interface{}
+		require.NoError(t, json.Unmarshal(lines.Bytes(), &event))
+		return event
+	}
+
+	event := next()
+	assert.Equal(t, []interface{}{"start"}, event["changes"])
+	assert.Equal(t, false, event["active"])
+	assert.NotEmpty(t, event["time"])
+
+	require.NoError(t, client.PlayOpt(ctx, &spotify.PlayOptions{URIs: []spotify.URI{"spotify:track:bohemian"}}))
+	event = next()
+	assert.Equal(t, []interface{}{"track", "state"}, event["changes"])
+	assert.Equal(t, "Bohemian Rhapsody", event["track"])
+	assert.Equal(t, true, event["playing"])
+
+	// Progress alone is not a change
+	require.NoError(t, client.Seek(ctx, 30000))
+	require.NoError(t, client.Volume(ctx, 75))
+	event = next()
+	assert.Equal(t, []interface{}{"volume"}, event["changes"])
+	assert.Equal(t, 75.0, event["volume"])
+
+	require.NoError(t, client.TransferPlayback(ctx, "laptop", true))
+	event = next()
+	assert.Equal(t, []interface{}{"device", "volume"}, event["changes"])
+	assert.Equal(t, "Laptop", event["device"])
+
+	assert.Equal(t, 0, <-done)
+	assert.False(t, lines.Scan())
+}
+
+// TestWatchBackoff tests that polls slow down while nothing plays
+func TestWatchBackoff(t *testing.T) {
+	mockClient := &testutils.MockSpotifyClient{}
+	calls := 0
+	client := &countingStateClient{MockSpotifyClient: mockClient, calls: &calls}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	// Waits of 2, 4, 8, 16, 32, 64 and then 80ms fit about 7 polls in the
+	// time that 200 polls would take at the interval
+	var stdout, stderr bytes.Buffer
+	require.NoError(t, watch(ctx, client, &stdout, &stderr, watchOptions{interval: time.Millisecond, idleInterval: 80 * time.Millisecond}))
+	assert.Less(t, calls, 12)
+	assert.Greater(t, calls, 3)
+	// Nothing changed after the first poll
+	assert.Equal(t, 1, strings.Count(stdout.String(), "\n"))
+
+	t.Run("Errors", func(t *testing.T) {
+		failing := &countingStateClient{MockSpotifyClient: mockClient, calls: &calls, err: api.ErrLoginRequired}
+		err := watch(context.Background(), failing, &stdout, &stderr, watchOptions{interval: time.Millisecond, idleInterval: time.Millisecond})
+		assert.True(t, errors.Is(err, api.ErrLoginRequired))
+	})
+}
+
+// countingStateClient counts PlayerState calls, and fails them with err when set
+type countingStateClient struct {
+	*testutils.MockSpotifyClient
+	calls *int
+	err   error
+}
+
+func (c *countingStateClient) PlayerState(ctx context.Context, opts ...spotify.RequestOption) (*spotify.PlayerState, error) {
+	*c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.MockSpotifyClient.PlayerState(ctx, opts...)
+}
+
+// TestStatusFormat tests the status output when nothing is playing and for bad templates
+func TestStatusFormat(t *testing.T) {
+	np := newNowPlaying(nil)
+	assert.False(t, np.Active)
+	assert.Equal(t, "stopped", np.State())
+
+	var out bytes.Buffer
+	writeStatus(&out, np)
+	assert.Equal(t, "Nothing is playing.\n", out.String())
+
+	tmpl := template.Must(template.New("status").Funcs(statusFuncs).Parse(`{{if .Active}}{{upper .Track}}{{else}}-{{end}}`))
+	out.Reset()
+	require.NoError(t, tmpl.Execute(&out, np))
+	assert.Equal(t, "-", out.String())
+
+	t.Setenv("HOME", t.TempDir())
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"status", "-format", "{{.Track"}, strings.NewReader(""), &stdout, &stderr)
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr.String(), "invalid -format template")
+
+	stderr.Reset()
+	code = run([]string{"status", "-format", "x", "-json"}, strings.NewReader(""), &stdout, &stderr)
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr.String(), "cannot be used together")
+}
+
+// TestExitCode tests that each login failure maps to its own exit code
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected int
+	}{
+		{fmt.Errorf("%w: SPOTIFY_ID must be set", api.ErrMissingCredentials), exitMissingCredentials},
+		{fmt.Errorf("authorization failed: %w", api.ErrAuthorizationDenied), exitAuthorizationDenied},
+		{api.ErrStateMismatch, exitStateMismatch},
+		{api.ErrAuthorizationTimeout, exitAuthorizationTimeout},
+		{api.ErrTokenExchange, exitTokenExchange},
+		{fmt.Errorf("%w: log in first", api.ErrLoginRequired), exitLoginRequired},
+		{fmt.Errorf("%w: playback needs Spotify", api.ErrOffline), exitOffline},
+		{errors.New("something else"), exitError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			var stderr bytes.Buffer
+			assert.Equal(t, tt.expected, reportError(&stderr, tt.err))
+			assert.Contains(t, stderr.String(), tt.err.Error())
+		})
+	}
+}
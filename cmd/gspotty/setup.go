@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"io"
+
+	"github.com/iamgaru/gspotty/internal/config"
+	"github.com/iamgaru/gspotty/internal/setup"
+)
+
+// setupUsage describes the setup command
+const setupUsage = `Usage: gspotty setup
+
+Ask for the client ID and secret of your Spotify app, check them with Spotify
+and save them for later runs.
+`
+
+// runSetupCommand runs "gspotty setup" and returns the process exit code
+func runSetupCommand(stdin io.Reader, stdout, stderr io.Writer) int {
+	flow, err := config.LoadAuthFlow()
+	if err != nil {
+		return reportError(stderr, err)
+	}
+	if _, err := setup.Run(context.Background(), stdin, stdout, flow); err != nil {
+		return reportError(stderr, err)
+	}
+	return 0
+}
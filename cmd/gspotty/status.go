@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/zmb3/spotify/v2"
+)
+
+// nowPlaying is what gspotty status reports. Its fields are the JSON output
+// and what -format templates refer to, such as {{.Track}} or {{.Progress}}.
+type nowPlaying struct {
+	// Active is false when no track is loaded; only the device fields may then be set
+	Active     bool     `json:"active"`
+	Playing    bool     `json:"playing"`
+	Track      string   `json:"track"`
+	Artists    []string `json:"artists"`
+	Album      string   `json:"album"`
+	URI        string   `json:"uri"`
+	ProgressMs int      `json:"progress_ms"`
+	DurationMs int      `json:"duration_ms"`
+	Device     string   `json:"device"`
+	DeviceType string   `json:"device_type"`
+	Volume     int      `json:"volume"`
+	Shuffle    bool     `json:"shuffle"`
+	// Repeat is off, track or context
+	Repeat string `json:"repeat"`
+}
+
+// newNowPlaying summarizes a player state, which is nil when nothing is playing
+func newNowPlaying(state *spotify.PlayerState) nowPlaying {
+	np := nowPlaying{Artists: []string{}, Repeat: "off"}
+	if state == nil {
+		return np
+	}
+
+	// A device can be active with nothing loaded on it
+	np.Device = state.Device.Name
+	np.DeviceType = state.Device.Type
+	np.Volume = int(state.Device.Volume)
+	np.Shuffle = state.ShuffleState
+	if state.RepeatState != "" {
+		np.Repeat = state.RepeatState
+	}
+	if state.Item == nil {
+		return np
+	}
+
+	track := state.Item
+	np.Active = true
+	np.Playing = state.Playing
+	np.Track = track.Name
+	for _, artist := range track.Artists {
+		np.Artists = append(np.Artists, artist.Name)
+	}
+	np.Album = track.Album.Name
+	np.URI = string(track.URI)
+	np.ProgressMs = int(state.Progress)
+	np.DurationMs = int(track.Duration)
+	return np
+}
+
+// Artist returns the artists joined with commas
+func (np nowPlaying) Artist() string {
+	return strings.Join(np.Artists, ", ")
+}
+
+// Progress returns how far into the track playback is, as M:SS
+func (np nowPlaying) Progress() string {
+	return formatMillis(np.ProgressMs)
+}
+
+// Duration returns the length of the track as M:SS
+func (np nowPlaying) Duration() string {
+	return formatMillis(np.DurationMs)
+}
+
+// State returns playing, paused or stopped
+func (np nowPlaying) State() string {
+	switch {
+	case !np.Active:
+		return "stopped"
+	case np.Playing:
+		return "playing"
+	default:
+		return "paused"
+	}
+}
+
+// statusFuncs are the functions -format templates can use besides the builtins
+var statusFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// writeStatus prints the status for people to read
+func writeStatus(w io.Writer, np nowPlaying) {
+	if !np.Active {
+		fmt.Fprintln(w, "Nothing is playing.")
+		return
+	}
+
+	verb := "Paused"
+	if np.Playing {
+		verb = "Playing"
+	}
+	shuffle := "off"
+	if np.Shuffle {
+		shuffle = "on"
+	}
+	fmt.Fprintf(w, "%s: %s by %s\n", verb, np.Track, np.Artist())
+	fmt.Fprintf(w, "Album:    %s\n", np.Album)
+	fmt.Fprintf(w, "Progress: %s / %s\n", np.Progress(), np.Duration())
+	if np.Device != "" {
+		fmt.Fprintf(w, "Device:   %s (%s, volume %d%%)\n", np.Device, np.DeviceType, np.Volume)
+	}
+	fmt.Fprintf(w, "Shuffle:  %s\n", shuffle)
+	fmt.Fprintf(w, "Repeat:   %s\n", np.Repeat)
+}
+
+// statusCommand runs "gspotty status"
+func statusCommand(p *playerContext, args []string) error {
+	format := p.flags.String("format", "", "Print the status with a Go template, e.g. '{{.Artist}} - {{.Track}}'")
+	jsonOutput := p.flags.Bool("json", false, "Print the status as JSON")
+	if err := p.parseNoArgs("status", args); err != nil {
+		return err
+	}
+	if *format != "" && *jsonOutput {
+		return p.usageError("-format and -json cannot be used together")
+	}
+
+	// Check the template before asking Spotify
+	var tmpl *template.Template
+	if *format != "" {
+		var err error
+		tmpl, err = template.New("status").Funcs(statusFuncs).Parse(*format)
+		if err != nil {
+			return p.usageError("invalid -format template: %v", err)
+		}
+	}
+
+	client, err := p.client(true)
+	if err != nil {
+		return err
+	}
+	state, err := client.PlayerState(p.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get the playback state: %w", err)
+	}
+	np := newNowPlaying(state)
+
+	switch {
+	case *jsonOutput:
+		return writeJSON(p.stdout, np)
+	case tmpl != nil:
+		var out strings.Builder
+		if err := tmpl.Execute(&out, np); err != nil {
+			return fmt.Errorf("failed to format the status: %w", err)
+		}
+		// Status lines read one line per run
+		fmt.Fprintln(p.stdout, strings.TrimSuffix(out.String(), "\n"))
+		return nil
+	default:
+		writeStatus(p.stdout, np)
+		return nil
+	}
+}
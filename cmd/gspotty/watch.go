@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/iamgaru/gspotty/internal/api"
+	"github.com/iamgaru/gspotty/internal/offline"
+	"github.com/zmb3/spotify/v2"
+)
+
+// watchEvent is a line of gspotty watch output: the status, and what changed
+// since the previous line. The first line's change is "start".
+type watchEvent struct {
+	Time    time.Time `json:"time"`
+	Changes []string  `json:"changes"`
+	nowPlaying
+}
+
+// watchOptions control how gspotty watch polls
+type watchOptions struct {
+	// interval is the wait between polls while a track is playing
+	interval time.Duration
+	// idleInterval is the longest wait while nothing plays; the wait doubles up to it
+	idleInterval time.Duration
+	// count stops watching after that many events; 0 watches until cancelled
+	count int
+}
+
+// changes lists what differs between two statuses, in the order the watch
+// output reports it
+func changes(previous, current nowPlaying) []string {
+	var changed []string
+	if previous.URI != current.URI {
+		changed = append(changed, "track")
+	}
+	if previous.State() != current.State() {
+		changed = append(changed, "state")
+	}
+	if previous.Device != current.Device {
+		changed = append(changed, "device")
+	}
+	if previous.Volume != current.Volume {
+		changed = append(changed, "volume")
+	}
+	return changed
+}
+
+// transient reports whether a failed poll is worth waiting out: Spotify could
+// not be reached, or answered with a server error
+func transient(err error) bool {
+	var spotifyErr spotify.Error
+	return offline.Unreachable(err) || errors.As(err, &spotifyErr) && spotifyErr.Status >= 500
+}
+
+// watch polls the player state and writes an event to w whenever it changes,
+// until ctx is cancelled. Network trouble and Spotify outages are reported to
+// stderr and waited out; other errors end the watch.
+func watch(ctx context.Context, client api.Client, w, stderr io.Writer, opts watchOptions) error {
+	encoder := json.NewEncoder(w)
+	var previous *nowPlaying
+	wait := opts.interval
+	events := 0
+
+	for {
+		changed := false
+		state, err := client.PlayerState(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case err != nil && transient(err):
+			fmt.Fprintf(stderr, "Warning: failed to get the playback state: %v\n", err)
+		case err != nil:
+			return fmt.Errorf("failed to get the playback state: %w", err)
+		default:
+			current := newNowPlaying(state)
+			event := watchEvent{Time: time.Now().UTC(), Changes: []string{"start"}, nowPlaying: current}
+			if previous != nil {
+				event.Changes = changes(*previous, current)
+			}
+			previous = &current
+
+			if len(event.Changes) > 0 {
+				changed = true
+				if err := encoder.Encode(event); err != nil {
+					return fmt.Errorf("failed to write event: %w", err)
+				}
+				events++
+				if opts.count > 0 && events >= opts.count {
+					return nil
+				}
+			}
+		}
+
+		// Poll at the interval while music plays, and back off while it does not
+		if changed || (previous != nil && previous.Playing) {
+			wait = opts.interval
+		} else if wait *= 2; wait > opts.idleInterval {
+			wait = opts.idleInterval
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// watchCommand runs "gspotty watch"
+func watchCommand(p *playerContext, args []string) error {
+	opts := watchOptions{}
+	p.flags.DurationVar(&opts.interval, "interval", 2*time.Second, "How often to poll the player while a track is playing")
+	p.flags.DurationVar(&opts.idleInterval, "idle-interval", 30*time.Second, "Longest wait between polls while nothing is playing")
+	p.flags.IntVar(&opts.count, "count", 0, "Stop after this many events instead of when interrupted")
+	if err := p.parseNoArgs("watch", args); err != nil {
+		return err
+	}
+	if opts.interval <= 0 {
+		return p.usageError("-interval must be positive")
+	}
+	if opts.idleInterval < opts.interval {
+		return p.usageError("-idle-interval must be at least -interval")
+	}
+	if opts.count < 0 {
+		return p.usageError("-count must not be negative")
+	}
+
+	client, err := p.client(true)
+	if err != nil {
+		return err
+	}
+
+	// Interrupting the watch is the normal way to end it
+	ctx, stop := signal.NotifyContext(p.ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return watch(ctx, client, p.stdout, p.stderr, opts)
+}
@@ -0,0 +1,253 @@
+// Package account manages the named Spotify accounts gspotty can log in as.
+//
+// Each account has its own stored token and may use its own client ID, so
+// several people can share a machine, or one person can keep separate logins.
+package account
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/iamgaru/gspotty/internal/config"
+)
+
+const (
+	// DefaultName is the account used when none is selected or configured
+	DefaultName = "default"
+
+	registryFile = "accounts.json"
+
+	// Files in the home directory used before gspotty followed the XDG layout
+	legacyRegistryFile = ".gspotty_accounts.json"
+	legacyTokenFile    = ".spotify_token.json"
+)
+
+// validName restricts account names to characters that are safe in file names
+var validName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
+
+// Account is a named Spotify login
+type Account struct {
+	Name string `json:"name"`
+	// ClientID overrides SPOTIFY_ID for this account
+	ClientID string `json:"client_id,omitempty"`
+}
+
+// Credentials resolves the app credentials for the account and authorization
+// flow, with its client ID in place of the configured one
+func (a Account) Credentials(flow string) (config.Credentials, error) {
+	credentials, err := config.LoadCredentials(flow)
+	if err != nil {
+		return config.Credentials{}, err
+	}
+	if a.ClientID != "" {
+		credentials.ClientID = a.ClientID
+	}
+	return credentials, nil
+}
+
+// Registry is the set of configured accounts and the default selection
+type Registry struct {
+	Default  string    `json:"default,omitempty"`
+	Accounts []Account `json:"accounts"`
+
+	path string
+}
+
+// homePath returns the location of a file in the user's home directory
+func homePath(name string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+	return filepath.Join(homeDir, name), nil
+}
+
+// migrate moves a file from its legacy location unless the new one already exists
+func migrate(legacy, path string) error {
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	data, err := os.ReadFile(legacy)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to migrate %s: %v", legacy, err)
+	}
+
+	if err := config.EnsureDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	// Renaming fails across file systems, so fall back to copying
+	if err := os.Rename(legacy, path); err == nil {
+		return nil
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to migrate %s: %v", legacy, err)
+	}
+	return os.Remove(legacy)
+}
+
+// TokenPath returns the location of an account's stored token in the state
+// directory, e.g. ~/.local/state/gspotty/tokens/default.json. A token left in
+// the home directory by an older gspotty is moved there first.
+func TokenPath(name string) (string, error) {
+	if name == "" {
+		name = DefaultName
+	}
+
+	stateDir, err := config.StateDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(stateDir, "tokens", name+".json")
+	if err := config.EnsureDir(filepath.Dir(path)); err != nil {
+		return "", err
+	}
+
+	legacyName := legacyTokenFile
+	if name != DefaultName {
+		legacyName = ".spotify_token_" + name + ".json"
+	}
+	legacy, err := homePath(legacyName)
+	if err != nil {
+		return "", err
+	}
+	if err := migrate(legacy, path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Load reads the account registry from the config directory, moving it there
+// from the home directory first if needed. A missing registry is an empty one.
+func Load() (*Registry, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, registryFile)
+
+	legacy, err := homePath(legacyRegistryFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate(legacy, path); err != nil {
+		return nil, err
+	}
+
+	registry := &Registry{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return registry, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, registry); err != nil {
+		return nil, fmt.Errorf("account registry %s is corrupt: %v", path, err)
+	}
+	return registry, nil
+}
+
+// Save writes the registry back, replacing the previous file atomically
+func (r *Registry) Save() error {
+	if err := config.EnsureDir(filepath.Dir(r.path)); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal accounts: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), registryFile+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create account registry: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write account registry: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write account registry: %v", err)
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
+
+// Get returns the named account
+func (r *Registry) Get(name string) (Account, bool) {
+	for _, account := range r.Accounts {
+		if account.Name == name {
+			return account, true
+		}
+	}
+	return Account{}, false
+}
+
+// Add registers a new account
+func (r *Registry) Add(account Account) error {
+	if !validName.MatchString(account.Name) {
+		return fmt.Errorf("invalid account name %q: use up to 32 letters, digits, '-' or '_'", account.Name)
+	}
+	if _, exists := r.Get(account.Name); exists {
+		return fmt.Errorf("account %q already exists", account.Name)
+	}
+
+	r.Accounts = append(r.Accounts, account)
+	sort.Slice(r.Accounts, func(i, j int) bool {
+		return r.Accounts[i].Name < r.Accounts[j].Name
+	})
+	return nil
+}
+
+// Remove unregisters an account, clearing the default if it pointed at it
+func (r *Registry) Remove(name string) error {
+	for i, account := range r.Accounts {
+		if account.Name == name {
+			r.Accounts = append(r.Accounts[:i], r.Accounts[i+1:]...)
+			if r.Default == name {
+				r.Default = ""
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("account %q does not exist", name)
+}
+
+// SetDefault selects the account used when --account is not given
+func (r *Registry) SetDefault(name string) error {
+	if _, exists := r.Get(name); !exists && name != DefaultName {
+		return fmt.Errorf("account %q does not exist", name)
+	}
+	r.Default = name
+	return nil
+}
+
+// Resolve returns the account to use for the given selection. An empty name
+// selects the configured default, and the default account always exists.
+func (r *Registry) Resolve(name string) (Account, error) {
+	if name == "" {
+		name = r.Default
+	}
+	if name == "" {
+		name = DefaultName
+	}
+
+	if account, exists := r.Get(name); exists {
+		return account, nil
+	}
+	if name == DefaultName {
+		return Account{Name: DefaultName}, nil
+	}
+	return Account{}, fmt.Errorf("account %q does not exist (add it with: gspotty accounts add %s)", name, name)
+}
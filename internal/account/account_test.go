@@ -0,0 +1,124 @@
+package account
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRegistry tests adding, selecting and removing accounts
+func TestRegistry(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+
+	registry, err := Load()
+	require.NoError(t, err)
+	assert.Empty(t, registry.Accounts)
+
+	t.Run("Implicit Default", func(t *testing.T) {
+		account, err := registry.Resolve("")
+		require.NoError(t, err)
+		assert.Equal(t, DefaultName, account.Name)
+
+		_, err = registry.Resolve("work")
+		assert.Error(t, err)
+	})
+
+	t.Run("Add", func(t *testing.T) {
+		require.NoError(t, registry.Add(Account{Name: "work", ClientID: "work_id"}))
+		require.NoError(t, registry.Add(Account{Name: "home"}))
+		assert.Error(t, registry.Add(Account{Name: "work"}))
+		assert.Error(t, registry.Add(Account{Name: "../evil"}))
+		assert.Equal(t, "home", registry.Accounts[0].Name)
+
+		require.NoError(t, registry.SetDefault("work"))
+		assert.Error(t, registry.SetDefault("missing"))
+		require.NoError(t, registry.Save())
+
+		info, err := os.Stat(filepath.Join(home, ".config", "gspotty", registryFile))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	})
+
+	t.Run("Resolve", func(t *testing.T) {
+		loaded, err := Load()
+		require.NoError(t, err)
+
+		account, err := loaded.Resolve("")
+		require.NoError(t, err)
+		assert.Equal(t, Account{Name: "work", ClientID: "work_id"}, account)
+
+		account, err = loaded.Resolve("home")
+		require.NoError(t, err)
+		assert.Equal(t, "home", account.Name)
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		require.NoError(t, registry.Remove("work"))
+		assert.Empty(t, registry.Default)
+		assert.Error(t, registry.Remove("work"))
+	})
+}
+
+// TestTokenPath tests that tokens live in the state directory, one file per account
+func TestTokenPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_STATE_HOME", "")
+
+	path, err := TokenPath(DefaultName)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(home, ".local", "state", "gspotty", "tokens", "default.json"), path)
+
+	info, err := os.Stat(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	stateHome := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", stateHome)
+	path, err = TokenPath("work")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(stateHome, "gspotty", "tokens", "work.json"), path)
+}
+
+// TestMigration tests that files left in the home directory by older versions are moved once
+func TestMigration(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("XDG_STATE_HOME", "")
+
+	legacyToken := filepath.Join(home, ".spotify_token.json")
+	require.NoError(t, os.WriteFile(legacyToken, []byte(`{"refresh_token":"legacy"}`), 0600))
+	legacyWorkToken := filepath.Join(home, ".spotify_token_work.json")
+	require.NoError(t, os.WriteFile(legacyWorkToken, []byte(`{"refresh_token":"work"}`), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(home, legacyRegistryFile), []byte(`{"default":"work","accounts":[{"name":"work"}]}`), 0600))
+
+	registry, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "work", registry.Default)
+	_, err = os.Stat(filepath.Join(home, legacyRegistryFile))
+	assert.True(t, os.IsNotExist(err))
+
+	for name, legacy := range map[string]string{DefaultName: legacyToken, "work": legacyWorkToken} {
+		path, err := TokenPath(name)
+		require.NoError(t, err)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "refresh_token")
+		_, err = os.Stat(legacy)
+		assert.True(t, os.IsNotExist(err))
+	}
+
+	// A file already in the new location wins over a stale legacy one
+	require.NoError(t, os.WriteFile(legacyToken, []byte(`{"refresh_token":"stale"}`), 0600))
+	path, err := TokenPath(DefaultName)
+	require.NoError(t, err)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "legacy")
+}
@@ -0,0 +1,53 @@
+// Package api defines the subset of the Spotify Web API used by gspotty.
+package api
+
+import (
+	"context"
+
+	"github.com/zmb3/spotify/v2"
+)
+
+// Client is the narrow interface over the Spotify Web API that every gspotty
+// package depends on. *spotify.Client satisfies it, and so does
+// testutils.MockSpotifyClient, which lets the real UI and player logic be
+// exercised in tests.
+type Client interface {
+	// Search and catalog lookups
+	Search(ctx context.Context, query string, t spotify.SearchType, opts ...spotify.RequestOption) (*spotify.SearchResult, error)
+	GetTrack(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) (*spotify.FullTrack, error)
+	GetAlbum(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) (*spotify.FullAlbum, error)
+	GetAlbumTracks(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) (*spotify.SimpleTrackPage, error)
+	GetPlaylist(ctx context.Context, playlistID spotify.ID, opts ...spotify.RequestOption) (*spotify.FullPlaylist, error)
+	GetPlaylistItems(ctx context.Context, playlistID spotify.ID, opts ...spotify.RequestOption) (*spotify.PlaylistItemPage, error)
+	GetUsersPublicProfile(ctx context.Context, userID spotify.ID) (*spotify.User, error)
+
+	// Player and device control
+	PlayerDevices(ctx context.Context) ([]spotify.PlayerDevice, error)
+	PlayerState(ctx context.Context, opts ...spotify.RequestOption) (*spotify.PlayerState, error)
+	Play(ctx context.Context) error
+	PlayOpt(ctx context.Context, opt *spotify.PlayOptions) error
+	Pause(ctx context.Context) error
+	PauseOpt(ctx context.Context, opt *spotify.PlayOptions) error
+	Next(ctx context.Context) error
+	NextOpt(ctx context.Context, opt *spotify.PlayOptions) error
+	Previous(ctx context.Context) error
+	PreviousOpt(ctx context.Context, opt *spotify.PlayOptions) error
+	TransferPlayback(ctx context.Context, deviceID spotify.ID, play bool) error
+	Seek(ctx context.Context, position int) error
+	Volume(ctx context.Context, percent int) error
+}
+
+// Ensure the real client satisfies the interface
+var _ Client = (*spotify.Client)(nil)
+
+// Offliner is implemented by clients that can answer from cached data instead
+// of Spotify, so the UIs can say so and disable playback
+type Offliner interface {
+	Offline() bool
+}
+
+// IsOffline reports whether the client is answering from cached data
+func IsOffline(client Client) bool {
+	offliner, ok := client.(Offliner)
+	return ok && offliner.Offline()
+}
@@ -0,0 +1,24 @@
+package api
+
+import "errors"
+
+// Errors returned while building an authorized client. They are wrapped with
+// details, so check for them with errors.Is.
+var (
+	// ErrMissingCredentials means the client ID or secret is not configured
+	ErrMissingCredentials = errors.New("missing Spotify credentials")
+	// ErrAuthorizationDenied means the user, or Spotify, refused the authorization request
+	ErrAuthorizationDenied = errors.New("authorization denied")
+	// ErrStateMismatch means the authorization response did not belong to this login attempt
+	ErrStateMismatch = errors.New("authorization state mismatch")
+	// ErrAuthorizationTimeout means no authorization response arrived in time
+	ErrAuthorizationTimeout = errors.New("authorization timed out")
+	// ErrTokenExchange means the accounts service refused to issue or refresh a token
+	ErrTokenExchange = errors.New("token exchange failed")
+	// ErrLoginRequired means an app-only client was asked to act for a user
+	ErrLoginRequired = errors.New("this needs a Spotify login")
+	// ErrOffline means the request needs Spotify, but gspotty is answering from its cache
+	ErrOffline = errors.New("not available offline")
+	// ErrNoDevice means no Spotify device is open, or none matches the one asked for
+	ErrNoDevice = errors.New("no Spotify device")
+)
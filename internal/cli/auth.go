@@ -0,0 +1,451 @@
+package cli
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iamgaru/gspotty/internal/account"
+	"github.com/iamgaru/gspotty/internal/api"
+	"github.com/iamgaru/gspotty/internal/config"
+	"github.com/iamgaru/gspotty/internal/httpcache"
+	"github.com/iamgaru/gspotty/internal/retry"
+	"github.com/iamgaru/gspotty/internal/tokenstore"
+	"github.com/zmb3/spotify/v2"
+	spotifyauth "github.com/zmb3/spotify/v2/auth"
+	"golang.org/x/oauth2"
+)
+
+// PlaybackScopes are requested on every login, since every mode can start playback
+var PlaybackScopes = []string{
+	spotifyauth.ScopeUserReadPlaybackState,
+	spotifyauth.ScopeUserModifyPlaybackState,
+}
+
+// mergeScopes returns the union of scope lists, keeping the first occurrence order
+func mergeScopes(lists ...[]string) []string {
+	seen := make(map[string]bool)
+	var merged []string
+	for _, list := range lists {
+		for _, scope := range list {
+			if scope != "" && !seen[scope] {
+				seen[scope] = true
+				merged = append(merged, scope)
+			}
+		}
+	}
+	return merged
+}
+
+// missingScopes returns the required scopes that were not granted
+func missingScopes(granted, required []string) []string {
+	has := make(map[string]bool, len(granted))
+	for _, scope := range granted {
+		has[scope] = true
+	}
+
+	var missing []string
+	for _, scope := range required {
+		if !has[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// newOAuthConfig builds the OAuth2 configuration for the authorization code flow.
+// With PKCE the client is public: no secret is sent and the client ID travels in the request body.
+func newOAuthConfig(clientID, clientSecret, flow string, endpoints config.Endpoints, redirectURI string, scopes []string) *oauth2.Config {
+	auth := &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURI,
+		Scopes:       scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  endpoints.AuthURL(),
+			TokenURL: endpoints.TokenURL(),
+		},
+	}
+
+	if flow == config.AuthFlowPKCE {
+		auth.ClientSecret = ""
+		auth.Endpoint.AuthStyle = oauth2.AuthStyleInParams
+	}
+	return auth
+}
+
+// newCodeVerifier generates a random PKCE code verifier (RFC 7636 section 4.1)
+func newCodeVerifier() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// codeChallenge derives the S256 code challenge for a verifier
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// codeChallengeOptions adds the PKCE code challenge to the authorization URL
+func codeChallengeOptions(verifier string) []oauth2.AuthCodeOption {
+	return []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+		oauth2.SetAuthURLParam("code_challenge", codeChallenge(verifier)),
+	}
+}
+
+// codeVerifierOptions adds the PKCE code verifier to the token exchange
+func codeVerifierOptions(verifier string) []oauth2.AuthCodeOption {
+	return []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("code_verifier", verifier),
+	}
+}
+
+// persistingTokenSource refreshes the token when it expires and saves every
+// refresh, so refreshed access tokens survive a restart. Refreshes hold the
+// token file lock, so concurrent gspotty processes take turns and reuse each
+// other's refreshed tokens instead of overwriting them.
+type persistingTokenSource struct {
+	mu    sync.Mutex
+	ctx   context.Context
+	auth  *oauth2.Config
+	store tokenstore.Store
+	last  *oauth2.Token
+}
+
+// Token returns a valid token, refreshing and saving it when needed
+func (s *persistingTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.last.Valid() {
+		return s.last, nil
+	}
+	return s.refreshLocked(false)
+}
+
+// refreshLocked refreshes the token under the store's lock. Unless forced, a
+// valid token saved by another process in the meantime is used instead.
+func (s *persistingTokenSource) refreshLocked(force bool) (*oauth2.Token, error) {
+	unlock, err := s.store.Lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// Another process may have refreshed, and been given a new refresh token
+	refreshToken := s.last.RefreshToken
+	if stored, err := loadToken(s.store); err == nil {
+		if !force && stored.oauthToken().Valid() {
+			s.last = stored.oauthToken()
+			return s.last, nil
+		}
+		refreshToken = stored.RefreshToken
+	}
+
+	token, err := s.auth.TokenSource(s.ctx, &oauth2.Token{RefreshToken: refreshToken}).Token()
+	if err != nil {
+		return nil, err
+	}
+
+	// A refresh response may leave out the scopes, which are then unchanged
+	if tokenScope(token) == "" {
+		token = token.WithExtra(map[string]interface{}{"scope": tokenScope(s.last)})
+	}
+	if err := writeToken(s.store, token); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to save refreshed token: %v\n", err)
+	}
+	s.last = token
+	return token, nil
+}
+
+// withTransport makes the OAuth2 clients built from ctx send their requests,
+// token refreshes included, through the retrying transport, answering catalog
+// lookups from the account's responses in the cache unless it is disabled
+func withTransport(ctx context.Context, accountName string) context.Context {
+	var base http.RoundTripper
+	if client, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok {
+		base = client.Transport
+	}
+	var transport http.RoundTripper = retry.New(base)
+	if !config.Active().NoCache {
+		if dir, err := config.ResponseCacheDir(); err == nil {
+			cache := httpcache.New(dir, transport)
+			cache.Account = accountName
+			// Catalog endpoints are found below the API base URL, wherever it is served
+			if apiURL, err := url.Parse(config.LoadEndpoints().APIURL); err == nil {
+				cache.APIPath = apiURL.Path
+			}
+			transport = cache
+		}
+	}
+	return context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: transport})
+}
+
+// newTokenClient returns an HTTP client that authorizes requests with the
+// token, refreshing it through auth and saving each refresh to the store
+func newTokenClient(ctx context.Context, accountName string, auth *oauth2.Config, store tokenstore.Store, token *oauth2.Token) *http.Client {
+	ctx = withTransport(ctx, accountName)
+	return oauth2.NewClient(ctx, &persistingTokenSource{
+		ctx:   ctx,
+		auth:  auth,
+		store: store,
+		last:  token,
+	})
+}
+
+// authSession holds everything needed to log in as an account and use its token
+type authSession struct {
+	opts      AuthOptions
+	flow      string
+	auth      *oauth2.Config
+	callback  config.Callback
+	endpoints config.Endpoints
+	store     tokenstore.Store
+}
+
+// newAuthSession checks the credentials and loads the settings for an account
+func newAuthSession(opts AuthOptions) (*authSession, error) {
+	flow, err := config.LoadAuthFlow()
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := opts.Credentials
+	if credentials == nil {
+		resolved, err := opts.Account.Credentials(flow)
+		if err != nil {
+			return nil, err
+		}
+		credentials = &resolved
+	}
+	clientID, clientSecret := credentials.ClientID, credentials.ClientSecret
+
+	// Check the resolved credentials, from the environment, secret files, the
+	// secret command or the setup file, cover what the flow needs
+	if flow == config.AuthFlowPKCE && clientID == "" {
+		return nil, fmt.Errorf("%w: SPOTIFY_ID must be set, or run: gspotty setup", api.ErrMissingCredentials)
+	}
+	if flow == config.AuthFlowCode && (clientID == "" || clientSecret == "") {
+		return nil, fmt.Errorf("%w: SPOTIFY_ID and SPOTIFY_SECRET must be set (or run: gspotty setup), or set SPOTIFY_AUTH_FLOW=pkce to need no secret",
+			api.ErrMissingCredentials)
+	}
+
+	callback, err := config.LoadCallback()
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := openTokenStore(opts.Account.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set up authentication with required scopes for playback control
+	endpoints := config.LoadEndpoints()
+	return &authSession{
+		opts:      opts,
+		flow:      flow,
+		auth:      newOAuthConfig(clientID, clientSecret, flow, endpoints, callback.RedirectURI, mergeScopes(PlaybackScopes, opts.Scopes)),
+		callback:  callback,
+		endpoints: endpoints,
+		store:     store,
+	}, nil
+}
+
+// login runs the interactive authorization and saves the new token
+func (s *authSession) login(ctx context.Context) (*oauth2.Token, error) {
+	// Generate a random state string for security
+	state := "gspotty-auth-" + fmt.Sprintf("%d", time.Now().UnixNano())
+
+	// Generate the auth URL, with a code challenge when using PKCE
+	var authOptions, exchangeOptions []oauth2.AuthCodeOption
+	if s.flow == config.AuthFlowPKCE {
+		verifier, err := newCodeVerifier()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate PKCE code verifier: %v", err)
+		}
+		authOptions = codeChallengeOptions(verifier)
+		exchangeOptions = codeVerifierOptions(verifier)
+	}
+	authURL := s.auth.AuthCodeURL(state, authOptions...)
+
+	var token *oauth2.Token
+	var err error
+	if s.opts.NoBrowser {
+		token, err = authorizeHeadless(ctx, s.auth, authURL, state, exchangeOptions)
+	} else {
+		token, err = authorizeWithBrowser(ctx, s.auth, s.callback, authURL, state, exchangeOptions)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(os.Stderr, "Authorization successful!")
+
+	// Spotify lists the granted scopes, but if a server leaves them out they are the requested ones
+	if tokenScope(token) == "" {
+		token = token.WithExtra(map[string]interface{}{"scope": strings.Join(s.auth.Scopes, " ")})
+	}
+
+	// Save the token for future use
+	if err := saveToken(s.store, token); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to save token: %v\n", err)
+	} else {
+		fmt.Fprintln(os.Stderr, "Token successfully saved")
+	}
+	return token, nil
+}
+
+// client returns a Spotify client that uses and maintains the token
+func (s *authSession) client(ctx context.Context, token *oauth2.Token) *spotify.Client {
+	return spotify.New(newTokenClient(ctx, s.accountName(), s.auth, s.store, token), spotify.WithBaseURL(s.endpoints.APIURL))
+}
+
+// accountName returns the display name of the session's account
+func (s *authSession) accountName() string {
+	if s.opts.Account.Name == "" {
+		return account.DefaultName
+	}
+	return s.opts.Account.Name
+}
+
+// loadToken returns the stored token, explaining how to log in when there is none
+func (s *authSession) loadToken() (TokenInfo, error) {
+	token, err := loadToken(s.store)
+	if errors.Is(err, fs.ErrNotExist) {
+		return token, fmt.Errorf("account %s is not logged in (run: gspotty auth login)", s.accountName())
+	}
+	return token, err
+}
+
+// AuthStatus describes the login of an account
+type AuthStatus struct {
+	Account     string    `json:"account"`
+	UserID      string    `json:"user_id"`
+	DisplayName string    `json:"display_name"`
+	Scopes      []string  `json:"scopes"`
+	Expiry      time.Time `json:"expiry"`
+	TokenPath   string    `json:"token_path"`
+}
+
+// Login authorizes the account again, replacing any stored token. Scopes
+// granted to the stored token are requested again so none are lost.
+func Login(ctx context.Context, opts AuthOptions) error {
+	session, err := newAuthSession(opts)
+	if err != nil {
+		return err
+	}
+	if stored, err := loadToken(session.store); err == nil {
+		session.auth.Scopes = mergeScopes(stored.grantedScopes(), session.auth.Scopes)
+	}
+	_, err = session.login(ctx)
+	return err
+}
+
+// openTokenStore opens the configured token store of an account
+func openTokenStore(accountName string) (tokenstore.Store, error) {
+	if accountName == "" {
+		accountName = account.DefaultName
+	}
+	tokenPath, err := account.TokenPath(accountName)
+	if err != nil {
+		return nil, err
+	}
+	return tokenstore.Open(config.Active(), accountName, tokenPath)
+}
+
+// DeleteToken removes an account's stored token, if it has one
+func DeleteToken(accountName string) error {
+	store, err := openTokenStore(accountName)
+	if err != nil {
+		return err
+	}
+	if err := store.Delete(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Logout forgets the account's stored token
+func Logout(opts AuthOptions) error {
+	session, err := newAuthSession(opts)
+	if err != nil {
+		return err
+	}
+
+	err = session.store.Delete()
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("account %s is not logged in", session.accountName())
+	}
+	return err
+}
+
+// Refresh exchanges the stored refresh token for a new access token and saves it
+func Refresh(ctx context.Context, opts AuthOptions) (TokenInfo, error) {
+	session, err := newAuthSession(opts)
+	if err != nil {
+		return TokenInfo{}, err
+	}
+
+	stored, err := session.loadToken()
+	if err != nil {
+		return TokenInfo{}, err
+	}
+
+	source := &persistingTokenSource{
+		ctx:   ctx,
+		auth:  session.auth,
+		store: session.store,
+		last:  stored.oauthToken(),
+	}
+	if _, err := source.refreshLocked(true); err != nil {
+		return TokenInfo{}, fmt.Errorf("%w: failed to refresh token: %v", api.ErrTokenExchange, err)
+	}
+	return loadToken(session.store)
+}
+
+// Status looks up the user behind the account's token along with its scopes and expiry
+func Status(ctx context.Context, opts AuthOptions) (AuthStatus, error) {
+	session, err := newAuthSession(opts)
+	if err != nil {
+		return AuthStatus{}, err
+	}
+
+	stored, err := session.loadToken()
+	if err != nil {
+		return AuthStatus{}, err
+	}
+
+	user, err := session.client(ctx, stored.oauthToken()).CurrentUser(ctx)
+	if err != nil {
+		return AuthStatus{}, fmt.Errorf("failed to look up the current user: %v", err)
+	}
+
+	// The lookup may have refreshed the token, so report what is stored now
+	stored, err = loadToken(session.store)
+	if err != nil {
+		return AuthStatus{}, err
+	}
+
+	return AuthStatus{
+		Account:     session.accountName(),
+		UserID:      user.ID,
+		DisplayName: user.DisplayName,
+		Scopes:      stored.grantedScopes(),
+		Expiry:      stored.Expiry,
+		TokenPath:   session.store.String(),
+	}, nil
+}
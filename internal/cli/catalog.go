@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/iamgaru/gspotty/internal/api"
+	"github.com/iamgaru/gspotty/internal/config"
+	"github.com/zmb3/spotify/v2"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// NewAppClient returns a client authorized as the app alone, with the client
+// credentials flow. It can search the catalog and look up public profiles,
+// but cannot act for a user.
+func NewAppClient(ctx context.Context, credentials config.Credentials) (*spotify.Client, error) {
+	if credentials.ClientID == "" || credentials.ClientSecret == "" {
+		return nil, fmt.Errorf("%w: SPOTIFY_ID and SPOTIFY_SECRET must be set to use Spotify without logging in",
+			api.ErrMissingCredentials)
+	}
+
+	// The app acts for no account, so its responses are cached apart from every login
+	ctx = withTransport(ctx, "")
+	endpoints := config.LoadEndpoints()
+	cc := &clientcredentials.Config{
+		ClientID:     credentials.ClientID,
+		ClientSecret: credentials.ClientSecret,
+		TokenURL:     endpoints.TokenURL(),
+	}
+
+	// Fetch the first token now so bad credentials fail here rather than on first use
+	token, err := cc.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: couldn't get token: %w", api.ErrTokenExchange, err)
+	}
+	httpClient := oauth2.NewClient(ctx, oauth2.ReuseTokenSource(token, cc.TokenSource(ctx)))
+	return spotify.New(httpClient, spotify.WithBaseURL(endpoints.APIURL)), nil
+}
+
+// GetCatalogClient returns a client for commands that only read the catalog,
+// such as search and profile lookups. It uses the account's stored login when
+// there is one, and otherwise the app's client credentials, so no interactive
+// login is needed. Player calls on an app-only client fail with api.ErrLoginRequired.
+func GetCatalogClient(ctx context.Context, opts AuthOptions) (api.Client, error) {
+	session, err := newAuthSession(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := loadToken(session.store)
+	if err == nil {
+		return session.client(ctx, token.oauthToken()), nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring stored token: %v\n", err)
+	}
+
+	// A PKCE app has no secret to authorize as itself, so it has to log in
+	if session.flow == config.AuthFlowPKCE {
+		return GetSpotifyClient(ctx, opts)
+	}
+
+	client, err := NewAppClient(ctx, config.Credentials{ClientID: session.auth.ClientID, ClientSecret: session.auth.ClientSecret})
+	if err != nil {
+		return nil, err
+	}
+	return appOnlyClient{client}, nil
+}
+
+// appOnlyClient is an app-only client whose player calls explain how to log in
+type appOnlyClient struct {
+	api.Client
+}
+
+// errLoginRequired explains that a player call needs a user login
+func errLoginRequired() error {
+	return fmt.Errorf("%w: controlling playback acts for a user, so log in first with: gspotty auth login", api.ErrLoginRequired)
+}
+
+// The player calls all need a user login
+
+func (appOnlyClient) PlayerDevices(ctx context.Context) ([]spotify.PlayerDevice, error) {
+	return nil, errLoginRequired()
+}
+
+func (appOnlyClient) PlayerState(ctx context.Context, opts ...spotify.RequestOption) (*spotify.PlayerState, error) {
+	return nil, errLoginRequired()
+}
+
+func (appOnlyClient) Play(ctx context.Context) error {
+	return errLoginRequired()
+}
+
+func (appOnlyClient) PlayOpt(ctx context.Context, opt *spotify.PlayOptions) error {
+	return errLoginRequired()
+}
+
+func (appOnlyClient) Pause(ctx context.Context) error {
+	return errLoginRequired()
+}
+
+func (appOnlyClient) PauseOpt(ctx context.Context, opt *spotify.PlayOptions) error {
+	return errLoginRequired()
+}
+
+func (appOnlyClient) Next(ctx context.Context) error {
+	return errLoginRequired()
+}
+
+func (appOnlyClient) NextOpt(ctx context.Context, opt *spotify.PlayOptions) error {
+	return errLoginRequired()
+}
+
+func (appOnlyClient) Previous(ctx context.Context) error {
+	return errLoginRequired()
+}
+
+func (appOnlyClient) PreviousOpt(ctx context.Context, opt *spotify.PlayOptions) error {
+	return errLoginRequired()
+}
+
+func (appOnlyClient) TransferPlayback(ctx context.Context, deviceID spotify.ID, play bool) error {
+	return errLoginRequired()
+}
+
+func (appOnlyClient) Seek(ctx context.Context, position int) error {
+	return errLoginRequired()
+}
+
+func (appOnlyClient) Volume(ctx context.Context, percent int) error {
+	return errLoginRequired()
+}
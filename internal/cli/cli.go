@@ -1,38 +1,81 @@
 package cli
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"io/fs"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"runtime"
 	"strings"
 	"time"
 
+	"github.com/iamgaru/gspotty/internal/account"
+	"github.com/iamgaru/gspotty/internal/api"
+	"github.com/iamgaru/gspotty/internal/config"
+	"github.com/iamgaru/gspotty/internal/device"
 	"github.com/iamgaru/gspotty/internal/menu"
+	"github.com/iamgaru/gspotty/internal/output"
 	"github.com/iamgaru/gspotty/internal/player"
+	"github.com/iamgaru/gspotty/internal/tokenstore"
 	"github.com/iamgaru/gspotty/internal/ui"
 	"github.com/zmb3/spotify/v2"
-	spotifyauth "github.com/zmb3/spotify/v2/auth"
 	"golang.org/x/oauth2"
 )
 
-// Define global variables for authentication
-const (
-	redirectURI = "http://localhost:8888/callback"
-	tokenFile   = ".spotify_token.json"
+// loginInput and loginOutput are where the headless login talks to the user
+var (
+	loginInput  io.Reader = os.Stdin
+	loginOutput io.Writer = os.Stderr
 )
 
+// openBrowser opens the authorization page; tests replace it to play the browser
+var openBrowser = openURL
+
+// authorizationTimeout is how long the browser login waits for Spotify's callback
+var authorizationTimeout = 2 * time.Minute
+
 // TokenInfo stores authentication tokens
 type TokenInfo struct {
 	AccessToken  string    `json:"access_token"`
 	RefreshToken string    `json:"refresh_token"`
 	TokenType    string    `json:"token_type"`
 	Expiry       time.Time `json:"expiry"`
+	// Scope is the space-separated list of scopes Spotify granted
+	Scope string `json:"scope,omitempty"`
+}
+
+// oauthToken converts the stored token for use with an oauth2 token source
+func (t TokenInfo) oauthToken() *oauth2.Token {
+	token := &oauth2.Token{
+		AccessToken:  t.AccessToken,
+		RefreshToken: t.RefreshToken,
+		TokenType:    t.TokenType,
+		Expiry:       t.Expiry,
+	}
+	return token.WithExtra(map[string]interface{}{"scope": t.Scope})
+}
+
+// grantedScopes returns the scopes granted to the token. Tokens saved before
+// scopes were recorded were always granted PlaybackScopes.
+func (t TokenInfo) grantedScopes() []string {
+	if t.Scope == "" {
+		return PlaybackScopes
+	}
+	return strings.Fields(t.Scope)
+}
+
+// tokenScope returns the scopes granted with a token, if the response listed them
+func tokenScope(token *oauth2.Token) string {
+	scope, _ := token.Extra("scope").(string)
+	return scope
 }
 
 // openURL attempts to open a URL in the default browser
@@ -51,177 +94,245 @@ func openURL(url string) error {
 	return err
 }
 
-// GetSpotifyClient initializes and returns a Spotify client with proper authentication for playback
-func GetSpotifyClient(ctx context.Context) *spotify.Client {
-	clientID := os.Getenv("SPOTIFY_ID")
-	clientSecret := os.Getenv("SPOTIFY_SECRET")
-
-	// Check if environment variables are set
-	if clientID == "" || clientSecret == "" {
-		log.Fatalf("Error: SPOTIFY_ID and SPOTIFY_SECRET environment variables must be set\n" +
-			"Please set them using:\n" +
-			"export SPOTIFY_ID=your_client_id\n" +
-			"export SPOTIFY_SECRET=your_client_secret")
-	}
-
-	// Set up authentication with required scopes for playback control
-	auth := spotifyauth.New(
-		spotifyauth.WithRedirectURL(redirectURI),
-		spotifyauth.WithClientID(clientID),
-		spotifyauth.WithClientSecret(clientSecret),
-		spotifyauth.WithScopes(
-			spotifyauth.ScopeUserReadPlaybackState,
-			spotifyauth.ScopeUserModifyPlaybackState,
-		),
-	)
-
-	// Try to load token from file
-	token, err := loadTokenFromFile()
-	if err != nil || token.AccessToken == "" || token.RefreshToken == "" || time.Now().After(token.Expiry) {
-		// If no valid token, we need to perform an initial authorization
-		if token.RefreshToken != "" {
-			// Try to refresh the token first if we have a refresh token
-			oauthToken := &oauth2.Token{
-				RefreshToken: token.RefreshToken,
-				TokenType:    token.TokenType,
-				Expiry:       token.Expiry,
-			}
+// AuthOptions controls how GetSpotifyClient logs in when there is no stored token
+type AuthOptions struct {
+	// NoBrowser prints the authorization URL and reads the redirected URL back
+	// from stdin instead of opening a browser and waiting on a local callback
+	NoBrowser bool
+	// Account selects the stored token and, if set, the client ID to use.
+	// The zero value is the default account.
+	Account account.Account
+	// Scopes are needed by the command on top of PlaybackScopes. A stored
+	// token that lacks any of them triggers the consent flow again.
+	Scopes []string
+	// Credentials are the account's app credentials when the caller has
+	// already resolved them. Nil resolves them from the account.
+	Credentials *config.Credentials
+}
 
-			// Create a new client with the refresh token
-			client := spotify.New(auth.Client(ctx, oauthToken))
+// GetSpotifyClient initializes and returns a Spotify client with proper authentication for playback.
+// Errors wrap one of the api package's sentinel errors when the cause is known.
+func GetSpotifyClient(ctx context.Context, opts AuthOptions) (*spotify.Client, error) {
+	session, err := newAuthSession(opts)
+	if err != nil {
+		return nil, err
+	}
 
-			// The client will automatically refresh the token when needed
-			// We can return it directly
-			return client
+	// Try to load the stored token
+	token, err := loadToken(session.store)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring stored token: %v\n", err)
+	}
+	if err == nil {
+		missing := missingScopes(token.grantedScopes(), session.auth.Scopes)
+		if len(missing) == 0 {
+			// An expired access token is refreshed on first use and the refreshed token is saved back
+			return session.client(ctx, token.oauthToken()), nil
 		}
 
+		// Ask for the combined set so the new token still covers every other command
+		fmt.Fprintf(os.Stderr, "This command needs permissions you have not granted yet: %s\n", strings.Join(missing, ", "))
+		fmt.Fprintln(os.Stderr, "Please authorize gspotty again to grant them.")
+		session.auth.Scopes = mergeScopes(token.grantedScopes(), session.auth.Scopes)
+	} else {
 		// We need to do a one-time interactive login
-		fmt.Println("You need to authorize this application to control Spotify.")
-		fmt.Println("This is a one-time process. After authorization, you won't need to do this again.")
-		// Generate a random state string for security
-		state := "gspotty-auth-" + fmt.Sprintf("%d", time.Now().UnixNano())
-
-		// Generate the auth URL
-		authURL := auth.AuthURL(state)
-
-		// Try to open the URL in the default browser
-		fmt.Println("Opening the authorization page in your default browser...")
-		openErr := openURL(authURL)
-		if openErr != nil {
-			// Fall back to displaying the URL if opening fails
-			fmt.Printf("Could not open browser automatically. Please visit this URL manually: %s\n", authURL)
-		} else {
-			fmt.Println("Browser opened. Please complete the authorization in your browser.")
-			fmt.Println("Waiting for callback from Spotify...")
-		}
+		fmt.Fprintln(os.Stderr, "You need to authorize this application to control Spotify.")
+		fmt.Fprintln(os.Stderr, "This is a one-time process. After authorization, you won't need to do this again.")
+	}
+
+	oauthToken, err := session.login(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("authorization failed: %w", err)
+	}
+	return session.client(ctx, oauthToken), nil
+}
 
-		// Set up temporary HTTP server to handle the callback
-		ch := make(chan *oauth2.Token)
-		errCh := make(chan error)
+// authorizeWithBrowser opens the authorization URL in a browser and waits for Spotify
+// to redirect back to a temporary callback server on the loopback interface.
+// Cancelling ctx stops the wait and shuts the server down.
+func authorizeWithBrowser(ctx context.Context, auth *oauth2.Config, callback config.Callback, authURL, state string, exchangeOptions []oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	// Listen before opening the browser so the redirect cannot arrive first
+	listener, err := net.Listen("tcp", callback.ListenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen for the Spotify callback on %s: %v (set %s to use another port, or run again with --no-browser)",
+			callback.ListenAddr, err, config.RedirectURIEnv)
+	}
 
-		// Create a server with timeouts to prevent hanging
-		server := &http.Server{
-			Addr:         ":8888",
-			ReadTimeout:  30 * time.Second,
-			WriteTimeout: 30 * time.Second,
+	// The first callback decides the outcome; the buffer lets the handler return without a waiting reader
+	type result struct {
+		token *oauth2.Token
+		err   error
+	}
+	results := make(chan result, 1)
+	report := func(token *oauth2.Token, err error) {
+		select {
+		case results <- result{token, err}:
+		default:
 		}
+	}
 
-		http.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
-			// Check for error parameter
-			if errParam := r.URL.Query().Get("error"); errParam != "" {
-				errCh <- fmt.Errorf("Spotify authorization error: %s", errParam)
-				fmt.Fprintf(w, "Authorization failed: %s. Please close this window and try again.", errParam)
-				return
-			}
+	mux := http.NewServeMux()
+	mux.HandleFunc(callback.Path, func(w http.ResponseWriter, r *http.Request) {
+		// Check for error parameter
+		if errParam := r.URL.Query().Get("error"); errParam != "" {
+			report(nil, fmt.Errorf("%w: Spotify returned %s", api.ErrAuthorizationDenied, errParam))
+			fmt.Fprintf(w, "Authorization failed: %s. Please close this window and try again.", errParam)
+			return
+		}
 
-			// Get state and code from the request
-			receivedState := r.URL.Query().Get("state")
-			if receivedState != state {
-				errCh <- fmt.Errorf("state mismatch: expected %s, got %s", state, receivedState)
-				http.Error(w, "State mismatch error", http.StatusBadRequest)
-				return
-			}
+		// Get state and code from the request
+		receivedState := r.URL.Query().Get("state")
+		if receivedState != state {
+			report(nil, fmt.Errorf("%w: expected %s, got %s", api.ErrStateMismatch, state, receivedState))
+			http.Error(w, "State mismatch error", http.StatusBadRequest)
+			return
+		}
 
-			// Attempt to get token
-			token, err := auth.Token(r.Context(), state, r)
-			if err != nil {
-				errCh <- fmt.Errorf("failed to get token: %v", err)
-				http.Error(w, "Failed to get token", http.StatusInternalServerError)
-				return
-			}
+		// Attempt to exchange the authorization code for a token
+		token, err := auth.Exchange(r.Context(), r.URL.Query().Get("code"), exchangeOptions...)
+		if err != nil {
+			report(nil, fmt.Errorf("%w: %v", api.ErrTokenExchange, err))
+			http.Error(w, "Failed to get token", http.StatusInternalServerError)
+			return
+		}
 
-			// Send the token to the channel
-			ch <- token
-			fmt.Fprintf(w, "Authorization successful! You can close this window and return to the application.")
-		})
+		report(token, nil)
+		fmt.Fprintf(w, "Authorization successful! You can close this window and return to the application.")
+	})
 
-		// Start the server in a goroutine
-		go func() {
-			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				errCh <- fmt.Errorf("server error: %v", err)
-			}
-		}()
+	// Create a server with timeouts to prevent hanging
+	server := &http.Server{
+		Handler:      mux,
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			report(nil, fmt.Errorf("server error: %v", err))
+		}
+	}()
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+		// Serve may not have started yet, so release the port here too
+		listener.Close()
+	}()
+
+	// Try to open the URL in the default browser
+	fmt.Fprintln(os.Stderr, "Opening the authorization page in your default browser...")
+	if err := openBrowser(authURL); err != nil {
+		// Fall back to displaying the URL if opening fails
+		fmt.Fprintf(os.Stderr, "Could not open browser automatically. Please visit this URL manually: %s\n", authURL)
+		fmt.Fprintln(os.Stderr, "On a machine without a browser, run again with --no-browser.")
+	} else {
+		fmt.Fprintln(os.Stderr, "Browser opened. Please complete the authorization in your browser.")
+		fmt.Fprintln(os.Stderr, "Waiting for callback from Spotify...")
+	}
+
+	// Wait for the token, error, cancellation or timeout
+	select {
+	case res := <-results:
+		return res.token, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(authorizationTimeout):
+		return nil, fmt.Errorf("%w waiting for the callback from Spotify; on a machine without a browser, run again with --no-browser",
+			api.ErrAuthorizationTimeout)
+	}
+}
 
-		// Set a timeout for the auth process
-		authTimeout := time.After(2 * time.Minute)
+// authorizeHeadless prints the authorization URL and reads the redirected URL,
+// or just the code, back from the user. This works over SSH and in containers
+// where no browser can be opened and the callback port is not reachable.
+func authorizeHeadless(ctx context.Context, auth *oauth2.Config, authURL, state string, exchangeOptions []oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	fmt.Fprintln(loginOutput, "Open this URL in a browser on any device and authorize gspotty:")
+	fmt.Fprintf(loginOutput, "\n  %s\n\n", authURL)
+	fmt.Fprintln(loginOutput, "Spotify then redirects to a page that will not load; that is expected.")
+	fmt.Fprint(loginOutput, "Paste the full URL from the address bar (or just the code): ")
 
-		// Wait for the token, error, or timeout
-		var token *oauth2.Token
-		select {
-		case token = <-ch:
-			fmt.Println("Authorization successful!")
-		case err := <-errCh:
-			server.Shutdown(ctx)
-			log.Fatalf("Authorization failed: %v", err)
-		case <-authTimeout:
-			server.Shutdown(ctx)
-			log.Fatalf("Authorization timed out. Please try again.")
-		}
+	line, err := bufio.NewReader(loginInput).ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+		return nil, fmt.Errorf("failed to read the authorization response: %v", err)
+	}
 
-		// Save token to file for future use
-		if err := saveTokenToFile(token); err != nil {
-			fmt.Printf("Warning: Failed to save token: %v\n", err)
-		}
+	code, err := parseAuthorizationResponse(line, state)
+	if err != nil {
+		return nil, err
+	}
 
-		// Shutdown server
-		server.Shutdown(ctx)
+	token, err := auth.Exchange(ctx, code, exchangeOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", api.ErrTokenExchange, err)
+	}
+	return token, nil
+}
 
-		return spotify.New(auth.Client(ctx, token))
+// parseAuthorizationResponse extracts the code from a pasted redirect URL, or
+// its query string, checking the state. A bare code is returned as is.
+func parseAuthorizationResponse(input, state string) (string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", fmt.Errorf("no authorization response entered")
+	}
+	if !strings.Contains(input, "=") {
+		return input, nil
 	}
 
-	// Create OAuth2 token from stored token
-	oauthToken := &oauth2.Token{
-		AccessToken:  token.AccessToken,
-		RefreshToken: token.RefreshToken,
-		TokenType:    token.TokenType,
-		Expiry:       token.Expiry,
+	query := input
+	if i := strings.Index(input, "?"); i >= 0 {
+		query = input[i+1:]
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return "", fmt.Errorf("invalid redirect URL: %v", err)
 	}
 
-	// Return client with valid token
-	return spotify.New(auth.Client(ctx, oauthToken))
+	if errParam := values.Get("error"); errParam != "" {
+		return "", fmt.Errorf("%w: Spotify returned %s", api.ErrAuthorizationDenied, errParam)
+	}
+	if receivedState := values.Get("state"); receivedState != state {
+		return "", fmt.Errorf("%w: expected %s, got %s", api.ErrStateMismatch, state, receivedState)
+	}
+	code := values.Get("code")
+	if code == "" {
+		return "", fmt.Errorf("redirect URL has no code parameter")
+	}
+	return code, nil
 }
 
-// loadTokenFromFile loads authentication token from file
-func loadTokenFromFile() (TokenInfo, error) {
+// loadToken loads the authentication token from the store, refusing tokens
+// without a refresh token
+func loadToken(store tokenstore.Store) (TokenInfo, error) {
 	var token TokenInfo
 
-	homeDir, err := os.UserHomeDir()
+	data, err := store.Load()
 	if err != nil {
 		return token, err
 	}
 
-	tokenPath := filepath.Join(homeDir, tokenFile)
-	data, err := os.ReadFile(tokenPath)
-	if err != nil {
-		return token, err
+	if err := json.Unmarshal(data, &token); err != nil {
+		return token, fmt.Errorf("token in %s is corrupt: %v", store, err)
 	}
+	if token.RefreshToken == "" {
+		return token, fmt.Errorf("token in %s has no refresh token", store)
+	}
+	return token, nil
+}
 
-	err = json.Unmarshal(data, &token)
-	return token, err
+// saveToken saves the authentication token while holding the store's lock,
+// so it cannot interleave with another process's refresh
+func saveToken(store tokenstore.Store, token *oauth2.Token) error {
+	unlock, err := store.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return writeToken(store, token)
 }
 
-// saveTokenToFile saves authentication token to file
-func saveTokenToFile(token *oauth2.Token) error {
+// writeToken writes the authentication token to the store
+func writeToken(store tokenstore.Store, token *oauth2.Token) error {
 	if token == nil {
 		return fmt.Errorf("no token to save")
 	}
@@ -231,34 +342,20 @@ func saveTokenToFile(token *oauth2.Token) error {
 		RefreshToken: token.RefreshToken,
 		TokenType:    token.TokenType,
 		Expiry:       token.Expiry,
+		Scope:        tokenScope(token),
 	}
 
 	data, err := json.Marshal(tokenInfo)
 	if err != nil {
 		return fmt.Errorf("failed to marshal token: %v", err)
 	}
-
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("failed to get home directory: %v", err)
-	}
-
-	tokenPath := filepath.Join(homeDir, tokenFile)
-
-	// Ensure the file permissions are restricted to current user only
-	err = os.WriteFile(tokenPath, data, 0600)
-	if err != nil {
-		return fmt.Errorf("failed to write token file: %v", err)
-	}
-
-	fmt.Printf("Token successfully saved to %s\n", tokenPath)
-	return nil
+	return store.Save(data)
 }
 
 // SearchTracks searches for tracks and displays the results
-func SearchTracks(ctx context.Context, client *spotify.Client, query string, artistName string, limit int, showDetails bool, keepPlaying bool, autoPlay bool) {
+func SearchTracks(ctx context.Context, client api.Client, query string, artistName string, limit int, showDetails bool, keepPlaying bool, autoPlay bool) {
 	// Search for tracks
-	results, err := client.Search(ctx, query, spotify.SearchTypeTrack, spotify.Limit(limit))
+	results, err := client.Search(ctx, trackQuery(query, artistName), spotify.SearchTypeTrack, spotify.Limit(limit))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error searching for tracks: %v\n", err)
 		return
@@ -288,6 +385,14 @@ func SearchTracks(ctx context.Context, client *spotify.Client, query string, art
 	resultsUI.DisplayTrackResults(ctx, client, results.Tracks.Tracks)
 }
 
+// trackQuery narrows a track query to the artist, if one is given
+func trackQuery(query, artist string) string {
+	if artist == "" {
+		return query
+	}
+	return fmt.Sprintf("%s artist:%s", query, artist)
+}
+
 // Helper function to join artist names for display
 func joinArtistNames(artists []spotify.SimpleArtist) string {
 	names := make([]string, len(artists))
@@ -298,7 +403,7 @@ func joinArtistNames(artists []spotify.SimpleArtist) string {
 }
 
 // SearchAlbums searches for albums and displays the results
-func SearchAlbums(ctx context.Context, client *spotify.Client, query string, limit int, showDetails bool, keepPlaying bool, autoPlay bool) {
+func SearchAlbums(ctx context.Context, client api.Client, query string, limit int, showDetails bool, keepPlaying bool, autoPlay bool) {
 	// Search for albums
 	results, err := client.Search(ctx, query, spotify.SearchTypeAlbum, spotify.Limit(limit))
 	if err != nil {
@@ -345,7 +450,7 @@ func SearchAlbums(ctx context.Context, client *spotify.Client, query string, lim
 }
 
 // SearchPlaylists searches for playlists and displays the results
-func SearchPlaylists(ctx context.Context, client *spotify.Client, query string, limit int, showDetails bool, keepPlaying bool, autoPlay bool) {
+func SearchPlaylists(ctx context.Context, client api.Client, query string, limit int, showDetails bool, keepPlaying bool, autoPlay bool) {
 	// Search for playlists
 	results, err := client.Search(ctx, query, spotify.SearchTypePlaylist, spotify.Limit(limit))
 	if err != nil {
@@ -364,14 +469,14 @@ func SearchPlaylists(ctx context.Context, client *spotify.Client, query string,
 		fmt.Printf("Auto-playing the first track from playlist: %s\n", results.Playlists.Playlists[0].Name)
 
 		// Get the tracks from the first playlist
-		tracks, err := client.GetPlaylistTracks(ctx, results.Playlists.Playlists[0].ID, spotify.Limit(1))
+		tracks, err := client.GetPlaylistItems(ctx, results.Playlists.Playlists[0].ID, spotify.Limit(1))
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error getting playlist tracks: %v\n", err)
 			return
 		}
 
-		if len(tracks.Tracks) > 0 {
-			playerUI := player.NewPlayerUI(ctx, client, tracks.Tracks[0].Track, keepPlaying, autoPlay)
+		if len(tracks.Items) > 0 && tracks.Items[0].Track.Track != nil {
+			playerUI := player.NewPlayerUI(ctx, client, *tracks.Items[0].Track.Track, keepPlaying, autoPlay)
 			playerUI.Play()
 		}
 		return
@@ -383,16 +488,49 @@ func SearchPlaylists(ctx context.Context, client *spotify.Client, query string,
 	resultsUI.DisplayPlaylistResults(ctx, client, results.Playlists.Playlists)
 }
 
-// SearchTracksWithMenu searches for tracks and displays the results with a menu interface
-func SearchTracksWithMenu(ctx context.Context, client *spotify.Client, query string, artist string, limit int, showDetails bool, keepPlaying bool, autoPlay bool) {
-	// Combine query and artist if artist is provided
-	searchQuery := query
-	if artist != "" {
-		searchQuery = fmt.Sprintf("%s artist:%s", query, artist)
+// PrintSearch searches for tracks, albums or playlists and prints the results
+// to w in one of output.Formats, instead of opening the results view
+func PrintSearch(ctx context.Context, client api.Client, w io.Writer, searchType, query, artist string, limit int, format string) error {
+	switch searchType {
+	case "track":
+		results, err := client.Search(ctx, trackQuery(query, artist), spotify.SearchTypeTrack, spotify.Limit(limit))
+		if err != nil {
+			return fmt.Errorf("error searching for tracks: %w", err)
+		}
+		var tracks []spotify.FullTrack
+		if results.Tracks != nil {
+			tracks = results.Tracks.Tracks
+		}
+		return output.WriteTracks(w, format, tracks)
+	case "album":
+		results, err := client.Search(ctx, query, spotify.SearchTypeAlbum, spotify.Limit(limit))
+		if err != nil {
+			return fmt.Errorf("error searching for albums: %w", err)
+		}
+		var albums []spotify.SimpleAlbum
+		if results.Albums != nil {
+			albums = results.Albums.Albums
+		}
+		return output.WriteAlbums(w, format, albums)
+	case "playlist":
+		results, err := client.Search(ctx, query, spotify.SearchTypePlaylist, spotify.Limit(limit))
+		if err != nil {
+			return fmt.Errorf("error searching for playlists: %w", err)
+		}
+		var playlists []spotify.SimplePlaylist
+		if results.Playlists != nil {
+			playlists = results.Playlists.Playlists
+		}
+		return output.WritePlaylists(w, format, playlists)
+	default:
+		return fmt.Errorf("invalid search type %q. Must be one of: %s", searchType, strings.Join(config.SearchTypes, ", "))
 	}
+}
 
+// SearchTracksWithMenu searches for tracks and displays the results with a menu interface
+func SearchTracksWithMenu(ctx context.Context, client api.Client, query string, artist string, limit int, showDetails bool, keepPlaying bool, autoPlay bool) {
 	// Search for tracks
-	results, err := client.Search(ctx, searchQuery, spotify.SearchTypeTrack, spotify.Limit(limit))
+	results, err := client.Search(ctx, trackQuery(query, artist), spotify.SearchTypeTrack, spotify.Limit(limit))
 	if err != nil {
 		fmt.Printf("Error searching for tracks: %v\n", err)
 		return
@@ -438,7 +576,7 @@ func SearchTracksWithMenu(ctx context.Context, client *spotify.Client, query str
 }
 
 // SearchAlbumsWithMenu searches for albums and displays the results with a menu interface
-func SearchAlbumsWithMenu(ctx context.Context, client *spotify.Client, query string, limit int, showDetails bool, keepPlaying bool, autoPlay bool) {
+func SearchAlbumsWithMenu(ctx context.Context, client api.Client, query string, limit int, showDetails bool, keepPlaying bool, autoPlay bool) {
 	// Search for albums
 	results, err := client.Search(ctx, query, spotify.SearchTypeAlbum, spotify.Limit(limit))
 	if err != nil {
@@ -502,7 +640,7 @@ func SearchAlbumsWithMenu(ctx context.Context, client *spotify.Client, query str
 }
 
 // SearchPlaylistsWithMenu searches for playlists and displays the results with a menu interface
-func SearchPlaylistsWithMenu(ctx context.Context, client *spotify.Client, query string, limit int, showDetails bool, keepPlaying bool, autoPlay bool) {
+func SearchPlaylistsWithMenu(ctx context.Context, client api.Client, query string, limit int, showDetails bool, keepPlaying bool, autoPlay bool) {
 	// Search for playlists
 	results, err := client.Search(ctx, query, spotify.SearchTypePlaylist, spotify.Limit(limit))
 	if err != nil {
@@ -570,43 +708,22 @@ func SearchPlaylistsWithMenu(ctx context.Context, client *spotify.Client, query
 	resultsUI.DisplayPlaylistResults(ctx, client, results.Playlists.Playlists)
 }
 
-// StopCurrentlyPlaying stops the currently playing track
-func StopCurrentlyPlaying(ctx context.Context, client *spotify.Client) {
-	// Get available devices first
-	devices, err := client.PlayerDevices(ctx)
+// StopCurrentlyPlaying stops the currently playing track on the device named
+// by nameOrID, or on the active device when it is empty
+func StopCurrentlyPlaying(ctx context.Context, client api.Client, nameOrID string) error {
+	target, err := device.Select(ctx, client, nameOrID)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error getting devices: %v\n", err)
-		return
-	}
-
-	// Check if there are any active devices
-	if len(devices) == 0 {
-		fmt.Println("No active Spotify devices found. Please open Spotify on any device first.")
-		return
-	}
-
-	// Find an active device to use
-	var deviceID spotify.ID
-	for _, device := range devices {
-		if device.Active {
-			deviceID = device.ID
-			break
-		}
-	}
-
-	// If no active device found, use the first available one
-	if deviceID == "" && len(devices) > 0 {
-		deviceID = devices[0].ID
+		return err
 	}
 
 	// Pause playback on the device
 	err = client.PauseOpt(ctx, &spotify.PlayOptions{
-		DeviceID: &deviceID,
+		DeviceID: &target.ID,
 	})
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error stopping playback: %v\n", err)
-		return
+		return fmt.Errorf("error stopping playback: %w", err)
 	}
 
 	fmt.Println("Playback stopped successfully.")
+	return nil
 }
@@ -1,14 +1,33 @@
 package cli
 
 import (
+	"bufio"
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/iamgaru/gspotty/internal/account"
+	"github.com/iamgaru/gspotty/internal/api"
+	"github.com/iamgaru/gspotty/internal/config"
+	"github.com/iamgaru/gspotty/internal/fakespotify"
 	"github.com/iamgaru/gspotty/internal/testutils"
+	"github.com/iamgaru/gspotty/internal/tokenstore"
 	"github.com/iamgaru/gspotty/internal/utils"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/zmb3/spotify/v2"
+	"golang.org/x/oauth2"
 )
 
 // TestEnvironmentVariables tests the environment variable checking
@@ -108,3 +127,702 @@ func TestCLIWithMockContext(t *testing.T) {
 	assert.NotNil(t, client)
 	assert.NotNil(t, ctx)
 }
+
+// newFakeServer creates a fake Spotify server with a small catalog and one device
+func newFakeServer(t *testing.T) *fakespotify.Server {
+	server := fakespotify.NewServer()
+	t.Cleanup(server.Close)
+
+	artist := []spotify.SimpleArtist{{Name: "Queen"}}
+	server.AddAlbum(spotify.SimpleAlbum{ID: "album1", Name: "A Night at the Opera", Artists: artist},
+		spotify.FullTrack{SimpleTrack: spotify.SimpleTrack{ID: "track1", Name: "Bohemian Rhapsody", Artists: artist, Duration: 354000}},
+		spotify.FullTrack{SimpleTrack: spotify.SimpleTrack{ID: "track2", Name: "Love of My Life", Artists: artist, Duration: 219000}},
+	)
+	server.AddPlaylist(spotify.SimplePlaylist{ID: "playlist1", Name: "Queen Classics"},
+		spotify.FullTrack{SimpleTrack: spotify.SimpleTrack{ID: "track3", Name: "Don't Stop Me Now", Artists: artist, Duration: 209000}},
+	)
+	server.AddDevice(spotify.PlayerDevice{ID: "device1", Name: "Laptop", Type: "Computer"})
+	return server
+}
+
+// TestSearchAgainstFakeServer tests the auto-play search paths against realistic HTTP responses
+func TestSearchAgainstFakeServer(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Track Search Auto-Play", func(t *testing.T) {
+		server := newFakeServer(t)
+		SearchTracks(ctx, server.Client(), "bohemian", "", 5, false, true, true)
+
+		playback := server.Playback()
+		assert.True(t, playback.Playing)
+		assert.Equal(t, spotify.ID("device1"), playback.DeviceID)
+		assert.Equal(t, spotify.URI("spotify:track:track1"), playback.CurrentURI())
+	})
+
+	t.Run("Album Search Auto-Play", func(t *testing.T) {
+		server := newFakeServer(t)
+		SearchAlbums(ctx, server.Client(), "opera", 5, false, true, true)
+
+		assert.Equal(t, spotify.URI("spotify:track:track1"), server.Playback().CurrentURI())
+		assert.Contains(t, server.Requests(), "GET /v1/albums/album1/tracks")
+	})
+
+	t.Run("Playlist Search Auto-Play", func(t *testing.T) {
+		server := newFakeServer(t)
+		SearchPlaylists(ctx, server.Client(), "classics", 5, false, true, true)
+
+		assert.Equal(t, spotify.URI("spotify:track:track3"), server.Playback().CurrentURI())
+	})
+
+	t.Run("Track Search Artist Filter", func(t *testing.T) {
+		server := newFakeServer(t)
+		SearchTracks(ctx, server.Client(), "life", "queen", 5, false, true, true)
+
+		assert.Equal(t, []string{"life artist:queen"}, server.Searches())
+		assert.Equal(t, spotify.URI("spotify:track:track2"), server.Playback().CurrentURI())
+	})
+
+	t.Run("Track Search With Menu Artist Filter", func(t *testing.T) {
+		server := newFakeServer(t)
+		SearchTracksWithMenu(ctx, server.Client(), "life", "queen", 5, false, true, true)
+
+		assert.Equal(t, spotify.URI("spotify:track:track2"), server.Playback().CurrentURI())
+	})
+
+	t.Run("Search Error", func(t *testing.T) {
+		server := newFakeServer(t)
+		server.FailNext(http.MethodGet, "/v1/search", http.StatusUnauthorized, "The access token expired")
+		SearchTracks(ctx, server.Client(), "bohemian", "", 5, false, true, true)
+
+		assert.False(t, server.Playback().Playing)
+		assert.NotContains(t, server.Requests(), "PUT /v1/me/player/play")
+	})
+
+	t.Run("Playback Error", func(t *testing.T) {
+		server := newFakeServer(t)
+		server.FailNext(http.MethodPut, "/v1/me/player/play", http.StatusForbidden, "Player command failed: Premium required")
+		SearchTracks(ctx, server.Client(), "bohemian", "", 5, false, true, true)
+
+		assert.False(t, server.Playback().Playing)
+	})
+}
+
+// TestPrintSearch tests printing search results against the fake server
+func TestPrintSearch(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeServer(t).Client()
+
+	var out strings.Builder
+	require.NoError(t, PrintSearch(ctx, client, &out, "track", "love", "queen", 5, "tsv"))
+	assert.Equal(t, ""+
+		"id\turi\tname\tartists\talbum\tduration_ms\tpopularity\n"+
+		"track2\tspotify:track:track2\tLove of My Life\tQueen\tA Night at the Opera\t219000\t0\n",
+		out.String())
+
+	out.Reset()
+	require.NoError(t, PrintSearch(ctx, client, &out, "playlist", "queen", "", 5, "csv"))
+	assert.Equal(t, "id,uri,name,owner,total_tracks\nplaylist1,spotify:playlist:playlist1,Queen Classics,,1\n", out.String())
+
+	out.Reset()
+	require.NoError(t, PrintSearch(ctx, client, &out, "track", "love", "bowie", 5, "json"))
+	assert.Equal(t, "[]\n", out.String())
+
+	assert.Error(t, PrintSearch(ctx, client, &out, "artist", "queen", "", 5, "json"))
+}
+
+// TestStopCurrentlyPlaying tests pausing playback against the fake server
+func TestStopCurrentlyPlaying(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeServer(t)
+	client := server.Client()
+
+	deviceID := spotify.ID("device1")
+	err := client.PlayOpt(ctx, &spotify.PlayOptions{DeviceID: &deviceID, URIs: []spotify.URI{"spotify:track:track1"}})
+	assert.NoError(t, err)
+	assert.True(t, server.Playback().Playing)
+
+	assert.NoError(t, StopCurrentlyPlaying(ctx, client, ""))
+	assert.False(t, server.Playback().Playing)
+	assert.Contains(t, server.Requests(), "PUT /v1/me/player/pause")
+
+	t.Run("No Devices", func(t *testing.T) {
+		empty := fakespotify.NewServer()
+		defer empty.Close()
+
+		err := StopCurrentlyPlaying(ctx, empty.Client(), "")
+		assert.True(t, errors.Is(err, api.ErrNoDevice))
+		assert.NotContains(t, empty.Requests(), "PUT /v1/me/player/pause")
+	})
+
+	t.Run("Unknown Device", func(t *testing.T) {
+		err := StopCurrentlyPlaying(ctx, client, "Toaster")
+		assert.True(t, errors.Is(err, api.ErrNoDevice))
+	})
+}
+
+// TestGetSpotifyClientEndpoints tests that a stored token is refreshed and used against overridden endpoints
+func TestGetSpotifyClientEndpoints(t *testing.T) {
+	server := newFakeServer(t)
+	server.SetClientCredentials("test_id", "test_secret")
+	server.AddRefreshToken("stored-refresh-token")
+
+	t.Setenv("HOME", t.TempDir())
+	tokenPath, err := account.TokenPath(account.DefaultName)
+	require.NoError(t, err)
+	t.Setenv("SPOTIFY_ID", "test_id")
+	t.Setenv("SPOTIFY_SECRET", "test_secret")
+	t.Setenv(config.APIURLEnv, server.APIURL())
+	t.Setenv(config.AccountsURLEnv, server.AccountsURL())
+
+	// An expired token forces a refresh through the accounts endpoint
+	err = saveToken(tokenstore.NewFile(tokenPath), &oauth2.Token{
+		AccessToken:  "expired-access-token",
+		RefreshToken: "stored-refresh-token",
+		TokenType:    "Bearer",
+		Expiry:       time.Now().Add(-time.Hour),
+	})
+	assert.NoError(t, err)
+
+	client, err := GetSpotifyClient(context.Background(), AuthOptions{})
+	require.NoError(t, err)
+	results, err := client.Search(context.Background(), "bohemian", spotify.SearchTypeTrack)
+	assert.NoError(t, err)
+	assert.Len(t, results.Tracks.Tracks, 1)
+	assert.Equal(t, []string{"POST /api/token", "GET /v1/search"}, server.Requests())
+
+	// The refreshed token was written back and is reused without another refresh
+	stored, err := loadToken(tokenstore.NewFile(tokenPath))
+	require.NoError(t, err)
+	assert.Equal(t, "fake-access-token-1", stored.AccessToken)
+	assert.Equal(t, "stored-refresh-token", stored.RefreshToken)
+	assert.True(t, stored.Expiry.After(time.Now()))
+
+	client, err = GetSpotifyClient(context.Background(), AuthOptions{})
+	require.NoError(t, err)
+	_, err = client.Search(context.Background(), "bohemian", spotify.SearchTypeTrack)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"POST /api/token", "GET /v1/search", "GET /v1/search"}, server.Requests())
+}
+
+// TestTokenFile tests saving and validating the stored token
+func TestTokenFile(t *testing.T) {
+	home := t.TempDir()
+	tokenPath := filepath.Join(home, "token.json")
+
+	t.Run("Missing", func(t *testing.T) {
+		_, err := loadToken(tokenstore.NewFile(tokenPath))
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+	})
+
+	t.Run("Round Trip", func(t *testing.T) {
+		expiry := time.Now().Add(time.Hour).Round(time.Second)
+		require.NoError(t, saveToken(tokenstore.NewFile(tokenPath), &oauth2.Token{AccessToken: "access", RefreshToken: "refresh", Expiry: expiry}))
+
+		info, err := os.Stat(tokenPath)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+		token, err := loadToken(tokenstore.NewFile(tokenPath))
+		require.NoError(t, err)
+		assert.Equal(t, "access", token.AccessToken)
+		assert.True(t, expiry.Equal(token.Expiry))
+
+		// No temporary files are left behind
+		entries, err := os.ReadDir(home)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("Insecure Permissions", func(t *testing.T) {
+		require.NoError(t, os.Chmod(tokenPath, 0644))
+		_, err := loadToken(tokenstore.NewFile(tokenPath))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "permissions")
+	})
+
+	t.Run("Corrupt Contents", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(tokenPath, []byte("{not json"), 0600))
+		require.NoError(t, os.Chmod(tokenPath, 0600))
+		_, err := loadToken(tokenstore.NewFile(tokenPath))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "corrupt")
+
+		require.NoError(t, os.WriteFile(tokenPath, []byte(`{"access_token":"access"}`), 0600))
+		_, err = loadToken(tokenstore.NewFile(tokenPath))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no refresh token")
+	})
+}
+
+// TestCodeChallenge tests PKCE verifier and challenge generation
+func TestCodeChallenge(t *testing.T) {
+	verifier, err := newCodeVerifier()
+	require.NoError(t, err)
+	other, err := newCodeVerifier()
+	require.NoError(t, err)
+
+	// 32 random bytes encode to the 43 character minimum allowed by RFC 7636
+	assert.Len(t, verifier, 43)
+	assert.NotEqual(t, verifier, other)
+
+	challenge := codeChallenge(verifier)
+	assert.Len(t, challenge, 43)
+	assert.NotContains(t, challenge, "=")
+	assert.Equal(t, challenge, codeChallenge(verifier))
+	assert.NotEqual(t, challenge, codeChallenge(other))
+}
+
+// TestPKCEAuthorization tests the PKCE code exchange and refresh without a client secret
+func TestPKCEAuthorization(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeServer(t)
+	server.SetClientCredentials("test_id", "test_secret")
+
+	endpoints := config.Endpoints{APIURL: server.APIURL(), AccountsURL: server.AccountsURL()}
+	auth := newOAuthConfig("test_id", "test_secret", config.AuthFlowPKCE, endpoints, config.DefaultRedirectURI, PlaybackScopes)
+	assert.Empty(t, auth.ClientSecret)
+
+	// authorize follows the authorization URL like a browser and returns the code from the callback
+	authorize := func(verifier string) string {
+		httpClient := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+		resp, err := httpClient.Get(auth.AuthCodeURL("test-state", codeChallengeOptions(verifier)...))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusFound, resp.StatusCode)
+
+		callback, err := url.Parse(resp.Header.Get("Location"))
+		require.NoError(t, err)
+		assert.Equal(t, "test-state", callback.Query().Get("state"))
+		return callback.Query().Get("code")
+	}
+
+	verifier, err := newCodeVerifier()
+	require.NoError(t, err)
+
+	t.Run("Wrong Verifier", func(t *testing.T) {
+		code := authorize(verifier)
+		_, err := auth.Exchange(ctx, code, codeVerifierOptions("wrong-verifier")...)
+		assert.Error(t, err)
+	})
+
+	t.Run("Exchange And Refresh", func(t *testing.T) {
+		code := authorize(verifier)
+		token, err := auth.Exchange(ctx, code, codeVerifierOptions(verifier)...)
+		require.NoError(t, err)
+		assert.NotEmpty(t, token.RefreshToken)
+
+		token.Expiry = time.Now().Add(-time.Hour)
+		refreshed, err := auth.TokenSource(ctx, token).Token()
+		require.NoError(t, err)
+		assert.NotEqual(t, token.AccessToken, refreshed.AccessToken)
+	})
+}
+
+// TestParseAuthorizationResponse tests reading the pasted redirect URL or code
+func TestParseAuthorizationResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"Full URL", "http://localhost:8888/callback?code=abc123&state=xyz\n", "abc123", false},
+		{"Query String", "code=abc123&state=xyz", "abc123", false},
+		{"Bare Code", "  abc123  ", "abc123", false},
+		{"State Mismatch", "http://localhost:8888/callback?code=abc123&state=other", "", true},
+		{"Access Denied", "http://localhost:8888/callback?error=access_denied&state=xyz", "", true},
+		{"Missing Code", "http://localhost:8888/callback?state=xyz", "", true},
+		{"Empty", "\n", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := parseAuthorizationResponse(tt.input, "xyz")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, code)
+		})
+	}
+}
+
+// TestHeadlessLogin tests the --no-browser login against the fake accounts service
+func TestHeadlessLogin(t *testing.T) {
+	server := newFakeServer(t)
+	server.SetClientCredentials("test_id", "test_secret")
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SPOTIFY_ID", "test_id")
+	t.Setenv("SPOTIFY_SECRET", "")
+	t.Setenv(config.AuthFlowEnv, config.AuthFlowPKCE)
+	t.Setenv(config.APIURLEnv, server.APIURL())
+	t.Setenv(config.AccountsURLEnv, server.AccountsURL())
+
+	inputReader, inputWriter := io.Pipe()
+	outputReader, outputWriter := io.Pipe()
+	originalInput, originalOutput := loginInput, loginOutput
+	loginInput, loginOutput = inputReader, outputWriter
+	defer func() {
+		loginInput, loginOutput = originalInput, originalOutput
+		outputWriter.Close()
+	}()
+
+	// Play the user: read the printed URL, authorize in a "browser" and paste the redirect back
+	go func() {
+		scanner := bufio.NewScanner(outputReader)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if !strings.HasPrefix(line, "http") {
+				continue
+			}
+			browser := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			}}
+			resp, err := browser.Get(line)
+			if err != nil {
+				inputWriter.CloseWithError(err)
+				continue
+			}
+			resp.Body.Close()
+			// Keep draining the output while the login reads the pasted URL
+			go fmt.Fprintln(inputWriter, resp.Header.Get("Location"))
+		}
+	}()
+
+	client, err := GetSpotifyClient(context.Background(), AuthOptions{NoBrowser: true})
+	require.NoError(t, err)
+	_, err = client.Search(context.Background(), "bohemian", spotify.SearchTypeTrack)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"GET /authorize", "POST /api/token", "GET /v1/search"}, server.Requests())
+
+	tokenPath, err := account.TokenPath(account.DefaultName)
+	require.NoError(t, err)
+	stored, err := loadToken(tokenstore.NewFile(tokenPath))
+	require.NoError(t, err)
+	assert.NotEmpty(t, stored.RefreshToken)
+}
+
+// TestBrowserLogin tests the callback server login, including cancellation and a restart in the same process
+func TestBrowserLogin(t *testing.T) {
+	server := newFakeServer(t)
+	server.SetClientCredentials("test_id", "test_secret")
+
+	// Find a free loopback port for the callback server
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	redirectURI := "http://" + listener.Addr().String() + "/callback"
+	listener.Close()
+
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SPOTIFY_ID", "test_id")
+	t.Setenv("SPOTIFY_SECRET", "test_secret")
+	t.Setenv(config.RedirectURIEnv, redirectURI)
+	t.Setenv(config.APIURLEnv, server.APIURL())
+	t.Setenv(config.AccountsURLEnv, server.AccountsURL())
+
+	originalOpenBrowser := openBrowser
+	defer func() { openBrowser = originalOpenBrowser }()
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		openBrowser = func(string) error {
+			cancel()
+			return nil
+		}
+
+		callback, err := config.LoadCallback()
+		require.NoError(t, err)
+		endpoints := config.LoadEndpoints()
+		auth := newOAuthConfig("test_id", "test_secret", config.AuthFlowCode, endpoints, callback.RedirectURI, PlaybackScopes)
+		_, err = authorizeWithBrowser(ctx, auth, callback, auth.AuthCodeURL("state"), "state", nil)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("Authorized", func(t *testing.T) {
+		// The browser follows the redirect from the authorize endpoint to the callback server
+		openBrowser = func(authURL string) error {
+			go func() {
+				resp, err := http.Get(authURL)
+				if err == nil {
+					resp.Body.Close()
+				}
+			}()
+			return nil
+		}
+
+		client, err := GetSpotifyClient(context.Background(), AuthOptions{})
+		require.NoError(t, err)
+		_, err = client.Search(context.Background(), "bohemian", spotify.SearchTypeTrack)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"GET /authorize", "POST /api/token", "GET /v1/search"}, server.Requests())
+	})
+}
+
+// TestNamedAccount tests that a named account uses its own token file and client ID
+func TestNamedAccount(t *testing.T) {
+	server := newFakeServer(t)
+	server.SetClientCredentials("work_id", "")
+	server.AddRefreshToken("work-refresh-token")
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SPOTIFY_ID", "test_id")
+	t.Setenv("SPOTIFY_SECRET", "test_secret")
+	t.Setenv(config.APIURLEnv, server.APIURL())
+	t.Setenv(config.AccountsURLEnv, server.AccountsURL())
+
+	workTokenPath, err := account.TokenPath("work")
+	require.NoError(t, err)
+	require.NoError(t, saveToken(tokenstore.NewFile(workTokenPath), &oauth2.Token{RefreshToken: "work-refresh-token"}))
+
+	// The token endpoint only accepts the work client ID, so this fails unless the account's ID is used
+	work := account.Account{Name: "work", ClientID: "work_id"}
+	client, err := GetSpotifyClient(context.Background(), AuthOptions{Account: work})
+	require.NoError(t, err)
+	_, err = client.Search(context.Background(), "bohemian", spotify.SearchTypeTrack)
+	assert.NoError(t, err)
+
+	stored, err := loadToken(tokenstore.NewFile(workTokenPath))
+	require.NoError(t, err)
+	assert.Equal(t, "fake-access-token-1", stored.AccessToken)
+
+	// The default account's token file is untouched
+	defaultTokenPath, err := account.TokenPath(account.DefaultName)
+	require.NoError(t, err)
+	_, err = os.Stat(defaultTokenPath)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+// TestScopes tests merging and comparing scope lists
+func TestScopes(t *testing.T) {
+	merged := mergeScopes([]string{"a", "b"}, []string{"b", "c", ""})
+	assert.Equal(t, []string{"a", "b", "c"}, merged)
+	assert.Equal(t, []string{"c"}, missingScopes([]string{"a", "b"}, merged))
+	assert.Empty(t, missingScopes(merged, []string{"c", "a"}))
+
+	// Tokens saved before scopes were recorded hold the playback scopes
+	assert.Equal(t, PlaybackScopes, TokenInfo{}.grantedScopes())
+}
+
+// TestScopeReconsent tests that a stored token lacking a required scope triggers consent for the combined set
+func TestScopeReconsent(t *testing.T) {
+	server := newFakeServer(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	redirectURI := "http://" + listener.Addr().String() + "/callback"
+	listener.Close()
+
+	t.Setenv("HOME", t.TempDir())
+	tokenPath, err := account.TokenPath(account.DefaultName)
+	require.NoError(t, err)
+	t.Setenv("SPOTIFY_ID", "test_id")
+	t.Setenv("SPOTIFY_SECRET", "test_secret")
+	t.Setenv(config.RedirectURIEnv, redirectURI)
+	t.Setenv(config.APIURLEnv, server.APIURL())
+	t.Setenv(config.AccountsURLEnv, server.AccountsURL())
+
+	granted := "user-read-playback-state user-modify-playback-state user-library-read"
+	require.NoError(t, saveToken(tokenstore.NewFile(tokenPath), (&oauth2.Token{
+		AccessToken:  "stored-access-token",
+		RefreshToken: "stored-refresh-token",
+		Expiry:       time.Now().Add(time.Hour),
+	}).WithExtra(map[string]interface{}{"scope": granted})))
+
+	var requestedScopes []string
+	originalOpenBrowser := openBrowser
+	defer func() { openBrowser = originalOpenBrowser }()
+	openBrowser = func(authURL string) error {
+		parsed, err := url.Parse(authURL)
+		if err != nil {
+			return err
+		}
+		requestedScopes = strings.Fields(parsed.Query().Get("scope"))
+		go func() {
+			resp, err := http.Get(authURL)
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+		return nil
+	}
+
+	t.Run("Granted", func(t *testing.T) {
+		_, err := GetSpotifyClient(context.Background(), AuthOptions{Scopes: []string{"user-library-read"}})
+		require.NoError(t, err)
+		assert.Nil(t, requestedScopes)
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		_, err := GetSpotifyClient(context.Background(), AuthOptions{Scopes: []string{"playlist-read-private"}})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{
+			"user-read-playback-state", "user-modify-playback-state", "user-library-read", "playlist-read-private",
+		}, requestedScopes)
+
+		stored, err := loadToken(tokenstore.NewFile(tokenPath))
+		require.NoError(t, err)
+		assert.ElementsMatch(t, requestedScopes, stored.grantedScopes())
+	})
+}
+
+// TestAuthorizationErrors tests that each login failure is reported as its typed error
+func TestAuthorizationErrors(t *testing.T) {
+	server := newFakeServer(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	redirectURI := "http://" + listener.Addr().String() + "/callback"
+	listener.Close()
+
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SPOTIFY_ID", "test_id")
+	t.Setenv("SPOTIFY_SECRET", "test_secret")
+	t.Setenv(config.RedirectURIEnv, redirectURI)
+	t.Setenv(config.APIURLEnv, server.APIURL())
+	t.Setenv(config.AccountsURLEnv, server.AccountsURL())
+
+	originalOpenBrowser, originalTimeout := openBrowser, authorizationTimeout
+	defer func() { openBrowser, authorizationTimeout = originalOpenBrowser, originalTimeout }()
+
+	// respond plays a browser that lands on the callback with the given query instead of asking Spotify
+	respond := func(query func(state string) string) func(string) error {
+		return func(authURL string) error {
+			parsed, err := url.Parse(authURL)
+			if err != nil {
+				return err
+			}
+			go func() {
+				resp, err := http.Get(redirectURI + "?" + query(parsed.Query().Get("state")))
+				if err == nil {
+					resp.Body.Close()
+				}
+			}()
+			return nil
+		}
+	}
+
+	tests := []struct {
+		name    string
+		browser func(string) error
+		target  error
+	}{
+		{"Denied", respond(func(state string) string { return "error=access_denied&state=" + state }), api.ErrAuthorizationDenied},
+		{"State Mismatch", respond(func(string) string { return "code=abc&state=forged" }), api.ErrStateMismatch},
+		{"Token Exchange", respond(func(state string) string { return "code=unknown&state=" + state }), api.ErrTokenExchange},
+		{"Timeout", func(string) error { return nil }, api.ErrAuthorizationTimeout},
+	}
+
+	authorizationTimeout = 200 * time.Millisecond
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openBrowser = tt.browser
+			_, err := GetSpotifyClient(context.Background(), AuthOptions{})
+			assert.ErrorIs(t, err, tt.target)
+		})
+	}
+
+	t.Run("Missing Credentials", func(t *testing.T) {
+		t.Setenv("SPOTIFY_SECRET", "")
+		_, err := GetSpotifyClient(context.Background(), AuthOptions{})
+		assert.ErrorIs(t, err, api.ErrMissingCredentials)
+	})
+}
+
+// TestConcurrentRefresh tests that two processes sharing a token file refresh it only once
+func TestConcurrentRefresh(t *testing.T) {
+	server := newFakeServer(t)
+	server.AddRefreshToken("stored-refresh-token")
+
+	tokenPath := filepath.Join(t.TempDir(), "token.json")
+	expired := &oauth2.Token{
+		AccessToken:  "expired-access-token",
+		RefreshToken: "stored-refresh-token",
+		Expiry:       time.Now().Add(-time.Hour),
+	}
+	require.NoError(t, saveToken(tokenstore.NewFile(tokenPath), expired))
+
+	auth := &oauth2.Config{
+		ClientID:     "test_id",
+		ClientSecret: "test_secret",
+		Endpoint:     oauth2.Endpoint{TokenURL: server.AccountsURL() + "api/token"},
+	}
+
+	// Each source stands in for a separate gspotty process holding the expired token
+	tokens := make([]*oauth2.Token, 2)
+	var wg sync.WaitGroup
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			source := &persistingTokenSource{ctx: context.Background(), auth: auth, store: tokenstore.NewFile(tokenPath), last: expired}
+			token, err := source.Token()
+			if assert.NoError(t, err) {
+				tokens[i] = token
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	require.NotNil(t, tokens[0])
+	require.NotNil(t, tokens[1])
+	assert.Equal(t, tokens[0].AccessToken, tokens[1].AccessToken)
+	assert.Equal(t, []string{"POST /api/token"}, server.Requests())
+}
+
+// TestCatalogClient tests that catalog commands run on the app's credentials until the account logs in
+func TestCatalogClient(t *testing.T) {
+	server := newFakeServer(t)
+	server.SetClientCredentials("test_id", "test_secret")
+	server.AddRefreshToken("stored-refresh-token")
+
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SPOTIFY_ID", "test_id")
+	t.Setenv("SPOTIFY_SECRET", "test_secret")
+	t.Setenv(config.APIURLEnv, server.APIURL())
+	t.Setenv(config.AccountsURLEnv, server.AccountsURL())
+
+	// No browser is available, so any login attempt would fail the test
+	originalOpenBrowser := openBrowser
+	defer func() { openBrowser = originalOpenBrowser }()
+	openBrowser = func(string) error { return errors.New("unexpected login") }
+
+	client, err := GetCatalogClient(context.Background(), AuthOptions{})
+	require.NoError(t, err)
+	_, err = client.Search(context.Background(), "bohemian", spotify.SearchTypeTrack)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"POST /api/token", "GET /v1/search"}, server.Requests())
+
+	_, err = client.PlayerDevices(context.Background())
+	assert.ErrorIs(t, err, api.ErrLoginRequired)
+	assert.ErrorIs(t, client.Pause(context.Background()), api.ErrLoginRequired)
+
+	// Once the account has logged in, its token is used and can control playback
+	tokenPath, err := account.TokenPath(account.DefaultName)
+	require.NoError(t, err)
+	require.NoError(t, saveToken(tokenstore.NewFile(tokenPath), &oauth2.Token{RefreshToken: "stored-refresh-token"}))
+
+	client, err = GetCatalogClient(context.Background(), AuthOptions{})
+	require.NoError(t, err)
+	_, err = client.PlayerDevices(context.Background())
+	assert.NoError(t, err)
+
+	t.Run("Rate Limited", func(t *testing.T) {
+		server.FailNextWithHeader(http.MethodGet, "/v1/search", http.StatusTooManyRequests, "API rate limit exceeded", http.Header{"Retry-After": {"0"}})
+		_, err := client.Search(context.Background(), "bohemian", spotify.SearchTypeTrack)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Bad Credentials", func(t *testing.T) {
+		_, err := NewAppClient(context.Background(), config.Credentials{ClientID: "test_id", ClientSecret: "wrong"})
+		assert.ErrorIs(t, err, api.ErrTokenExchange)
+
+		_, err = NewAppClient(context.Background(), config.Credentials{ClientID: "test_id"})
+		assert.ErrorIs(t, err, api.ErrMissingCredentials)
+	})
+}
@@ -0,0 +1,145 @@
+// Package config provides the settings shared by every Spotify client construction path.
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	// DefaultAPIURL is the base URL of the Spotify Web API
+	DefaultAPIURL = "https://api.spotify.com/v1/"
+	// DefaultAccountsURL is the base URL of the Spotify Accounts service
+	DefaultAccountsURL = "https://accounts.spotify.com/"
+
+	// APIURLEnv overrides the Web API base URL
+	APIURLEnv = "SPOTIFY_API_URL"
+	// AccountsURLEnv overrides the Accounts service base URL
+	AccountsURLEnv = "SPOTIFY_ACCOUNTS_URL"
+
+	// AuthFlowEnv selects the flow used to authorize playback control
+	AuthFlowEnv = "SPOTIFY_AUTH_FLOW"
+	// AuthFlowCode is the authorization code flow, which needs the client secret
+	AuthFlowCode = "code"
+	// AuthFlowPKCE is the authorization code flow with PKCE, which only needs the client ID
+	AuthFlowPKCE = "pkce"
+
+	// DefaultRedirectURI is where Spotify sends the browser after authorization
+	DefaultRedirectURI = "http://localhost:8888/callback"
+	// RedirectURIEnv overrides the redirect URI, which must match one registered for the app
+	RedirectURIEnv = "SPOTIFY_REDIRECT_URI"
+)
+
+// Endpoints holds the base URLs of the Spotify services gspotty talks to.
+// Pointing them elsewhere lets gspotty run against a local stand-in server,
+// a recording proxy or a corporate egress gateway.
+type Endpoints struct {
+	APIURL      string
+	AccountsURL string
+}
+
+// LoadEndpoints returns the default endpoints with any environment overrides applied
+func LoadEndpoints() Endpoints {
+	endpoints := Endpoints{
+		APIURL:      DefaultAPIURL,
+		AccountsURL: DefaultAccountsURL,
+	}
+
+	if apiURL := os.Getenv(APIURLEnv); apiURL != "" {
+		endpoints.APIURL = apiURL
+	}
+	if accountsURL := os.Getenv(AccountsURLEnv); accountsURL != "" {
+		endpoints.AccountsURL = accountsURL
+	}
+
+	endpoints.APIURL = withTrailingSlash(endpoints.APIURL)
+	endpoints.AccountsURL = withTrailingSlash(endpoints.AccountsURL)
+	return endpoints
+}
+
+// AuthURL returns the OAuth2 authorization endpoint
+func (e Endpoints) AuthURL() string {
+	return withTrailingSlash(e.AccountsURL) + "authorize"
+}
+
+// TokenURL returns the OAuth2 token endpoint
+func (e Endpoints) TokenURL() string {
+	return withTrailingSlash(e.AccountsURL) + "api/token"
+}
+
+// LoadAuthFlow returns the configured authorization flow, defaulting to AuthFlowCode
+func LoadAuthFlow() (string, error) {
+	switch flow := strings.ToLower(os.Getenv(AuthFlowEnv)); flow {
+	case "":
+		return AuthFlowCode, nil
+	case AuthFlowCode, AuthFlowPKCE:
+		return flow, nil
+	default:
+		return "", fmt.Errorf("invalid %s %q: must be %s or %s", AuthFlowEnv, flow, AuthFlowCode, AuthFlowPKCE)
+	}
+}
+
+// Callback describes the local server that receives the authorization redirect
+type Callback struct {
+	// RedirectURI is sent to Spotify and must match the app settings exactly
+	RedirectURI string
+	// ListenAddr is the loopback address the callback server binds to
+	ListenAddr string
+	// Path is the URL path the callback is served on
+	Path string
+}
+
+// LoadCallback returns the callback settings for the configured redirect URI.
+// The redirect URI must be a plain http URI on a loopback host, because the
+// callback server only ever binds to the loopback interface.
+func LoadCallback() (Callback, error) {
+	redirectURI := DefaultRedirectURI
+	if value := os.Getenv(RedirectURIEnv); value != "" {
+		redirectURI = value
+	}
+
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return Callback{}, fmt.Errorf("invalid %s %q: %v", RedirectURIEnv, redirectURI, err)
+	}
+	if u.Scheme != "http" {
+		return Callback{}, fmt.Errorf("invalid %s %q: scheme must be http", RedirectURIEnv, redirectURI)
+	}
+
+	var host string
+	switch hostname := u.Hostname(); {
+	case hostname == "localhost":
+		host = "127.0.0.1"
+	case net.ParseIP(hostname) != nil && net.ParseIP(hostname).IsLoopback():
+		host = hostname
+	default:
+		return Callback{}, fmt.Errorf("invalid %s %q: host must be localhost or a loopback address", RedirectURIEnv, redirectURI)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "80"
+	}
+
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	return Callback{
+		RedirectURI: redirectURI,
+		ListenAddr:  net.JoinHostPort(host, port),
+		Path:        path,
+	}, nil
+}
+
+// withTrailingSlash makes sure a base URL ends in a slash so paths can be appended
+func withTrailingSlash(url string) string {
+	if strings.HasSuffix(url, "/") {
+		return url
+	}
+	return url + "/"
+}
@@ -0,0 +1,230 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLoadEndpoints tests the default endpoints and their environment overrides
+func TestLoadEndpoints(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		t.Setenv(APIURLEnv, "")
+		t.Setenv(AccountsURLEnv, "")
+
+		endpoints := LoadEndpoints()
+		assert.Equal(t, DefaultAPIURL, endpoints.APIURL)
+		assert.Equal(t, "https://accounts.spotify.com/authorize", endpoints.AuthURL())
+		assert.Equal(t, "https://accounts.spotify.com/api/token", endpoints.TokenURL())
+	})
+
+	t.Run("Overrides", func(t *testing.T) {
+		t.Setenv(APIURLEnv, "http://127.0.0.1:8080/v1")
+		t.Setenv(AccountsURLEnv, "http://127.0.0.1:8081")
+
+		endpoints := LoadEndpoints()
+		assert.Equal(t, "http://127.0.0.1:8080/v1/", endpoints.APIURL)
+		assert.Equal(t, "http://127.0.0.1:8081/authorize", endpoints.AuthURL())
+		assert.Equal(t, "http://127.0.0.1:8081/api/token", endpoints.TokenURL())
+	})
+}
+
+// TestLoadAuthFlow tests selecting the authorization flow
+func TestLoadAuthFlow(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+		wantErr  bool
+	}{
+		{"", AuthFlowCode, false},
+		{"code", AuthFlowCode, false},
+		{"PKCE", AuthFlowPKCE, false},
+		{"implicit", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv(AuthFlowEnv, tt.value)
+			flow, err := LoadAuthFlow()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, flow)
+		})
+	}
+}
+
+// TestLoadCallback tests deriving the callback server address from the redirect URI
+func TestLoadCallback(t *testing.T) {
+	tests := []struct {
+		value      string
+		listenAddr string
+		path       string
+		wantErr    bool
+	}{
+		{"", "127.0.0.1:8888", "/callback", false},
+		{"http://127.0.0.1:9999/spotify/callback", "127.0.0.1:9999", "/spotify/callback", false},
+		{"http://[::1]:9999", "[::1]:9999", "/", false},
+		{"http://localhost/callback", "127.0.0.1:80", "/callback", false},
+		{"https://localhost:8888/callback", "", "", true},
+		{"http://0.0.0.0:8888/callback", "", "", true},
+		{"http://example.com:8888/callback", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv(RedirectURIEnv, tt.value)
+			callback, err := LoadCallback()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.listenAddr, callback.ListenAddr)
+			assert.Equal(t, tt.path, callback.Path)
+			if tt.value == "" {
+				assert.Equal(t, DefaultRedirectURI, callback.RedirectURI)
+			} else {
+				assert.Equal(t, tt.value, callback.RedirectURI)
+			}
+		})
+	}
+}
+
+// TestCredentials tests that the environment overrides saved credentials field by field
+func TestCredentials(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv(ClientIDEnv, "")
+	t.Setenv(ClientSecretEnv, "")
+
+	credentials, err := LoadCredentials(AuthFlowCode)
+	require.NoError(t, err)
+	assert.Equal(t, Credentials{}, credentials)
+
+	require.NoError(t, SaveCredentials(Credentials{ClientID: "saved_id", ClientSecret: "saved_secret"}))
+
+	t.Setenv(ClientSecretEnv, "env_secret")
+	credentials, err = LoadCredentials(AuthFlowCode)
+	require.NoError(t, err)
+	assert.Equal(t, Credentials{ClientID: "saved_id", ClientSecret: "env_secret"}, credentials)
+}
+
+// TestLoadSettings tests that the environment overrides the config file, which overrides the defaults
+func TestLoadSettings(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("GSPOTTY_LIMIT", "")
+	t.Setenv("GSPOTTY_KEEP_PLAYING", "")
+
+	settings, err := LoadSettings()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultSettings(), settings)
+
+	path, err := SettingsPath()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "gspotty", "config.json"), path)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	require.NoError(t, os.WriteFile(path, []byte(`{"search_type": "album", "limit": 10, "credentials_file": "/etc/gspotty/team.json"}`), 0600))
+
+	t.Run("Config File", func(t *testing.T) {
+		settings, err := LoadSettings()
+		require.NoError(t, err)
+		assert.Equal(t, "album", settings.SearchType)
+		assert.Equal(t, 10, settings.Limit)
+		assert.Equal(t, 10, settings.SeekSeconds)
+
+		credentialsPath, err := CredentialsPath()
+		require.NoError(t, err)
+		assert.Equal(t, "/etc/gspotty/team.json", credentialsPath)
+	})
+
+	t.Run("Environment", func(t *testing.T) {
+		t.Setenv("GSPOTTY_LIMIT", "20")
+		t.Setenv("GSPOTTY_KEEP_PLAYING", "true")
+
+		settings, err := LoadSettings()
+		require.NoError(t, err)
+		assert.Equal(t, "album", settings.SearchType)
+		assert.Equal(t, 20, settings.Limit)
+		assert.True(t, settings.KeepPlaying)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		t.Setenv("GSPOTTY_LIMIT", "500")
+		_, err := LoadSettings()
+		assert.Error(t, err)
+
+		t.Setenv("GSPOTTY_LIMIT", "")
+		t.Setenv("GSPOTTY_KEEP_PLAYING", "sometimes")
+		_, err = LoadSettings()
+		assert.Error(t, err)
+	})
+}
+
+// TestCredentialSources tests secret files and the secret command
+func TestCredentialSources(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv(ClientIDEnv, "")
+	t.Setenv(ClientSecretEnv, "")
+	t.Setenv("GSPOTTY_SECRET_COMMAND", "")
+	require.NoError(t, SaveCredentials(Credentials{ClientID: "saved_id", ClientSecret: "saved_secret"}))
+
+	secretFile := filepath.Join(dir, "spotify_secret")
+	require.NoError(t, os.WriteFile(secretFile, []byte("file_secret\n"), 0600))
+	idFile := filepath.Join(dir, "spotify_id")
+	require.NoError(t, os.WriteFile(idFile, []byte("file_id\n"), 0600))
+
+	t.Run("Files", func(t *testing.T) {
+		t.Setenv(ClientIDFileEnv, idFile)
+		t.Setenv(ClientSecretFileEnv, secretFile)
+
+		credentials, err := LoadCredentials(AuthFlowCode)
+		require.NoError(t, err)
+		assert.Equal(t, Credentials{ClientID: "file_id", ClientSecret: "file_secret"}, credentials)
+
+		// The plain variable still wins
+		t.Setenv(ClientSecretEnv, "env_secret")
+		credentials, err = LoadCredentials(AuthFlowCode)
+		require.NoError(t, err)
+		assert.Equal(t, "env_secret", credentials.ClientSecret)
+
+		t.Setenv(ClientSecretEnv, "")
+		t.Setenv(ClientSecretFileEnv, filepath.Join(dir, "missing"))
+		_, err = LoadCredentials(AuthFlowCode)
+		assert.Error(t, err)
+	})
+
+	t.Run("Command", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("the test command needs a POSIX shell")
+		}
+
+		t.Setenv("GSPOTTY_SECRET_COMMAND", "echo command_secret")
+		credentials, err := LoadCredentials(AuthFlowCode)
+		require.NoError(t, err)
+		assert.Equal(t, Credentials{ClientID: "saved_id", ClientSecret: "command_secret"}, credentials)
+
+		// A secret file takes precedence, so the command is not run
+		t.Setenv(ClientSecretFileEnv, secretFile)
+		credentials, err = LoadCredentials(AuthFlowCode)
+		require.NoError(t, err)
+		assert.Equal(t, "file_secret", credentials.ClientSecret)
+
+		t.Setenv(ClientSecretFileEnv, "")
+		t.Setenv("GSPOTTY_SECRET_COMMAND", "exit 1")
+		_, err = LoadCredentials(AuthFlowCode)
+		assert.Error(t, err)
+
+		// PKCE never sends the secret, so the command is not run
+		credentials, err = LoadCredentials(AuthFlowPKCE)
+		require.NoError(t, err)
+		assert.Equal(t, "saved_secret", credentials.ClientSecret)
+	})
+}
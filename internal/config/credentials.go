@@ -0,0 +1,180 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	// ClientIDEnv holds the Spotify application's client ID
+	ClientIDEnv = "SPOTIFY_ID"
+	// ClientSecretEnv holds the Spotify application's client secret
+	ClientSecretEnv = "SPOTIFY_SECRET"
+	// ClientIDFileEnv names a file holding the client ID, such as a Docker secret
+	ClientIDFileEnv = "SPOTIFY_ID_FILE"
+	// ClientSecretFileEnv names a file holding the client secret, such as a Docker secret
+	ClientSecretFileEnv = "SPOTIFY_SECRET_FILE"
+
+	credentialsFile = "credentials.json"
+)
+
+// Credentials identify the Spotify application gspotty authorizes as
+type Credentials struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// CredentialsPath returns the location of the credentials file written by
+// setup, which the credentials_file setting can move
+func CredentialsPath() (string, error) {
+	settings, err := LoadSettings()
+	if err != nil {
+		return "", err
+	}
+	if settings.CredentialsFile != "" {
+		return expandHome(settings.CredentialsFile)
+	}
+
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, credentialsFile), nil
+}
+
+// LoadCredentials resolves the app credentials. Each value comes from the
+// first source that has it:
+//
+//   - SPOTIFY_ID / SPOTIFY_SECRET
+//   - SPOTIFY_ID_FILE / SPOTIFY_SECRET_FILE
+//   - the secret_command setting, for the secret only
+//   - the credentials file written by setup
+//
+// The PKCE flow never uses the secret, so the secret command only runs for
+// the other flows. Missing values are left empty. Every Spotify client is
+// built from these.
+func LoadCredentials(flow string) (Credentials, error) {
+	var credentials Credentials
+
+	path, err := CredentialsPath()
+	if err != nil {
+		return Credentials{}, err
+	}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return Credentials{}, err
+	default:
+		if err := json.Unmarshal(data, &credentials); err != nil {
+			return Credentials{}, fmt.Errorf("credentials file %s is corrupt: %v", path, err)
+		}
+	}
+
+	// A secret manager or helper overrides the saved secret
+	settings, err := LoadSettings()
+	if err != nil {
+		return Credentials{}, err
+	}
+	if flow != AuthFlowPKCE && settings.SecretCommand != "" && os.Getenv(ClientSecretEnv) == "" && os.Getenv(ClientSecretFileEnv) == "" {
+		secret, err := runSecretCommand(settings.SecretCommand)
+		if err != nil {
+			return Credentials{}, err
+		}
+		credentials.ClientSecret = secret
+	}
+
+	if err := override(&credentials.ClientID, ClientIDEnv, ClientIDFileEnv); err != nil {
+		return Credentials{}, err
+	}
+	if err := override(&credentials.ClientSecret, ClientSecretEnv, ClientSecretFileEnv); err != nil {
+		return Credentials{}, err
+	}
+	return credentials, nil
+}
+
+// override sets value from the environment variable, or else from the file the
+// file variable names
+func override(value *string, env, fileEnv string) error {
+	if v := os.Getenv(env); v != "" {
+		*value = v
+		return nil
+	}
+
+	path := os.Getenv(fileEnv)
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", fileEnv, err)
+	}
+	v := strings.TrimSpace(string(data))
+	if v == "" {
+		return fmt.Errorf("%s %s is empty", fileEnv, path)
+	}
+	*value = v
+	return nil
+}
+
+// runSecretCommand runs the secret command through the shell and returns its output
+func runSecretCommand(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("secret command %q failed: %v: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+	secret := strings.TrimSpace(string(output))
+	if secret == "" {
+		return "", fmt.Errorf("secret command %q printed nothing", command)
+	}
+	return secret, nil
+}
+
+// SaveCredentials writes the credentials file, readable only by the user
+func SaveCredentials(credentials Credentials) error {
+	path, err := CredentialsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %v", err)
+	}
+
+	data, err := json.MarshalIndent(credentials, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal credentials: %v", err)
+	}
+
+	// CreateTemp makes the file 0600, so the secret is never readable by others
+	tmp, err := os.CreateTemp(filepath.Dir(path), credentialsFile+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create credentials file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write credentials file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write credentials file: %v", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
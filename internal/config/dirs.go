@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Dir returns gspotty's configuration directory, e.g. ~/.config/gspotty
+func Dir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config directory: %v", err)
+	}
+	return filepath.Join(configDir, "gspotty"), nil
+}
+
+// StateDir returns the directory for data gspotty keeps between runs, such as
+// tokens and history: $XDG_STATE_HOME/gspotty, or ~/.local/state/gspotty
+func StateDir() (string, error) {
+	if stateHome := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(stateHome) {
+		return filepath.Join(stateHome, "gspotty"), nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+	return filepath.Join(homeDir, ".local", "state", "gspotty"), nil
+}
+
+// CacheDir returns the directory for data gspotty can rebuild, e.g. ~/.cache/gspotty
+func CacheDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get cache directory: %v", err)
+	}
+	return filepath.Join(cacheDir, "gspotty"), nil
+}
+
+// ResponseCacheDir returns the directory of cached Spotify API responses
+func ResponseCacheDir() (string, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "responses"), nil
+}
+
+// EnsureDir creates a directory, and any missing parents, readable only by the user
+func EnsureDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %v", dir, err)
+	}
+	return nil
+}
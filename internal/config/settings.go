@@ -0,0 +1,230 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// ConfigFileEnv overrides the location of the config file
+	ConfigFileEnv = "GSPOTTY_CONFIG"
+
+	settingsFile = "config.json"
+)
+
+// Settings are the defaults of gspotty's command line options. They are
+// layered: flags override environment variables, which override the config
+// file, which overrides the built-in defaults.
+type Settings struct {
+	// SearchType is track, album or playlist
+	SearchType   string `json:"search_type"`
+	Limit        int    `json:"limit"`
+	ShowDetails  bool   `json:"show_details"`
+	KeepPlaying  bool   `json:"keep_playing"`
+	ReturnToMenu bool   `json:"return_to_menu"`
+	AutoPlay     bool   `json:"auto_play"`
+	NoBrowser    bool   `json:"no_browser"`
+	// Account is the named account used when -account is not given
+	Account string `json:"account,omitempty"`
+	// Device is the name or ID of the device to play on instead of the active one
+	Device string `json:"device,omitempty"`
+	// SeekSeconds is how far the player's arrow keys seek
+	SeekSeconds int `json:"seek_seconds"`
+	// NoCache sends every catalog lookup to Spotify instead of the response cache
+	NoCache bool `json:"no_cache"`
+	// Offline browses cached results without contacting Spotify
+	Offline bool `json:"offline"`
+	// CredentialsFile overrides the location of the saved app credentials
+	CredentialsFile string `json:"credentials_file,omitempty"`
+	// SecretCommand prints the client secret, e.g. from a password manager
+	SecretCommand string `json:"secret_command,omitempty"`
+	// TokenStore keeps tokens in a plain file, an encrypted file or through helper commands
+	TokenStore string `json:"token_store,omitempty"`
+	TokenCommands
+}
+
+// TokenCommands are the helper commands of the command token store. They run
+// through the shell with {account} replaced by the account name.
+type TokenCommands struct {
+	// Read prints the stored token
+	Read string `json:"token_read_command,omitempty"`
+	// Write stores the token it reads from standard input
+	Write string `json:"token_write_command,omitempty"`
+	// Delete removes the stored token
+	Delete string `json:"token_delete_command,omitempty"`
+}
+
+// SearchTypes are the valid values of Settings.SearchType
+var SearchTypes = []string{"track", "album", "playlist"}
+
+// DefaultSettings returns the built-in defaults
+func DefaultSettings() Settings {
+	return Settings{
+		SearchType:  "track",
+		Limit:       5,
+		SeekSeconds: 10,
+	}
+}
+
+// SettingsPath returns the location of the config file, e.g. ~/.config/gspotty/config.json
+func SettingsPath() (string, error) {
+	if path := os.Getenv(ConfigFileEnv); path != "" {
+		return expandHome(path)
+	}
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, settingsFile), nil
+}
+
+// LoadSettings returns the built-in defaults overridden by the config file and
+// then by GSPOTTY_* environment variables. A missing config file is not an error.
+func LoadSettings() (Settings, error) {
+	settings := DefaultSettings()
+
+	path, err := SettingsPath()
+	if err != nil {
+		return Settings{}, err
+	}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return Settings{}, err
+	default:
+		// Keys missing from the file keep their built-in defaults
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return Settings{}, fmt.Errorf("config file %s is invalid: %v", path, err)
+		}
+	}
+
+	if err := settings.applyEnv(); err != nil {
+		return Settings{}, err
+	}
+	if err := settings.Validate(); err != nil {
+		return Settings{}, fmt.Errorf("invalid settings: %v", err)
+	}
+	return settings, nil
+}
+
+// applyEnv overrides settings with the GSPOTTY_* environment variables that are set
+func (s *Settings) applyEnv() error {
+	stringFields := map[string]*string{
+		"GSPOTTY_SEARCH_TYPE":          &s.SearchType,
+		"GSPOTTY_ACCOUNT":              &s.Account,
+		"GSPOTTY_DEVICE":               &s.Device,
+		"GSPOTTY_CREDENTIALS_FILE":     &s.CredentialsFile,
+		"GSPOTTY_SECRET_COMMAND":       &s.SecretCommand,
+		"GSPOTTY_TOKEN_STORE":          &s.TokenStore,
+		"GSPOTTY_TOKEN_READ_COMMAND":   &s.TokenCommands.Read,
+		"GSPOTTY_TOKEN_WRITE_COMMAND":  &s.TokenCommands.Write,
+		"GSPOTTY_TOKEN_DELETE_COMMAND": &s.TokenCommands.Delete,
+	}
+	for name, field := range stringFields {
+		if value := os.Getenv(name); value != "" {
+			*field = value
+		}
+	}
+
+	intFields := map[string]*int{
+		"GSPOTTY_LIMIT":        &s.Limit,
+		"GSPOTTY_SEEK_SECONDS": &s.SeekSeconds,
+	}
+	for name, field := range intFields {
+		if value := os.Getenv(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q: must be a number", name, value)
+			}
+			*field = n
+		}
+	}
+
+	boolFields := map[string]*bool{
+		"GSPOTTY_SHOW_DETAILS":   &s.ShowDetails,
+		"GSPOTTY_KEEP_PLAYING":   &s.KeepPlaying,
+		"GSPOTTY_RETURN_TO_MENU": &s.ReturnToMenu,
+		"GSPOTTY_AUTO_PLAY":      &s.AutoPlay,
+		"GSPOTTY_NO_BROWSER":     &s.NoBrowser,
+		"GSPOTTY_NO_CACHE":       &s.NoCache,
+		"GSPOTTY_OFFLINE":        &s.Offline,
+	}
+	for name, field := range boolFields {
+		if value := os.Getenv(name); value != "" {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q: must be true or false", name, value)
+			}
+			*field = b
+		}
+	}
+	return nil
+}
+
+// Validate reports settings that no command could use
+func (s Settings) Validate() error {
+	valid := false
+	for _, searchType := range SearchTypes {
+		if s.SearchType == searchType {
+			valid = true
+		}
+	}
+	if !valid {
+		return fmt.Errorf("search type %q must be one of: %s", s.SearchType, strings.Join(SearchTypes, ", "))
+	}
+	if s.Limit < 1 || s.Limit > 50 {
+		return fmt.Errorf("limit %d must be between 1 and 50", s.Limit)
+	}
+	if s.SeekSeconds < 1 {
+		return fmt.Errorf("seek seconds %d must be positive", s.SeekSeconds)
+	}
+	return nil
+}
+
+var (
+	activeMu sync.Mutex
+	active   *Settings
+)
+
+// SetActive records the settings in effect for this run, after flags were applied
+func SetActive(settings Settings) {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	active = &settings
+}
+
+// Active returns the settings in effect for this run. Before SetActive is
+// called it loads them from the config file and environment, falling back to
+// the built-in defaults if they cannot be loaded.
+func Active() Settings {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	if active == nil {
+		settings, err := LoadSettings()
+		if err != nil {
+			settings = DefaultSettings()
+		}
+		active = &settings
+	}
+	return *active
+}
+
+// expandHome expands a leading ~/ to the user's home directory
+func expandHome(path string) (string, error) {
+	if !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+	return filepath.Join(homeDir, path[2:]), nil
+}
@@ -0,0 +1,105 @@
+// Package device picks the Spotify Connect device playback commands act on.
+package device
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/iamgaru/gspotty/internal/api"
+	"github.com/zmb3/spotify/v2"
+)
+
+// Find returns the device whose ID is nameOrID, or whose name is nameOrID
+// ignoring case. A name shared by several devices has to be given as an ID.
+func Find(devices []spotify.PlayerDevice, nameOrID string) (spotify.PlayerDevice, error) {
+	for _, device := range devices {
+		if string(device.ID) == nameOrID {
+			return device, nil
+		}
+	}
+
+	var matches []spotify.PlayerDevice
+	for _, device := range devices {
+		if strings.EqualFold(device.Name, nameOrID) {
+			matches = append(matches, device)
+		}
+	}
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		if len(devices) == 0 {
+			return spotify.PlayerDevice{}, fmt.Errorf("%w: no device %q is open", api.ErrNoDevice, nameOrID)
+		}
+		names := make([]string, len(devices))
+		for i, device := range devices {
+			names[i] = device.Name
+		}
+		return spotify.PlayerDevice{}, fmt.Errorf("%w: no device %q; available devices: %s", api.ErrNoDevice, nameOrID, strings.Join(names, ", "))
+	default:
+		ids := make([]string, len(matches))
+		for i, device := range matches {
+			ids[i] = string(device.ID)
+		}
+		return spotify.PlayerDevice{}, fmt.Errorf("%w: %d devices are named %q; give one of their IDs instead: %s",
+			api.ErrNoDevice, len(matches), nameOrID, strings.Join(ids, ", "))
+	}
+}
+
+// Choose returns the device named by nameOrID, or when it is empty the active
+// device, falling back to the first one
+func Choose(devices []spotify.PlayerDevice, nameOrID string) (spotify.PlayerDevice, error) {
+	if nameOrID != "" {
+		return Find(devices, nameOrID)
+	}
+	if len(devices) == 0 {
+		return spotify.PlayerDevice{}, fmt.Errorf("%w: no active Spotify devices found. Please open Spotify on any device first", api.ErrNoDevice)
+	}
+	for _, device := range devices {
+		if device.Active {
+			return device, nil
+		}
+	}
+	return devices[0], nil
+}
+
+// Select lists the devices and chooses one of them like Choose
+func Select(ctx context.Context, client api.Client, nameOrID string) (spotify.PlayerDevice, error) {
+	devices, err := client.PlayerDevices(ctx)
+	if err != nil {
+		return spotify.PlayerDevice{}, fmt.Errorf("error getting devices: %w", err)
+	}
+	return Choose(devices, nameOrID)
+}
+
+// Options returns play options aimed at the device named by nameOrID, or nil
+// when it is empty so the command goes to the active device
+func Options(ctx context.Context, client api.Client, nameOrID string) (*spotify.PlayOptions, error) {
+	if nameOrID == "" {
+		return nil, nil
+	}
+	target, err := Select(ctx, client, nameOrID)
+	if err != nil {
+		return nil, err
+	}
+	return &spotify.PlayOptions{DeviceID: &target.ID}, nil
+}
+
+// Transfer moves playback to the device named by nameOrID. The track keeps
+// its position, and keeps playing only if it was playing before.
+func Transfer(ctx context.Context, client api.Client, nameOrID string) (spotify.PlayerDevice, error) {
+	target, err := Select(ctx, client, nameOrID)
+	if err != nil {
+		return spotify.PlayerDevice{}, err
+	}
+	state, err := client.PlayerState(ctx)
+	if err != nil {
+		return spotify.PlayerDevice{}, fmt.Errorf("error getting playback state: %w", err)
+	}
+	playing := state != nil && state.Playing
+	if err := client.TransferPlayback(ctx, target.ID, playing); err != nil {
+		return spotify.PlayerDevice{}, fmt.Errorf("error transferring playback: %w", err)
+	}
+	return target, nil
+}
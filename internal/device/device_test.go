@@ -0,0 +1,99 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/iamgaru/gspotty/internal/api"
+	"github.com/iamgaru/gspotty/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zmb3/spotify/v2"
+)
+
+var testDevices = []spotify.PlayerDevice{
+	{ID: "laptop-id", Name: "Laptop", Type: "Computer"},
+	{ID: "kitchen-id", Name: "Kitchen", Type: "Speaker", Active: true},
+	{ID: "echo-1", Name: "Echo", Type: "Speaker"},
+	{ID: "echo-2", Name: "Echo", Type: "Speaker"},
+}
+
+// TestChoose tests picking a device by name, by ID and by default
+func TestChoose(t *testing.T) {
+	tests := []struct {
+		name     string
+		nameOrID string
+		expected spotify.ID
+	}{
+		{"Active By Default", "", "kitchen-id"},
+		{"By ID", "laptop-id", "laptop-id"},
+		{"By Name Ignoring Case", "LAPTOP", "laptop-id"},
+		{"Shared Name By ID", "echo-2", "echo-2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device, err := Choose(testDevices, tt.nameOrID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, device.ID)
+		})
+	}
+
+	t.Run("First Without Active", func(t *testing.T) {
+		device, err := Choose(testDevices[:1], "")
+		require.NoError(t, err)
+		assert.Equal(t, spotify.ID("laptop-id"), device.ID)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		_, err := Choose(nil, "")
+		assert.True(t, errors.Is(err, api.ErrNoDevice))
+
+		_, err = Choose(testDevices, "Toaster")
+		assert.True(t, errors.Is(err, api.ErrNoDevice))
+		assert.Contains(t, err.Error(), "available devices: Laptop, Kitchen, Echo, Echo")
+
+		_, err = Choose(testDevices, "echo")
+		assert.True(t, errors.Is(err, api.ErrNoDevice))
+		assert.Contains(t, err.Error(), "echo-1, echo-2")
+	})
+}
+
+// TestTransfer tests that transferring keeps playback paused or playing
+func TestTransfer(t *testing.T) {
+	ctx := context.Background()
+	mockClient := &testutils.MockSpotifyClient{Devices: testDevices}
+
+	device, err := Transfer(ctx, mockClient, "Laptop")
+	require.NoError(t, err)
+	assert.Equal(t, "Laptop", device.Name)
+	assert.Equal(t, spotify.ID("laptop-id"), mockClient.TransferDeviceID)
+	assert.False(t, mockClient.TransferPlay)
+
+	mockClient.CurrentState = &spotify.PlayerState{CurrentlyPlaying: spotify.CurrentlyPlaying{Playing: true}}
+	_, err = Transfer(ctx, mockClient, "kitchen-id")
+	require.NoError(t, err)
+	assert.Equal(t, spotify.ID("kitchen-id"), mockClient.TransferDeviceID)
+	assert.True(t, mockClient.TransferPlay)
+
+	mockClient.TransferCalled = false
+	_, err = Transfer(ctx, mockClient, "Toaster")
+	assert.Error(t, err)
+	assert.False(t, mockClient.TransferCalled)
+}
+
+// TestOptions tests aiming player commands at a device
+func TestOptions(t *testing.T) {
+	ctx := context.Background()
+	mockClient := &testutils.MockSpotifyClient{Devices: testDevices}
+
+	opts, err := Options(ctx, mockClient, "")
+	require.NoError(t, err)
+	assert.Nil(t, opts)
+	assert.False(t, mockClient.PlayerDevicesCalled)
+
+	opts, err = Options(ctx, mockClient, "kitchen")
+	require.NoError(t, err)
+	require.NotNil(t, opts)
+	assert.Equal(t, spotify.ID("kitchen-id"), *opts.DeviceID)
+}
@@ -0,0 +1,929 @@
+// Package fakespotify provides an in-process fake of the Spotify Web API for tests.
+//
+// The fake serves the endpoints gspotty uses (search, catalog lookups, the
+// player and device endpoints, and the Accounts service authorize and token
+// endpoints) from an httptest.Server and keeps device and playback state, so
+// a play/pause/next/seek sequence can be checked without a network connection.
+package fakespotify
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/zmb3/spotify/v2"
+)
+
+// Playback is a snapshot of the fake player state
+type Playback struct {
+	DeviceID   spotify.ID
+	Playing    bool
+	Queue      []spotify.URI
+	Index      int
+	ProgressMs int
+	Shuffle    bool
+	// Repeat is off, track or context; empty means off
+	Repeat string
+}
+
+// CurrentURI returns the URI of the track at the head of the queue
+func (p Playback) CurrentURI() spotify.URI {
+	if p.Index < 0 || p.Index >= len(p.Queue) {
+		return ""
+	}
+	return p.Queue[p.Index]
+}
+
+// failure is a canned error response returned for the next matching request
+type failure struct {
+	status  int
+	message string
+	header  http.Header
+}
+
+// authCode is an authorization code issued by the fake authorize endpoint
+type authCode struct {
+	redirectURI string
+	challenge   string
+	scope       string
+}
+
+// Server is a fake Spotify Web API server
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	tracks    map[spotify.ID]spotify.FullTrack
+	albums    map[spotify.ID]spotify.SimpleAlbum
+	albumIDs  []spotify.ID
+	albumList map[spotify.ID][]spotify.ID
+	playlists map[spotify.ID]spotify.SimplePlaylist
+	playIDs   []spotify.ID
+	playList  map[spotify.ID][]spotify.ID
+	trackIDs  []spotify.ID
+	users     map[string]spotify.User
+	me        spotify.PrivateUser
+	devices   []spotify.PlayerDevice
+	playback  Playback
+	failures  map[string][]failure
+	requests  []string
+	searches  []string
+
+	clientID      string
+	clientSecret  string
+	tokenCount    int
+	codeCount     int
+	codes         map[string]authCode
+	refreshTokens map[string]bool
+}
+
+// NewServer starts a fake Spotify Web API server. Callers should Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		tracks:    make(map[spotify.ID]spotify.FullTrack),
+		albums:    make(map[spotify.ID]spotify.SimpleAlbum),
+		albumList: make(map[spotify.ID][]spotify.ID),
+		playlists: make(map[spotify.ID]spotify.SimplePlaylist),
+		playList:  make(map[spotify.ID][]spotify.ID),
+		users:     make(map[string]spotify.User),
+		me: spotify.PrivateUser{User: spotify.User{
+			ID:          "fake_user",
+			DisplayName: "Fake User",
+			URI:         "spotify:user:fake_user",
+		}},
+		failures: make(map[string][]failure),
+
+		codes:         make(map[string]authCode),
+		refreshTokens: make(map[string]bool),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/search", s.handleSearch)
+	mux.HandleFunc("GET /v1/tracks/{id}", s.handleTrack)
+	mux.HandleFunc("GET /v1/albums/{id}", s.handleAlbum)
+	mux.HandleFunc("GET /v1/albums/{id}/tracks", s.handleAlbumTracks)
+	mux.HandleFunc("GET /v1/playlists/{id}", s.handlePlaylist)
+	mux.HandleFunc("GET /v1/playlists/{id}/tracks", s.handlePlaylistItems)
+	mux.HandleFunc("GET /v1/users/{id}", s.handleUser)
+	mux.HandleFunc("GET /v1/me", s.handleMe)
+	mux.HandleFunc("GET /v1/me/player", s.handlePlayerState)
+	mux.HandleFunc("PUT /v1/me/player", s.handleTransfer)
+	mux.HandleFunc("GET /v1/me/player/devices", s.handleDevices)
+	mux.HandleFunc("PUT /v1/me/player/play", s.handlePlay)
+	mux.HandleFunc("PUT /v1/me/player/pause", s.handlePause)
+	mux.HandleFunc("POST /v1/me/player/next", s.handleNext)
+	mux.HandleFunc("POST /v1/me/player/previous", s.handlePrevious)
+	mux.HandleFunc("PUT /v1/me/player/seek", s.handleSeek)
+	mux.HandleFunc("PUT /v1/me/player/volume", s.handleVolume)
+	mux.HandleFunc("GET /authorize", s.handleAuthorize)
+	mux.HandleFunc("POST /api/token", s.handleToken)
+
+	s.Server = httptest.NewServer(s.intercept(mux))
+	return s
+}
+
+// APIURL returns the base URL of the fake Web API, suitable for spotify.WithBaseURL
+func (s *Server) APIURL() string {
+	return s.URL + "/v1/"
+}
+
+// AccountsURL returns the base URL of the fake Accounts service
+func (s *Server) AccountsURL() string {
+	return s.URL + "/"
+}
+
+// Client returns a Spotify client that talks to the fake server
+func (s *Server) Client() *spotify.Client {
+	return spotify.New(s.Server.Client(), spotify.WithBaseURL(s.APIURL()))
+}
+
+// SetClientCredentials makes the accounts endpoints only accept the given client ID and secret.
+// Public (PKCE) clients may still omit the secret; an empty secret accepts any secret.
+func (s *Server) SetClientCredentials(clientID, clientSecret string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clientID = clientID
+	s.clientSecret = clientSecret
+}
+
+// AddTrack registers a track in the fake catalog
+func (s *Server) AddTrack(track spotify.FullTrack) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addTrackLocked(track)
+}
+
+// addTrackLocked registers a track, filling in the fields the real API always sets
+func (s *Server) addTrackLocked(track spotify.FullTrack) spotify.FullTrack {
+	if track.URI == "" {
+		track.URI = spotify.URI("spotify:track:" + string(track.ID))
+	}
+	track.Type = "track"
+	if _, exists := s.tracks[track.ID]; !exists {
+		s.trackIDs = append(s.trackIDs, track.ID)
+	}
+	s.tracks[track.ID] = track
+	return track
+}
+
+// AddAlbum registers an album and its tracks in the fake catalog
+func (s *Server) AddAlbum(album spotify.SimpleAlbum, tracks ...spotify.FullTrack) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if album.URI == "" {
+		album.URI = spotify.URI("spotify:album:" + string(album.ID))
+	}
+	album.TotalTracks = spotify.Numeric(len(tracks))
+
+	ids := make([]spotify.ID, len(tracks))
+	for i, track := range tracks {
+		track.Album = album
+		ids[i] = s.addTrackLocked(track).ID
+	}
+
+	if _, exists := s.albums[album.ID]; !exists {
+		s.albumIDs = append(s.albumIDs, album.ID)
+	}
+	s.albums[album.ID] = album
+	s.albumList[album.ID] = ids
+}
+
+// AddPlaylist registers a playlist and its tracks in the fake catalog
+func (s *Server) AddPlaylist(playlist spotify.SimplePlaylist, tracks ...spotify.FullTrack) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if playlist.URI == "" {
+		playlist.URI = spotify.URI("spotify:playlist:" + string(playlist.ID))
+	}
+	playlist.Tracks.Total = spotify.Numeric(len(tracks))
+
+	ids := make([]spotify.ID, len(tracks))
+	for i, track := range tracks {
+		ids[i] = s.addTrackLocked(track).ID
+	}
+
+	if _, exists := s.playlists[playlist.ID]; !exists {
+		s.playIDs = append(s.playIDs, playlist.ID)
+	}
+	s.playlists[playlist.ID] = playlist
+	s.playList[playlist.ID] = ids
+}
+
+// SetCurrentUser sets the user the fake's tokens belong to
+func (s *Server) SetCurrentUser(user spotify.PrivateUser) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.me = user
+}
+
+// AddUser registers a public user profile
+func (s *Server) AddUser(user spotify.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[user.ID] = user
+}
+
+// AddDevice registers a playback device
+func (s *Server) AddDevice(device spotify.PlayerDevice) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.devices = append(s.devices, device)
+	if device.Active {
+		s.playback.DeviceID = device.ID
+	}
+}
+
+// SetPlayMode sets the shuffle and repeat state the player reports
+func (s *Server) SetPlayMode(shuffle bool, repeat string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.playback.Shuffle = shuffle
+	s.playback.Repeat = repeat
+}
+
+// FailNext makes the next request matching method and path (for example
+// "GET", "/v1/search") fail with the given status and Spotify error message
+func (s *Server) FailNext(method, path string, status int, message string) {
+	s.FailNextWithHeader(method, path, status, message, nil)
+}
+
+// FailNextWithHeader is like FailNext but also sets response headers, such as Retry-After
+func (s *Server) FailNextWithHeader(method, path string, status int, message string, header http.Header) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := method + " " + path
+	s.failures[key] = append(s.failures[key], failure{status: status, message: message, header: header})
+}
+
+// Playback returns a snapshot of the current playback state
+func (s *Server) Playback() Playback {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot := s.playback
+	snapshot.Queue = append([]spotify.URI(nil), s.playback.Queue...)
+	return snapshot
+}
+
+// Devices returns a snapshot of the registered devices
+func (s *Server) Devices() []spotify.PlayerDevice {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]spotify.PlayerDevice(nil), s.devices...)
+}
+
+// Requests returns the requests served so far, as "METHOD /path" strings
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// Searches returns the queries searched for so far
+func (s *Server) Searches() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.searches...)
+}
+
+// intercept records each request and serves any queued failure for it
+func (s *Server) intercept(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Method + " " + r.URL.Path
+
+		s.mu.Lock()
+		s.requests = append(s.requests, key)
+		var fail *failure
+		if queued := s.failures[key]; len(queued) > 0 {
+			fail = &queued[0]
+			s.failures[key] = queued[1:]
+		}
+		s.mu.Unlock()
+
+		if fail != nil {
+			for name, values := range fail.header {
+				for _, value := range values {
+					w.Header().Add(name, value)
+				}
+			}
+			writeError(w, fail.status, fail.message)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeJSON writes v as a JSON response body
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error in the Web API's error object format
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]spotify.Error{
+		"error": {Status: status, Message: message},
+	})
+}
+
+// pageBounds applies the limit and offset query parameters to a list of n items
+func pageBounds(r *http.Request, n int) (start, end, limit int) {
+	limit = 20
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	start, _ = strconv.Atoi(r.URL.Query().Get("offset"))
+	if start > n {
+		start = n
+	}
+	end = start + limit
+	if end > n {
+		end = n
+	}
+	return start, end, limit
+}
+
+// matchesQuery reports whether a name and its artists match a search query.
+// Supports plain words and the artist: filter.
+func matchesQuery(query, name string, artists []spotify.SimpleArtist) bool {
+	var words []string
+	var artistFilter string
+	for _, field := range strings.Fields(strings.ToLower(query)) {
+		if strings.HasPrefix(field, "artist:") {
+			artistFilter = strings.TrimPrefix(field, "artist:")
+			continue
+		}
+		words = append(words, field)
+	}
+
+	lowerName := strings.ToLower(name)
+	for _, word := range words {
+		if !strings.Contains(lowerName, word) {
+			return false
+		}
+	}
+
+	if artistFilter != "" {
+		for _, artist := range artists {
+			if strings.Contains(strings.ToLower(artist.Name), artistFilter) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		writeError(w, http.StatusBadRequest, "No search query")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.searches = append(s.searches, query)
+
+	var result spotify.SearchResult
+	for _, searchType := range strings.Split(r.URL.Query().Get("type"), ",") {
+		switch searchType {
+		case "track":
+			var tracks []spotify.FullTrack
+			for _, id := range s.trackIDs {
+				track := s.tracks[id]
+				if matchesQuery(query, track.Name, track.Artists) {
+					tracks = append(tracks, track)
+				}
+			}
+			start, end, limit := pageBounds(r, len(tracks))
+			result.Tracks = &spotify.FullTrackPage{Tracks: tracks[start:end]}
+			result.Tracks.Total = spotify.Numeric(len(tracks))
+			result.Tracks.Limit = spotify.Numeric(limit)
+		case "album":
+			var albums []spotify.SimpleAlbum
+			for _, id := range s.albumIDs {
+				album := s.albums[id]
+				if matchesQuery(query, album.Name, album.Artists) {
+					albums = append(albums, album)
+				}
+			}
+			start, end, limit := pageBounds(r, len(albums))
+			result.Albums = &spotify.SimpleAlbumPage{Albums: albums[start:end]}
+			result.Albums.Total = spotify.Numeric(len(albums))
+			result.Albums.Limit = spotify.Numeric(limit)
+		case "playlist":
+			var playlists []spotify.SimplePlaylist
+			for _, id := range s.playIDs {
+				playlist := s.playlists[id]
+				if matchesQuery(query, playlist.Name, nil) {
+					playlists = append(playlists, playlist)
+				}
+			}
+			start, end, limit := pageBounds(r, len(playlists))
+			result.Playlists = &spotify.SimplePlaylistPage{Playlists: playlists[start:end]}
+			result.Playlists.Total = spotify.Numeric(len(playlists))
+			result.Playlists.Limit = spotify.Numeric(limit)
+		default:
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Bad search type field %s", searchType))
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) handleTrack(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	track, ok := s.tracks[spotify.ID(r.PathValue("id"))]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "Non existing id")
+		return
+	}
+	writeJSON(w, http.StatusOK, track)
+}
+
+// albumTracksLocked returns the simplified tracks of an album
+func (s *Server) albumTracksLocked(id spotify.ID) []spotify.SimpleTrack {
+	ids := s.albumList[id]
+	tracks := make([]spotify.SimpleTrack, len(ids))
+	for i, trackID := range ids {
+		tracks[i] = s.tracks[trackID].SimpleTrack
+	}
+	return tracks
+}
+
+func (s *Server) handleAlbum(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := spotify.ID(r.PathValue("id"))
+	album, ok := s.albums[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Non existing id")
+		return
+	}
+
+	full := spotify.FullAlbum{SimpleAlbum: album}
+	full.Tracks.Tracks = s.albumTracksLocked(id)
+	full.Tracks.Total = spotify.Numeric(len(full.Tracks.Tracks))
+	writeJSON(w, http.StatusOK, full)
+}
+
+func (s *Server) handleAlbumTracks(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := spotify.ID(r.PathValue("id"))
+	if _, ok := s.albums[id]; !ok {
+		writeError(w, http.StatusNotFound, "Non existing id")
+		return
+	}
+
+	tracks := s.albumTracksLocked(id)
+	start, end, limit := pageBounds(r, len(tracks))
+	page := spotify.SimpleTrackPage{Tracks: tracks[start:end]}
+	page.Total = spotify.Numeric(len(tracks))
+	page.Limit = spotify.Numeric(limit)
+	page.Offset = spotify.Numeric(start)
+	writeJSON(w, http.StatusOK, page)
+}
+
+// playlistTracksLocked returns the items of a playlist
+func (s *Server) playlistTracksLocked(id spotify.ID) []spotify.PlaylistTrack {
+	ids := s.playList[id]
+	items := make([]spotify.PlaylistTrack, len(ids))
+	for i, trackID := range ids {
+		items[i] = spotify.PlaylistTrack{Track: s.tracks[trackID]}
+	}
+	return items
+}
+
+func (s *Server) handlePlaylist(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := spotify.ID(r.PathValue("id"))
+	playlist, ok := s.playlists[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+
+	full := spotify.FullPlaylist{SimplePlaylist: playlist}
+	full.Tracks.Tracks = s.playlistTracksLocked(id)
+	full.Tracks.Total = spotify.Numeric(len(full.Tracks.Tracks))
+	writeJSON(w, http.StatusOK, full)
+}
+
+func (s *Server) handlePlaylistItems(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := spotify.ID(r.PathValue("id"))
+	if _, ok := s.playlists[id]; !ok {
+		writeError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+
+	// PlaylistTrack marshals to the same shape as the items endpoint, and the
+	// track's type field lets spotify.PlaylistItemTrack decode it
+	items := s.playlistTracksLocked(id)
+	start, end, limit := pageBounds(r, len(items))
+	page := spotify.PlaylistTrackPage{Tracks: items[start:end]}
+	page.Total = spotify.Numeric(len(items))
+	page.Limit = spotify.Numeric(limit)
+	page.Offset = spotify.Numeric(start)
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (s *Server) handleUser(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	user, ok := s.users[r.PathValue("id")]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such user")
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+func (s *Server) handleMe(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	me := s.me
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, me)
+}
+
+// activeDeviceLocked returns the index of the active device, or -1 if there is none
+func (s *Server) activeDeviceLocked() int {
+	for i, device := range s.devices {
+		if device.Active {
+			return i
+		}
+	}
+	return -1
+}
+
+// targetDeviceLocked resolves the device a player command applies to. It writes
+// an error response and returns -1 if the command cannot be served.
+func (s *Server) targetDeviceLocked(w http.ResponseWriter, r *http.Request) int {
+	if deviceID := r.URL.Query().Get("device_id"); deviceID != "" {
+		for i, device := range s.devices {
+			if string(device.ID) == deviceID {
+				return i
+			}
+		}
+		writeError(w, http.StatusNotFound, "Device not found")
+		return -1
+	}
+
+	index := s.activeDeviceLocked()
+	if index < 0 {
+		writeError(w, http.StatusNotFound, "Player command failed: No active device found")
+	}
+	return index
+}
+
+// activateLocked makes the device at index the only active device
+func (s *Server) activateLocked(index int) {
+	for i := range s.devices {
+		s.devices[i].Active = i == index
+	}
+	s.playback.DeviceID = s.devices[index].ID
+}
+
+func (s *Server) handlePlayerState(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.activeDeviceLocked()
+	if index < 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	state := spotify.PlayerState{Device: s.devices[index]}
+	state.Playing = s.playback.Playing
+	state.Progress = spotify.Numeric(s.playback.ProgressMs)
+	state.ShuffleState = s.playback.Shuffle
+	state.RepeatState = s.playback.Repeat
+	if state.RepeatState == "" {
+		state.RepeatState = "off"
+	}
+	if uri := s.playback.CurrentURI(); uri != "" {
+		for _, track := range s.tracks {
+			if track.URI == uri {
+				item := track
+				state.Item = &item
+				break
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, state)
+}
+
+func (s *Server) handleTransfer(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		DeviceIDs []spotify.ID `json:"device_ids"`
+		Play      bool         `json:"play"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.DeviceIDs) != 1 {
+		writeError(w, http.StatusBadRequest, "Exactly one device_id must be given")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, device := range s.devices {
+		if device.ID == body.DeviceIDs[0] {
+			// The queue and position move along with playback
+			s.activateLocked(i)
+			if body.Play {
+				s.playback.Playing = true
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Device not found")
+}
+
+func (s *Server) handleDevices(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	devices := append([]spotify.PlayerDevice{}, s.devices...)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string][]spotify.PlayerDevice{"devices": devices})
+}
+
+func (s *Server) handlePlay(w http.ResponseWriter, r *http.Request) {
+	var opts spotify.PlayOptions
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil && !errors.Is(err, io.EOF) {
+			writeError(w, http.StatusBadRequest, "Malformed json")
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.targetDeviceLocked(w, r)
+	if index < 0 {
+		return
+	}
+	s.activateLocked(index)
+
+	if len(opts.URIs) > 0 {
+		s.playback.Queue = append([]spotify.URI(nil), opts.URIs...)
+		s.playback.Index = 0
+		if opts.PlaybackOffset != nil && opts.PlaybackOffset.Position != nil {
+			s.playback.Index = *opts.PlaybackOffset.Position
+		}
+		s.playback.ProgressMs = int(opts.PositionMs)
+	} else if len(s.playback.Queue) == 0 {
+		writeError(w, http.StatusBadRequest, "Nothing to resume")
+		return
+	}
+
+	s.playback.Playing = true
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.targetDeviceLocked(w, r)
+	if index < 0 {
+		return
+	}
+	if !s.playback.Playing {
+		writeError(w, http.StatusForbidden, "Player command failed: Restriction violated")
+		return
+	}
+
+	s.playback.Playing = false
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// skip moves delta tracks through the queue
+func (s *Server) skip(w http.ResponseWriter, r *http.Request, delta int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.targetDeviceLocked(w, r) < 0 {
+		return
+	}
+
+	next := s.playback.Index + delta
+	if next < 0 || next >= len(s.playback.Queue) {
+		writeError(w, http.StatusForbidden, "Player command failed: Restriction violated")
+		return
+	}
+
+	s.playback.Index = next
+	s.playback.ProgressMs = 0
+	s.playback.Playing = true
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleNext(w http.ResponseWriter, r *http.Request) {
+	s.skip(w, r, 1)
+}
+
+func (s *Server) handlePrevious(w http.ResponseWriter, r *http.Request) {
+	s.skip(w, r, -1)
+}
+
+func (s *Server) handleSeek(w http.ResponseWriter, r *http.Request) {
+	position, err := strconv.Atoi(r.URL.Query().Get("position_ms"))
+	if err != nil || position < 0 {
+		writeError(w, http.StatusBadRequest, "Invalid position_ms")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.targetDeviceLocked(w, r) < 0 {
+		return
+	}
+
+	s.playback.ProgressMs = position
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleVolume(w http.ResponseWriter, r *http.Request) {
+	volume, err := strconv.Atoi(r.URL.Query().Get("volume_percent"))
+	if err != nil || volume < 0 || volume > 100 {
+		writeError(w, http.StatusBadRequest, "Invalid volume_percent")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.targetDeviceLocked(w, r)
+	if index < 0 {
+		return
+	}
+
+	s.devices[index].Volume = spotify.Numeric(volume)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeOAuthError writes an error in the OAuth2 token endpoint's format
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+// issueTokenLocked creates a new access token response
+func (s *Server) issueTokenLocked(refreshToken, scope string) map[string]interface{} {
+	s.tokenCount++
+	token := map[string]interface{}{
+		"access_token": fmt.Sprintf("fake-access-token-%d", s.tokenCount),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	}
+	if refreshToken != "" {
+		token["refresh_token"] = refreshToken
+		s.refreshTokens[refreshToken] = true
+	}
+	if scope != "" {
+		token["scope"] = scope
+	}
+	return token
+}
+
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.clientID != "" && query.Get("client_id") != s.clientID {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_client", "Invalid client")
+		return
+	}
+	if query.Get("response_type") != "code" {
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_response_type", "response_type must be code")
+		return
+	}
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Invalid redirect URI")
+		return
+	}
+
+	challenge := query.Get("code_challenge")
+	if challenge != "" && query.Get("code_challenge_method") != "S256" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "code_challenge_method must be S256")
+		return
+	}
+
+	s.codeCount++
+	code := fmt.Sprintf("fake-code-%d", s.codeCount)
+	s.codes[code] = authCode{
+		redirectURI: redirectURI.String(),
+		challenge:   challenge,
+		scope:       query.Get("scope"),
+	}
+
+	callback := redirectURI.Query()
+	callback.Set("code", code)
+	if state := query.Get("state"); state != "" {
+		callback.Set("state", state)
+	}
+	redirectURI.RawQuery = callback.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Malformed form body")
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Public clients send no secret, but a secret that is sent must be right
+	if (s.clientID != "" && clientID != s.clientID) ||
+		(s.clientSecret != "" && clientSecret != "" && clientSecret != s.clientSecret) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_client", "Invalid client")
+		return
+	}
+	confidential := s.clientSecret == "" || clientSecret != ""
+
+	switch r.PostForm.Get("grant_type") {
+	case "client_credentials":
+		if !confidential {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_client", "Invalid client secret")
+			return
+		}
+		writeJSON(w, http.StatusOK, s.issueTokenLocked("", ""))
+	case "authorization_code":
+		code, exists := s.codes[r.PostForm.Get("code")]
+		delete(s.codes, r.PostForm.Get("code"))
+		if !exists || code.redirectURI != r.PostForm.Get("redirect_uri") {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid authorization code")
+			return
+		}
+		if code.challenge != "" {
+			sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+			if base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+				writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "code_verifier was incorrect")
+				return
+			}
+		} else if !confidential {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_client", "Invalid client secret")
+			return
+		}
+		s.codeCount++
+		writeJSON(w, http.StatusOK, s.issueTokenLocked(fmt.Sprintf("fake-refresh-token-%d", s.codeCount), code.scope))
+	case "refresh_token":
+		refreshToken := r.PostForm.Get("refresh_token")
+		if !s.refreshTokens[refreshToken] {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid refresh token")
+			return
+		}
+		writeJSON(w, http.StatusOK, s.issueTokenLocked(refreshToken, ""))
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "grant_type parameter is missing or unsupported")
+	}
+}
+
+// AddRefreshToken registers a refresh token the token endpoint will accept
+func (s *Server) AddRefreshToken(refreshToken string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshTokens[refreshToken] = true
+}
@@ -0,0 +1,145 @@
+package fakespotify
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zmb3/spotify/v2"
+)
+
+// newTestServer creates a fake server with a small catalog and one device
+func newTestServer(t *testing.T) *Server {
+	server := NewServer()
+	t.Cleanup(server.Close)
+
+	artist := []spotify.SimpleArtist{{Name: "Queen"}}
+	server.AddAlbum(spotify.SimpleAlbum{ID: "album1", Name: "A Night at the Opera", Artists: artist},
+		spotify.FullTrack{SimpleTrack: spotify.SimpleTrack{ID: "track1", Name: "Bohemian Rhapsody", Artists: artist, Duration: 354000}},
+		spotify.FullTrack{SimpleTrack: spotify.SimpleTrack{ID: "track2", Name: "Love of My Life", Artists: artist, Duration: 219000}},
+	)
+	server.AddPlaylist(spotify.SimplePlaylist{ID: "playlist1", Name: "Queen Classics"},
+		spotify.FullTrack{SimpleTrack: spotify.SimpleTrack{ID: "track3", Name: "Don't Stop Me Now", Artists: artist, Duration: 209000}},
+	)
+	server.AddDevice(spotify.PlayerDevice{ID: "device1", Name: "Laptop", Type: "Computer", Volume: 40})
+	server.AddDevice(spotify.PlayerDevice{ID: "device2", Name: "Phone", Type: "Smartphone", Volume: 60})
+	return server
+}
+
+// TestCatalog tests search and catalog lookups
+func TestCatalog(t *testing.T) {
+	server := newTestServer(t)
+	client := server.Client()
+	ctx := context.Background()
+
+	t.Run("Search", func(t *testing.T) {
+		results, err := client.Search(ctx, "bohemian", spotify.SearchTypeTrack|spotify.SearchTypeAlbum, spotify.Limit(5))
+		require.NoError(t, err)
+		require.Len(t, results.Tracks.Tracks, 1)
+		assert.Equal(t, "Bohemian Rhapsody", results.Tracks.Tracks[0].Name)
+		assert.Equal(t, spotify.URI("spotify:track:track1"), results.Tracks.Tracks[0].URI)
+		assert.Empty(t, results.Albums.Albums)
+
+		results, err = client.Search(ctx, "life artist:queen", spotify.SearchTypeTrack)
+		require.NoError(t, err)
+		assert.Len(t, results.Tracks.Tracks, 1)
+
+		results, err = client.Search(ctx, "life artist:abba", spotify.SearchTypeTrack)
+		require.NoError(t, err)
+		assert.Empty(t, results.Tracks.Tracks)
+	})
+
+	t.Run("Album Tracks", func(t *testing.T) {
+		page, err := client.GetAlbumTracks(ctx, "album1", spotify.Limit(1), spotify.Offset(1))
+		require.NoError(t, err)
+		require.Len(t, page.Tracks, 1)
+		assert.Equal(t, "Love of My Life", page.Tracks[0].Name)
+		assert.Equal(t, spotify.Numeric(2), page.Total)
+	})
+
+	t.Run("Playlist Items", func(t *testing.T) {
+		items, err := client.GetPlaylistItems(ctx, "playlist1")
+		require.NoError(t, err)
+		require.Len(t, items.Items, 1)
+		require.NotNil(t, items.Items[0].Track.Track)
+		assert.Equal(t, "Don't Stop Me Now", items.Items[0].Track.Track.Name)
+	})
+
+	t.Run("Error Payloads", func(t *testing.T) {
+		_, err := client.GetTrack(ctx, "missing")
+		var spotifyErr spotify.Error
+		require.ErrorAs(t, err, &spotifyErr)
+		assert.Equal(t, http.StatusNotFound, spotifyErr.Status)
+
+		server.FailNext(http.MethodGet, "/v1/search", http.StatusServiceUnavailable, "Service unavailable")
+		_, err = client.Search(ctx, "queen", spotify.SearchTypeTrack)
+		require.ErrorAs(t, err, &spotifyErr)
+		assert.Equal(t, "Service unavailable", spotifyErr.Message)
+
+		// Failures are one-shot
+		_, err = client.Search(ctx, "queen", spotify.SearchTypeTrack)
+		assert.NoError(t, err)
+	})
+}
+
+// TestPlaybackSequence tests that player state follows a play/pause/next/seek sequence
+func TestPlaybackSequence(t *testing.T) {
+	server := newTestServer(t)
+	client := server.Client()
+	ctx := context.Background()
+
+	// Nothing is playing and no device is active yet
+	state, err := client.PlayerState(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, state.Item)
+	assert.Error(t, client.Pause(ctx))
+
+	deviceID := spotify.ID("device1")
+	err = client.PlayOpt(ctx, &spotify.PlayOptions{
+		DeviceID: &deviceID,
+		URIs:     []spotify.URI{"spotify:track:track1", "spotify:track:track2"},
+	})
+	require.NoError(t, err)
+
+	playback := server.Playback()
+	assert.True(t, playback.Playing)
+	assert.Equal(t, deviceID, playback.DeviceID)
+	assert.Equal(t, spotify.URI("spotify:track:track1"), playback.CurrentURI())
+
+	require.NoError(t, client.Pause(ctx))
+	assert.False(t, server.Playback().Playing)
+
+	require.NoError(t, client.Next(ctx))
+	playback = server.Playback()
+	assert.True(t, playback.Playing)
+	assert.Equal(t, spotify.URI("spotify:track:track2"), playback.CurrentURI())
+
+	require.NoError(t, client.Seek(ctx, 30000))
+	assert.Equal(t, 30000, server.Playback().ProgressMs)
+
+	require.NoError(t, client.Volume(ctx, 75))
+	assert.Equal(t, spotify.Numeric(75), server.Devices()[0].Volume)
+
+	state, err = client.PlayerState(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, state.Item)
+	assert.Equal(t, "Love of My Life", state.Item.Name)
+	assert.Equal(t, spotify.Numeric(30000), state.Progress)
+	assert.Equal(t, "Laptop", state.Device.Name)
+
+	// There is no track after the last one in the queue
+	assert.Error(t, client.Next(ctx))
+	// Transferring keeps the queue and position, and the paused state unless asked to play
+	require.NoError(t, client.Pause(ctx))
+	require.NoError(t, client.TransferPlayback(ctx, "device2", false))
+	playback = server.Playback()
+	assert.Equal(t, spotify.ID("device2"), playback.DeviceID)
+	assert.Equal(t, spotify.URI("spotify:track:track2"), playback.CurrentURI())
+	assert.Equal(t, 30000, playback.ProgressMs)
+	assert.False(t, playback.Playing)
+	require.NoError(t, client.TransferPlayback(ctx, "device1", true))
+	assert.True(t, server.Playback().Playing)
+	assert.Error(t, client.TransferPlayback(ctx, "missing", true))
+}
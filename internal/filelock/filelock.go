@@ -0,0 +1,101 @@
+// Package filelock serializes access to a file between gspotty processes.
+//
+// The lock is a separate file created with O_EXCL, which works the same on
+// every platform and file system. The holder touches the lock while it holds
+// it, so a lock left behind by a process that died is the only one that grows
+// older than the stale timeout, and is taken over then.
+package filelock
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+var (
+	// wait is how long Lock keeps trying before giving up
+	wait = 10 * time.Second
+	// stale is the age after which a lock is assumed to be abandoned
+	stale = 30 * time.Second
+	// heartbeat is how often the holder touches the lock to keep it fresh
+	heartbeat = 10 * time.Second
+	// poll is how often Lock retries while the file is locked
+	poll = 25 * time.Millisecond
+)
+
+// Lock takes the lock for path, waiting while another process holds it, and
+// returns the function that releases it.
+func Lock(path string) (func(), error) {
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(wait)
+
+	for {
+		file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			fmt.Fprintf(file, "%d\n", os.Getpid())
+			file.Close()
+			return hold(lockPath), nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("failed to lock %s: %v", path, err)
+		}
+
+		// Take over a lock whose owner died without releasing it
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > stale {
+			takeOver(lockPath, info)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for the lock on %s (remove %s if no gspotty is running)", path, lockPath)
+		}
+		time.Sleep(poll)
+	}
+}
+
+// hold keeps the lock fresh until the returned function releases it
+func hold(lockPath string) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				now := time.Now()
+				os.Chtimes(lockPath, now, now)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+		os.Remove(lockPath)
+	}
+}
+
+// takeOver removes the stale lock described by info. Another process may have
+// taken it over and locked again since info was read, so the lock is renamed
+// aside first and put back if it turns out to be a different one.
+func takeOver(lockPath string, info fs.FileInfo) {
+	aside := fmt.Sprintf("%s.stale.%d", lockPath, os.Getpid())
+	if err := os.Rename(lockPath, aside); err != nil {
+		return
+	}
+	defer os.Remove(aside)
+
+	moved, err := os.Stat(aside)
+	if err != nil || (os.SameFile(info, moved) && moved.ModTime().Equal(info.ModTime())) {
+		return
+	}
+
+	// The link fails if yet another process has locked meanwhile
+	os.Link(aside, lockPath)
+}
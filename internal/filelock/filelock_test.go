@@ -0,0 +1,113 @@
+package filelock
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLock tests that holders of the lock take turns
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+
+	var (
+		mu      sync.Mutex
+		holders int
+		overlap bool
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock, err := Lock(path)
+			if !assert.NoError(t, err) {
+				return
+			}
+			mu.Lock()
+			holders++
+			overlap = overlap || holders > 1
+			mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mu.Lock()
+			holders--
+			mu.Unlock()
+			unlock()
+		}()
+	}
+	wg.Wait()
+	assert.False(t, overlap)
+
+	_, err := os.Stat(path + ".lock")
+	assert.True(t, os.IsNotExist(err))
+}
+
+// TestStaleLock tests that an abandoned lock is taken over and a held one times out
+func TestStaleLock(t *testing.T) {
+	originalWait, originalStale := wait, stale
+	defer func() { wait, stale = originalWait, originalStale }()
+	wait = 100 * time.Millisecond
+
+	path := filepath.Join(t.TempDir(), "token.json")
+	require.NoError(t, os.WriteFile(path+".lock", []byte("1\n"), 0600))
+
+	_, err := Lock(path)
+	assert.Error(t, err)
+
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(path+".lock", old, old))
+	unlock, err := Lock(path)
+	require.NoError(t, err)
+	unlock()
+}
+
+// TestHeldLockStaysFresh tests that a lock held for longer than the stale
+// timeout is not taken over
+func TestHeldLockStaysFresh(t *testing.T) {
+	originalWait, originalStale, originalHeartbeat := wait, stale, heartbeat
+	defer func() { wait, stale, heartbeat = originalWait, originalStale, originalHeartbeat }()
+	wait, stale, heartbeat = 100*time.Millisecond, 50*time.Millisecond, 10*time.Millisecond
+
+	path := filepath.Join(t.TempDir(), "token.json")
+	unlock, err := Lock(path)
+	require.NoError(t, err)
+	defer unlock()
+
+	time.Sleep(2 * stale)
+	_, err = Lock(path)
+	assert.Error(t, err)
+}
+
+// TestTakeOverRace tests that a stale lock replaced by a fresh one after it
+// was found stale is left in place
+func TestTakeOverRace(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), "token.json.lock")
+	require.NoError(t, os.WriteFile(lockPath, []byte("1\n"), 0600))
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(lockPath, old, old))
+	info, err := os.Stat(lockPath)
+	require.NoError(t, err)
+
+	// Another process takes the stale lock over and locks again
+	require.NoError(t, os.Remove(lockPath))
+	require.NoError(t, os.WriteFile(lockPath, []byte("2\n"), 0600))
+
+	takeOver(lockPath, info)
+	data, err := os.ReadFile(lockPath)
+	require.NoError(t, err)
+	assert.Equal(t, "2\n", string(data))
+
+	// A lock that is still the stale one is removed
+	info, err = os.Stat(lockPath)
+	require.NoError(t, err)
+	takeOver(lockPath, info)
+	_, err = os.Stat(lockPath)
+	assert.True(t, os.IsNotExist(err))
+}
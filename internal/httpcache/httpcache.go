@@ -0,0 +1,368 @@
+// Package httpcache keeps Spotify Web API responses on disk so catalog
+// objects are not downloaded again every time they are opened.
+package httpcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTTL is how long tracks, albums and artists are served without asking Spotify
+	DefaultTTL = 7 * 24 * time.Hour
+	// DefaultMaxBytes bounds the size of the cache; the least recently used responses go first
+	DefaultMaxBytes = 50 << 20
+	// DefaultAPIPath is the path of the Spotify Web API base URL
+	DefaultAPIPath = "/v1/"
+
+	entryExt = ".json"
+)
+
+// immutablePrefixes are the catalog objects whose content does not change
+// once published. Prefixes are endpoints below the API base path.
+var immutablePrefixes = []string{"tracks", "albums", "artists"}
+
+// revalidatedPrefixes change whenever their owner edits them, so they are
+// only served after Spotify confirms their ETag
+var revalidatedPrefixes = []string{"playlists"}
+
+// recordedPrefixes are saved for offline browsing but never served, since
+// their results change all the time
+var recordedPrefixes = []string{"search"}
+
+// entry is a cached response as stored on disk
+type entry struct {
+	URL string `json:"url"`
+	// Endpoint is the path below the API base path, such as "albums/abc/tracks"
+	Endpoint string      `json:"endpoint,omitempty"`
+	ETag     string      `json:"etag,omitempty"`
+	Stored   time.Time   `json:"stored"`
+	Header   http.Header `json:"header"`
+	Body     []byte      `json:"body"`
+}
+
+// Transport serves GET requests for catalog objects from a directory of cached
+// responses. Tracks, albums and artists are served for TTL without a request;
+// playlists are revalidated with If-None-Match every time. Search results are
+// saved for offline browsing but always fetched. Everything else is passed to
+// Base untouched.
+type Transport struct {
+	Base     http.RoundTripper
+	Dir      string
+	TTL      time.Duration
+	MaxBytes int64
+	// APIPath is the path of the Web API base URL, which a gateway or proxy
+	// may change; catalog endpoints are matched below it
+	APIPath string
+	// Account names the login the responses are fetched for. The token
+	// decides the market and which private playlists can be seen, so each
+	// account keeps its own entries.
+	Account string
+
+	// now returns the current time; tests replace it
+	now func() time.Time
+}
+
+// New returns a transport caching in dir on top of base, or
+// http.DefaultTransport when base is nil
+func New(dir string, base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{
+		Base:     base,
+		Dir:      dir,
+		TTL:      DefaultTTL,
+		MaxBytes: DefaultMaxBytes,
+		APIPath:  DefaultAPIPath,
+		now:      time.Now,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.Base.RoundTrip(req)
+	}
+	endpoint, ok := endpointOf(t.APIPath, req.URL.Path)
+	immutable := ok && hasPrefix(endpoint, immutablePrefixes)
+	recorded := ok && hasPrefix(endpoint, recordedPrefixes)
+	if !immutable && !recorded && !(ok && hasPrefix(endpoint, revalidatedPrefixes)) {
+		return t.Base.RoundTrip(req)
+	}
+
+	key := t.key(req)
+	var cached *entry
+	if !recorded {
+		cached, _ = t.load(key)
+	}
+	if cached != nil && immutable && t.now().Sub(cached.Stored) < t.TTL {
+		t.touch(key)
+		return cached.response(req), nil
+	}
+
+	if cached != nil && cached.ETag != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		resp.Body.Close()
+		cached.Stored = t.now()
+		t.save(key, cached)
+		return cached.response(req), nil
+	case resp.StatusCode == http.StatusOK:
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		t.save(key, &entry{
+			URL:      req.URL.String(),
+			Endpoint: endpoint,
+			ETag:     resp.Header.Get("ETag"),
+			Stored:   t.now(),
+			Header:   storedHeader(resp.Header),
+			Body:     body,
+		})
+	}
+	return resp, nil
+}
+
+// key names the cache file of a request. Responses differ between accounts,
+// markets and languages, so the account and the headers that select them are
+// part of the key.
+func (t *Transport) key(req *http.Request) string {
+	sum := sha256.Sum256([]byte(t.Account + "\n" + req.URL.String() + "\n" + req.Header.Get("Accept-Language")))
+	return hex.EncodeToString(sum[:])
+}
+
+// path returns the file holding the entry with the key
+func (t *Transport) path(key string) string {
+	return filepath.Join(t.Dir, key+entryExt)
+}
+
+// load reads a cached entry, returning nil if there is none
+func (t *Transport) load(key string) (*entry, error) {
+	return readEntry(t.path(key))
+}
+
+// readEntry reads the cached entry in a file
+func readEntry(path string) (*entry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// save writes an entry and trims the cache to its size limit. The cache only
+// saves bandwidth, so failing to write it is not an error.
+func (t *Transport) save(key string, e *entry) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(t.Dir, 0700); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(t.Dir, key+".*.tmp")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		return
+	}
+	if err := os.Rename(tmp.Name(), t.path(key)); err != nil {
+		return
+	}
+	t.touch(key)
+	t.prune()
+}
+
+// touch marks an entry as recently used, so pruning keeps it
+func (t *Transport) touch(key string) {
+	now := t.now()
+	os.Chtimes(t.path(key), now, now)
+}
+
+// prune removes the least recently used entries until the cache fits MaxBytes
+func (t *Transport) prune() {
+	files, err := os.ReadDir(t.Dir)
+	if err != nil {
+		return
+	}
+
+	var (
+		entries []os.FileInfo
+		total   int64
+	)
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), entryExt) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, info)
+		total += info.Size()
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ModTime().Before(entries[j].ModTime())
+	})
+	for _, info := range entries {
+		if total <= t.MaxBytes {
+			break
+		}
+		if err := os.Remove(filepath.Join(t.Dir, info.Name())); err == nil {
+			total -= info.Size()
+		}
+	}
+}
+
+// response rebuilds the HTTP response of a cached entry
+func (e *entry) response(req *http.Request) *http.Response {
+	header := e.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// storedHeader keeps the response headers a cached response needs
+func storedHeader(header http.Header) http.Header {
+	stored := http.Header{}
+	for _, name := range []string{"Content-Type", "ETag"} {
+		if value := header.Get(name); value != "" {
+			stored.Set(name, value)
+		}
+	}
+	return stored
+}
+
+// endpointOf returns the part of path below apiPath, or false when the path
+// is not below it
+func endpointOf(apiPath, path string) (string, bool) {
+	base := strings.TrimSuffix(apiPath, "/") + "/"
+	if !strings.HasPrefix(base, "/") {
+		base = "/" + base
+	}
+	return strings.CutPrefix(path, base)
+}
+
+// hasPrefix reports whether the path is, or is below, one of the prefixes
+func hasPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Each calls fn with every cached response in dir, oldest first. The URL is
+// relative to the API base URL, such as "albums/abc/tracks?offset=50", so it
+// does not depend on where the API was served. Unreadable entries are skipped.
+func Each(dir string, fn func(u *url.URL, body []byte)) error {
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read cache: %v", err)
+	}
+
+	var entries []*entry
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), entryExt) {
+			continue
+		}
+		e, err := readEntry(filepath.Join(dir, file.Name()))
+		if err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Stored.Before(entries[j].Stored)
+	})
+	for _, e := range entries {
+		u, err := url.Parse(e.URL)
+		if err != nil {
+			continue
+		}
+		// Entries saved before endpoints were recorded came from the default API path
+		endpoint := e.Endpoint
+		if endpoint == "" {
+			var ok bool
+			if endpoint, ok = endpointOf(DefaultAPIPath, u.Path); !ok {
+				continue
+			}
+		}
+		fn(&url.URL{Path: endpoint, RawQuery: u.RawQuery}, e.Body)
+	}
+	return nil
+}
+
+// Clear removes every cached response in dir and returns how many there were
+func Clear(dir string) (int, error) {
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read cache: %v", err)
+	}
+	removed := 0
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, file.Name())); err != nil {
+			return removed, fmt.Errorf("failed to clear cache: %v", err)
+		}
+		if strings.HasSuffix(file.Name(), entryExt) {
+			removed++
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,211 @@
+package httpcache
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// catalogServer is a Spotify-like server that counts its requests and
+// supports ETags for playlists
+type catalogServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []string
+	version  int
+}
+
+func newCatalogServer(t *testing.T) *catalogServer {
+	s := &catalogServer{version: 1}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasPrefix(r.URL.Path, "/v1/playlists/") {
+			etag := fmt.Sprintf(`"v%d"`, s.version)
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", etag)
+			fmt.Fprintf(w, `{"snapshot_id":"%d"}`, s.version)
+			return
+		}
+		fmt.Fprintf(w, `{"path":%q}`, r.URL.Path)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Requests returns the requests the server received
+func (s *catalogServer) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// get fetches a path through the transport and returns the status and body
+func get(t *testing.T, transport http.RoundTripper, url string) (int, string) {
+	resp, err := (&http.Client{Transport: transport}).Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+// TestImmutable tests that tracks and albums are served from disk until their TTL expires
+func TestImmutable(t *testing.T) {
+	server := newCatalogServer(t)
+	now := time.Now()
+	transport := New(t.TempDir(), nil)
+	transport.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		status, body := get(t, transport, server.URL+"/v1/albums/abc/tracks")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, `{"path":"/v1/albums/abc/tracks"}`, body)
+	}
+	assert.Equal(t, []string{"GET /v1/albums/abc/tracks"}, server.Requests())
+
+	// A new transport on the same directory, as in the next run, uses the cache too
+	next := New(transport.Dir, nil)
+	next.now = transport.now
+	get(t, next, server.URL+"/v1/albums/abc/tracks")
+	assert.Len(t, server.Requests(), 1)
+
+	// Another account keeps its own responses
+	other := New(transport.Dir, nil)
+	other.now = transport.now
+	other.Account = "work"
+	get(t, other, server.URL+"/v1/albums/abc/tracks")
+	get(t, other, server.URL+"/v1/albums/abc/tracks")
+	assert.Len(t, server.Requests(), 2)
+
+	// Searches and the player are never cached
+	get(t, transport, server.URL+"/v1/search?q=abc")
+	get(t, transport, server.URL+"/v1/search?q=abc")
+	get(t, transport, server.URL+"/v1/me/player")
+	assert.Len(t, server.Requests(), 5)
+
+	now = now.Add(DefaultTTL + time.Minute)
+	get(t, transport, server.URL+"/v1/albums/abc/tracks")
+	assert.Len(t, server.Requests(), 6)
+}
+
+// TestRevalidate tests that playlists are checked against their ETag on every request
+func TestRevalidate(t *testing.T) {
+	server := newCatalogServer(t)
+	transport := New(t.TempDir(), nil)
+
+	_, body := get(t, transport, server.URL+"/v1/playlists/xyz")
+	assert.Equal(t, `{"snapshot_id":"1"}`, body)
+	status, body := get(t, transport, server.URL+"/v1/playlists/xyz")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"snapshot_id":"1"}`, body)
+	assert.Len(t, server.Requests(), 2)
+
+	// An edited playlist has a new ETag, so the new version is returned and cached
+	server.mu.Lock()
+	server.version = 2
+	server.mu.Unlock()
+	_, body = get(t, transport, server.URL+"/v1/playlists/xyz")
+	assert.Equal(t, `{"snapshot_id":"2"}`, body)
+	_, body = get(t, transport, server.URL+"/v1/playlists/xyz")
+	assert.Equal(t, `{"snapshot_id":"2"}`, body)
+	assert.Len(t, server.Requests(), 4)
+}
+
+// TestPrune tests that the least recently used responses are removed to respect MaxBytes
+func TestPrune(t *testing.T) {
+	server := newCatalogServer(t)
+	now := time.Now()
+	transport := New(t.TempDir(), nil)
+	transport.now = func() time.Time { return now }
+
+	get(t, transport, server.URL+"/v1/tracks/1")
+	files, err := os.ReadDir(transport.Dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	info, err := files[0].Info()
+	require.NoError(t, err)
+
+	// Room for two responses; track 1 is used again, so track 2 is the oldest
+	transport.MaxBytes = 2*info.Size() + 10
+	now = now.Add(time.Second)
+	get(t, transport, server.URL+"/v1/tracks/2")
+	now = now.Add(time.Second)
+	get(t, transport, server.URL+"/v1/tracks/1")
+	now = now.Add(time.Second)
+	get(t, transport, server.URL+"/v1/tracks/3")
+
+	files, err = os.ReadDir(transport.Dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	before := len(server.Requests())
+	get(t, transport, server.URL+"/v1/tracks/1")
+	get(t, transport, server.URL+"/v1/tracks/3")
+	assert.Len(t, server.Requests(), before)
+	get(t, transport, server.URL+"/v1/tracks/2")
+	assert.Len(t, server.Requests(), before+1)
+}
+
+// TestAPIPath tests caching when the Web API is served below another path,
+// as through a gateway, and that cached URLs are listed relative to it
+func TestAPIPath(t *testing.T) {
+	server := newCatalogServer(t)
+	transport := New(t.TempDir(), nil)
+	transport.APIPath = "/gateway/spotify/v1/"
+
+	get(t, transport, server.URL+"/gateway/spotify/v1/albums/abc/tracks?offset=50")
+	get(t, transport, server.URL+"/gateway/spotify/v1/albums/abc/tracks?offset=50")
+	get(t, transport, server.URL+"/gateway/spotify/v1/search?q=abc")
+	assert.Len(t, server.Requests(), 2)
+
+	// Paths outside the API are passed through
+	get(t, transport, server.URL+"/v1/albums/abc/tracks")
+	get(t, transport, server.URL+"/v1/albums/abc/tracks")
+	assert.Len(t, server.Requests(), 4)
+
+	var urls []string
+	require.NoError(t, Each(transport.Dir, func(u *url.URL, body []byte) {
+		urls = append(urls, u.String())
+	}))
+	assert.ElementsMatch(t, []string{"albums/abc/tracks?offset=50", "search?q=abc"}, urls)
+}
+
+// TestClear tests removing every cached response
+func TestClear(t *testing.T) {
+	server := newCatalogServer(t)
+	dir := filepath.Join(t.TempDir(), "responses")
+
+	removed, err := Clear(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 0, removed)
+
+	transport := New(dir, nil)
+	get(t, transport, server.URL+"/v1/tracks/1")
+	get(t, transport, server.URL+"/v1/artists/2")
+
+	removed, err = Clear(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+
+	get(t, transport, server.URL+"/v1/tracks/1")
+	assert.Len(t, server.Requests(), 3)
+}
@@ -6,6 +6,8 @@ import (
 	"strconv"
 
 	"github.com/gdamore/tcell/v2"
+	"github.com/iamgaru/gspotty/internal/api"
+	"github.com/iamgaru/gspotty/internal/config"
 	"github.com/iamgaru/gspotty/internal/ui"
 	"github.com/rivo/tview"
 	"github.com/zmb3/spotify/v2"
@@ -15,13 +17,13 @@ import (
 type InteractiveMenu struct {
 	app         *tview.Application
 	pages       *tview.Pages
-	client      *spotify.Client
+	client      api.Client
 	ctx         context.Context
 	keepPlaying bool // Whether to keep music playing when exiting player
 }
 
 // NewInteractiveMenu creates a new interactive menu
-func NewInteractiveMenu(ctx context.Context, client *spotify.Client) *InteractiveMenu {
+func NewInteractiveMenu(ctx context.Context, client api.Client) *InteractiveMenu {
 	app := tview.NewApplication()
 	pages := tview.NewPages()
 
@@ -30,7 +32,7 @@ func NewInteractiveMenu(ctx context.Context, client *spotify.Client) *Interactiv
 		pages:       pages,
 		client:      client,
 		ctx:         ctx,
-		keepPlaying: false, // Default to false
+		keepPlaying: config.Active().KeepPlaying,
 	}
 
 	return menu
@@ -58,9 +60,18 @@ func (menu *InteractiveMenu) createMainMenu() tview.Primitive {
 	form := tview.NewForm()
 	form.SetBorder(true).SetTitle("Spotify Search").SetTitleAlign(tview.AlignCenter)
 
+	// The form starts from the configured defaults
+	settings := config.Active()
+
 	// Add a dropdown for search type
-	searchType := "track" // Default value
-	form.AddDropDown("Search Type", []string{"track", "album", "playlist"}, 0, func(option string, optionIndex int) {
+	searchType := settings.SearchType
+	initialType := 0
+	for i, option := range config.SearchTypes {
+		if option == searchType {
+			initialType = i
+		}
+	}
+	form.AddDropDown("Search Type", config.SearchTypes, initialType, func(option string, optionIndex int) {
 		searchType = option
 	})
 
@@ -77,8 +88,8 @@ func (menu *InteractiveMenu) createMainMenu() tview.Primitive {
 	})
 
 	// Add an input field for limit
-	var limitStr string
-	form.AddInputField("Number of Results (1-50)", "5", 10, func(textToCheck string, lastChar rune) bool {
+	limitStr := strconv.Itoa(settings.Limit)
+	form.AddInputField("Number of Results (1-50)", limitStr, 10, func(textToCheck string, lastChar rune) bool {
 		// Only allow numbers
 		if len(textToCheck) > 0 {
 			_, err := strconv.Atoi(textToCheck)
@@ -90,8 +101,8 @@ func (menu *InteractiveMenu) createMainMenu() tview.Primitive {
 	})
 
 	// Add a checkbox for detailed results
-	var showDetails bool
-	form.AddCheckbox("Show Detailed Results", false, func(checked bool) {
+	showDetails := settings.ShowDetails
+	form.AddCheckbox("Show Detailed Results", showDetails, func(checked bool) {
 		showDetails = checked
 	})
 
@@ -104,7 +115,7 @@ func (menu *InteractiveMenu) createMainMenu() tview.Primitive {
 		}
 
 		// Parse limit
-		limit := 5 // Default
+		limit := settings.Limit
 		if limitStr != "" {
 			var err error
 			limit, err = strconv.Atoi(limitStr)
@@ -0,0 +1,635 @@
+// Package offline browses the catalog responses gspotty has cached, so tracks,
+// albums and playlists seen before can still be searched when Spotify cannot
+// be reached.
+package offline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iamgaru/gspotty/internal/api"
+	"github.com/iamgaru/gspotty/internal/httpcache"
+	"github.com/zmb3/spotify/v2"
+)
+
+const (
+	// maxResults caps a search when no limit is set, like the Spotify Web API
+	maxResults = 50
+	// retryOnline is how long catalog lookups stay on the cache before trying Spotify again
+	retryOnline = time.Minute
+)
+
+// Client answers searches and catalog lookups from cached responses. Anything
+// that needs Spotify, such as playback, fails with api.ErrOffline.
+type Client struct {
+	// Limit caps the number of search results of each type
+	Limit int
+
+	tracks         map[spotify.ID]spotify.FullTrack
+	albums         map[spotify.ID]spotify.SimpleAlbum
+	albumTracks    map[spotify.ID][]spotify.SimpleTrack
+	playlists      map[spotify.ID]spotify.SimplePlaylist
+	playlistTracks map[spotify.ID][]spotify.PlaylistTrack
+}
+
+// Ensure the offline client satisfies the interface
+var _ api.Client = (*Client)(nil)
+
+// Open indexes the cached responses in dir
+func Open(dir string) (*Client, error) {
+	c := &Client{
+		tracks:         make(map[spotify.ID]spotify.FullTrack),
+		albums:         make(map[spotify.ID]spotify.SimpleAlbum),
+		albumTracks:    make(map[spotify.ID][]spotify.SimpleTrack),
+		playlists:      make(map[spotify.ID]spotify.SimplePlaylist),
+		playlistTracks: make(map[spotify.ID][]spotify.PlaylistTrack),
+	}
+	if err := httpcache.Each(dir, c.add); err != nil {
+		return nil, err
+	}
+
+	// Album track lists leave out the album, which is known by now
+	for albumID, tracks := range c.albumTracks {
+		for _, track := range tracks {
+			if _, ok := c.tracks[track.ID]; !ok && track.ID != "" {
+				c.tracks[track.ID] = spotify.FullTrack{SimpleTrack: track, Album: c.albums[albumID]}
+			}
+		}
+	}
+	return c, nil
+}
+
+// add indexes a cached response by the endpoint it came from. Responses that
+// cannot be decoded are skipped.
+func (c *Client) add(u *url.URL, body []byte) {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	first := u.Query().Get("offset") == "" || u.Query().Get("offset") == "0"
+
+	switch {
+	case len(parts) == 1 && parts[0] == "search":
+		var result spotify.SearchResult
+		if json.Unmarshal(body, &result) != nil {
+			return
+		}
+		if result.Tracks != nil {
+			for _, track := range result.Tracks.Tracks {
+				c.addTrack(track)
+			}
+		}
+		if result.Albums != nil {
+			for _, album := range result.Albums.Albums {
+				c.albums[album.ID] = album
+			}
+		}
+		if result.Playlists != nil {
+			for _, playlist := range result.Playlists.Playlists {
+				c.playlists[playlist.ID] = playlist
+			}
+		}
+
+	case len(parts) == 1 && parts[0] == "tracks":
+		var result struct {
+			Tracks []spotify.FullTrack `json:"tracks"`
+		}
+		if json.Unmarshal(body, &result) != nil {
+			return
+		}
+		for _, track := range result.Tracks {
+			c.addTrack(track)
+		}
+
+	case len(parts) == 2 && parts[0] == "tracks":
+		var track spotify.FullTrack
+		if json.Unmarshal(body, &track) == nil {
+			c.addTrack(track)
+		}
+
+	case len(parts) == 1 && parts[0] == "albums":
+		var result struct {
+			Albums []spotify.FullAlbum `json:"albums"`
+		}
+		if json.Unmarshal(body, &result) != nil {
+			return
+		}
+		for _, album := range result.Albums {
+			c.addAlbum(album)
+		}
+
+	case len(parts) == 2 && parts[0] == "albums":
+		var album spotify.FullAlbum
+		if json.Unmarshal(body, &album) == nil {
+			c.addAlbum(album)
+		}
+
+	case len(parts) == 3 && parts[0] == "albums" && parts[2] == "tracks" && first:
+		var page spotify.SimpleTrackPage
+		if json.Unmarshal(body, &page) == nil {
+			c.albumTracks[spotify.ID(parts[1])] = page.Tracks
+		}
+
+	case len(parts) == 2 && parts[0] == "playlists":
+		var playlist spotify.FullPlaylist
+		if json.Unmarshal(body, &playlist) != nil {
+			return
+		}
+		c.playlists[playlist.ID] = playlist.SimplePlaylist
+		c.playlistTracks[playlist.ID] = playlist.Tracks.Tracks
+		for _, item := range playlist.Tracks.Tracks {
+			c.addTrack(item.Track)
+		}
+
+	case len(parts) == 3 && parts[0] == "playlists" && parts[2] == "tracks" && first:
+		var page spotify.PlaylistItemPage
+		if json.Unmarshal(body, &page) != nil {
+			return
+		}
+		var tracks []spotify.PlaylistTrack
+		for _, item := range page.Items {
+			// Episodes cannot be played from a track list
+			if item.Track.Track == nil {
+				continue
+			}
+			tracks = append(tracks, spotify.PlaylistTrack{
+				AddedAt: item.AddedAt,
+				AddedBy: item.AddedBy,
+				IsLocal: item.IsLocal,
+				Track:   *item.Track.Track,
+			})
+			c.addTrack(*item.Track.Track)
+		}
+		c.playlistTracks[spotify.ID(parts[1])] = tracks
+	}
+}
+
+// addTrack indexes a track and the album it appears on
+func (c *Client) addTrack(track spotify.FullTrack) {
+	if track.ID == "" {
+		return
+	}
+	c.tracks[track.ID] = track
+	if _, ok := c.albums[track.Album.ID]; !ok && track.Album.ID != "" {
+		c.albums[track.Album.ID] = track.Album
+	}
+}
+
+// addAlbum indexes an album and its first page of tracks
+func (c *Client) addAlbum(album spotify.FullAlbum) {
+	if album.ID == "" {
+		return
+	}
+	c.albums[album.ID] = album.SimpleAlbum
+	if len(album.Tracks.Tracks) > 0 {
+		c.albumTracks[album.ID] = album.Tracks.Tracks
+	}
+}
+
+// Offline reports that the client answers from cached data
+func (c *Client) Offline() bool {
+	return true
+}
+
+// Search matches the query against the names, artists, albums and owners of
+// cached objects. Every word must match; field filters such as artist:Queen
+// match their value anywhere.
+func (c *Client) Search(ctx context.Context, query string, t spotify.SearchType, opts ...spotify.RequestOption) (*spotify.SearchResult, error) {
+	terms := searchTerms(query)
+	limit := c.Limit
+	if limit <= 0 || limit > maxResults {
+		limit = maxResults
+	}
+	result := &spotify.SearchResult{}
+
+	if t&spotify.SearchTypeTrack != 0 {
+		var tracks []spotify.FullTrack
+		for _, track := range c.tracks {
+			if matches(terms, track.Name, artistNames(track.Artists), track.Album.Name) {
+				tracks = append(tracks, track)
+			}
+		}
+		sort.Slice(tracks, func(i, j int) bool {
+			return less(tracks[i].Name, tracks[j].Name, string(tracks[i].ID), string(tracks[j].ID))
+		})
+		result.Tracks = &spotify.FullTrackPage{}
+		result.Tracks.Total = spotify.Numeric(len(tracks))
+		if len(tracks) > limit {
+			tracks = tracks[:limit]
+		}
+		result.Tracks.Tracks = tracks
+	}
+
+	if t&spotify.SearchTypeAlbum != 0 {
+		var albums []spotify.SimpleAlbum
+		for _, album := range c.albums {
+			if matches(terms, album.Name, artistNames(album.Artists)) {
+				albums = append(albums, album)
+			}
+		}
+		sort.Slice(albums, func(i, j int) bool {
+			return less(albums[i].Name, albums[j].Name, string(albums[i].ID), string(albums[j].ID))
+		})
+		result.Albums = &spotify.SimpleAlbumPage{}
+		result.Albums.Total = spotify.Numeric(len(albums))
+		if len(albums) > limit {
+			albums = albums[:limit]
+		}
+		result.Albums.Albums = albums
+	}
+
+	if t&spotify.SearchTypePlaylist != 0 {
+		var playlists []spotify.SimplePlaylist
+		for _, playlist := range c.playlists {
+			if matches(terms, playlist.Name, playlist.Owner.DisplayName, playlist.Description) {
+				playlists = append(playlists, playlist)
+			}
+		}
+		sort.Slice(playlists, func(i, j int) bool {
+			return less(playlists[i].Name, playlists[j].Name, string(playlists[i].ID), string(playlists[j].ID))
+		})
+		result.Playlists = &spotify.SimplePlaylistPage{}
+		result.Playlists.Total = spotify.Numeric(len(playlists))
+		if len(playlists) > limit {
+			playlists = playlists[:limit]
+		}
+		result.Playlists.Playlists = playlists
+	}
+
+	return result, nil
+}
+
+// GetTrack returns a cached track
+func (c *Client) GetTrack(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) (*spotify.FullTrack, error) {
+	track, ok := c.tracks[id]
+	if !ok {
+		return nil, errNotCached("track", id)
+	}
+	return &track, nil
+}
+
+// GetAlbum returns a cached album with the tracks cached for it
+func (c *Client) GetAlbum(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) (*spotify.FullAlbum, error) {
+	album, ok := c.albums[id]
+	if !ok {
+		return nil, errNotCached("album", id)
+	}
+	full := &spotify.FullAlbum{SimpleAlbum: album}
+	full.Tracks = *simpleTrackPage(c.albumTracks[id])
+	return full, nil
+}
+
+// GetAlbumTracks returns the cached tracks of an album
+func (c *Client) GetAlbumTracks(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) (*spotify.SimpleTrackPage, error) {
+	tracks, ok := c.albumTracks[id]
+	if !ok {
+		return nil, errNotCached("track list of album", id)
+	}
+	return simpleTrackPage(tracks), nil
+}
+
+// GetPlaylist returns a cached playlist with the tracks cached for it
+func (c *Client) GetPlaylist(ctx context.Context, playlistID spotify.ID, opts ...spotify.RequestOption) (*spotify.FullPlaylist, error) {
+	playlist, ok := c.playlists[playlistID]
+	if !ok {
+		return nil, errNotCached("playlist", playlistID)
+	}
+	full := &spotify.FullPlaylist{SimplePlaylist: playlist}
+	full.Tracks.Tracks = c.playlistTracks[playlistID]
+	full.Tracks.Total = spotify.Numeric(len(full.Tracks.Tracks))
+	return full, nil
+}
+
+// GetPlaylistItems returns the cached tracks of a playlist
+func (c *Client) GetPlaylistItems(ctx context.Context, playlistID spotify.ID, opts ...spotify.RequestOption) (*spotify.PlaylistItemPage, error) {
+	tracks, ok := c.playlistTracks[playlistID]
+	if !ok {
+		return nil, errNotCached("track list of playlist", playlistID)
+	}
+	page := &spotify.PlaylistItemPage{}
+	for _, track := range tracks {
+		track := track
+		page.Items = append(page.Items, spotify.PlaylistItem{
+			AddedAt: track.AddedAt,
+			AddedBy: track.AddedBy,
+			IsLocal: track.IsLocal,
+			Track:   spotify.PlaylistItemTrack{Track: &track.Track},
+		})
+	}
+	page.Total = spotify.Numeric(len(page.Items))
+	return page, nil
+}
+
+// GetUsersPublicProfile needs Spotify, since profiles are not cached
+func (c *Client) GetUsersPublicProfile(ctx context.Context, userID spotify.ID) (*spotify.User, error) {
+	return nil, fmt.Errorf("%w: looking up profiles needs a connection to Spotify", api.ErrOffline)
+}
+
+// errPlayback explains that playback needs Spotify
+func errPlayback() error {
+	return fmt.Errorf("%w: controlling playback needs a connection to Spotify", api.ErrOffline)
+}
+
+// The player calls all need Spotify
+
+func (c *Client) PlayerDevices(ctx context.Context) ([]spotify.PlayerDevice, error) {
+	return nil, errPlayback()
+}
+
+func (c *Client) PlayerState(ctx context.Context, opts ...spotify.RequestOption) (*spotify.PlayerState, error) {
+	return nil, errPlayback()
+}
+
+func (c *Client) Play(ctx context.Context) error {
+	return errPlayback()
+}
+
+func (c *Client) PlayOpt(ctx context.Context, opt *spotify.PlayOptions) error {
+	return errPlayback()
+}
+
+func (c *Client) Pause(ctx context.Context) error {
+	return errPlayback()
+}
+
+func (c *Client) PauseOpt(ctx context.Context, opt *spotify.PlayOptions) error {
+	return errPlayback()
+}
+
+func (c *Client) Next(ctx context.Context) error {
+	return errPlayback()
+}
+
+func (c *Client) NextOpt(ctx context.Context, opt *spotify.PlayOptions) error {
+	return errPlayback()
+}
+
+func (c *Client) Previous(ctx context.Context) error {
+	return errPlayback()
+}
+
+func (c *Client) PreviousOpt(ctx context.Context, opt *spotify.PlayOptions) error {
+	return errPlayback()
+}
+
+func (c *Client) TransferPlayback(ctx context.Context, deviceID spotify.ID, play bool) error {
+	return errPlayback()
+}
+
+func (c *Client) Seek(ctx context.Context, position int) error {
+	return errPlayback()
+}
+
+func (c *Client) Volume(ctx context.Context, percent int) error {
+	return errPlayback()
+}
+
+// errNotCached reports a lookup of something that was never cached
+func errNotCached(kind string, id spotify.ID) error {
+	return fmt.Errorf("%w: %s %s has not been cached", api.ErrOffline, kind, id)
+}
+
+// simpleTrackPage wraps tracks in a single page
+func simpleTrackPage(tracks []spotify.SimpleTrack) *spotify.SimpleTrackPage {
+	page := &spotify.SimpleTrackPage{Tracks: tracks}
+	page.Total = spotify.Numeric(len(tracks))
+	return page
+}
+
+// searchTerms splits a query into lowercase words, dropping field names such
+// as the artist: in artist:Queen
+func searchTerms(query string) []string {
+	var terms []string
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if i := strings.Index(word, ":"); i >= 0 {
+			word = word[i+1:]
+		}
+		word = strings.Trim(word, `"'`)
+		if word != "" {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// matches reports whether every term appears in one of the fields
+func matches(terms []string, fields ...string) bool {
+	text := strings.ToLower(strings.Join(fields, " "))
+	for _, term := range terms {
+		if !strings.Contains(text, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// artistNames joins the names of artists
+func artistNames(artists []spotify.SimpleArtist) string {
+	names := make([]string, len(artists))
+	for i, artist := range artists {
+		names[i] = artist.Name
+	}
+	return strings.Join(names, " ")
+}
+
+// less orders results by name, then by ID so the order is stable
+func less(nameA, nameB, idA, idB string) bool {
+	a, b := strings.ToLower(nameA), strings.ToLower(nameB)
+	if a != b {
+		return a < b
+	}
+	return idA < idB
+}
+
+// Unreachable reports whether an error means Spotify could not be reached
+// over the network. Errors Spotify answered with, even server errors, are not.
+func Unreachable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	if errors.As(err, &opErr) || errors.As(err, &dnsErr) {
+		return true
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && urlErr.Timeout()
+}
+
+// fallbackClient looks up the catalog on Spotify until it cannot be reached,
+// and then in the cache for a while
+type fallbackClient struct {
+	online api.Client
+	dir    string
+	limit  int
+
+	// now tells the time; tests replace it
+	now func() time.Time
+
+	mu    sync.Mutex
+	cache *Client
+	// until is when catalog lookups try Spotify again
+	until time.Time
+}
+
+// Fallback returns a client that looks up the catalog on online until a lookup
+// finds Spotify unreachable. Lookups are then answered from the responses
+// cached in dir, and go back to Spotify after a minute. Playback always goes
+// to Spotify.
+func Fallback(online api.Client, dir string, limit int) api.Client {
+	return &fallbackClient{online: online, dir: dir, limit: limit, now: time.Now}
+}
+
+// Offline reports whether catalog lookups are answered from the cache
+func (f *fallbackClient) Offline() bool {
+	return f.cached() != nil
+}
+
+// cached returns the offline client while lookups go to it
+func (f *fallbackClient) cached() *Client {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.cache == nil || !f.now().Before(f.until) {
+		return nil
+	}
+	return f.cache
+}
+
+// current returns the client catalog lookups go to
+func (f *fallbackClient) current() api.Client {
+	if cache := f.cached(); cache != nil {
+		return cache
+	}
+	return f.online
+}
+
+// fallBack switches lookups to the cache if err means Spotify is unreachable,
+// and returns the offline client to retry with
+func (f *fallbackClient) fallBack(err error) *Client {
+	if !Unreachable(err) {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.cache == nil {
+		cache, openErr := Open(f.dir)
+		if openErr != nil {
+			return nil
+		}
+		cache.Limit = f.limit
+		f.cache = cache
+	}
+	f.until = f.now().Add(retryOnline)
+	return f.cache
+}
+
+func (f *fallbackClient) Search(ctx context.Context, query string, t spotify.SearchType, opts ...spotify.RequestOption) (*spotify.SearchResult, error) {
+	result, err := f.current().Search(ctx, query, t, opts...)
+	if cache := f.fallBack(err); cache != nil {
+		return cache.Search(ctx, query, t, opts...)
+	}
+	return result, err
+}
+
+func (f *fallbackClient) GetTrack(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) (*spotify.FullTrack, error) {
+	track, err := f.current().GetTrack(ctx, id, opts...)
+	if cache := f.fallBack(err); cache != nil {
+		return cache.GetTrack(ctx, id, opts...)
+	}
+	return track, err
+}
+
+func (f *fallbackClient) GetAlbum(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) (*spotify.FullAlbum, error) {
+	album, err := f.current().GetAlbum(ctx, id, opts...)
+	if cache := f.fallBack(err); cache != nil {
+		return cache.GetAlbum(ctx, id, opts...)
+	}
+	return album, err
+}
+
+func (f *fallbackClient) GetAlbumTracks(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) (*spotify.SimpleTrackPage, error) {
+	tracks, err := f.current().GetAlbumTracks(ctx, id, opts...)
+	if cache := f.fallBack(err); cache != nil {
+		return cache.GetAlbumTracks(ctx, id, opts...)
+	}
+	return tracks, err
+}
+
+func (f *fallbackClient) GetPlaylist(ctx context.Context, playlistID spotify.ID, opts ...spotify.RequestOption) (*spotify.FullPlaylist, error) {
+	playlist, err := f.current().GetPlaylist(ctx, playlistID, opts...)
+	if cache := f.fallBack(err); cache != nil {
+		return cache.GetPlaylist(ctx, playlistID, opts...)
+	}
+	return playlist, err
+}
+
+func (f *fallbackClient) GetPlaylistItems(ctx context.Context, playlistID spotify.ID, opts ...spotify.RequestOption) (*spotify.PlaylistItemPage, error) {
+	items, err := f.current().GetPlaylistItems(ctx, playlistID, opts...)
+	if cache := f.fallBack(err); cache != nil {
+		return cache.GetPlaylistItems(ctx, playlistID, opts...)
+	}
+	return items, err
+}
+
+func (f *fallbackClient) GetUsersPublicProfile(ctx context.Context, userID spotify.ID) (*spotify.User, error) {
+	return f.current().GetUsersPublicProfile(ctx, userID)
+}
+
+// Playback is never cached, so the remaining calls always go to Spotify
+
+func (f *fallbackClient) PlayerDevices(ctx context.Context) ([]spotify.PlayerDevice, error) {
+	return f.online.PlayerDevices(ctx)
+}
+
+func (f *fallbackClient) PlayerState(ctx context.Context, opts ...spotify.RequestOption) (*spotify.PlayerState, error) {
+	return f.online.PlayerState(ctx, opts...)
+}
+
+func (f *fallbackClient) Play(ctx context.Context) error {
+	return f.online.Play(ctx)
+}
+
+func (f *fallbackClient) PlayOpt(ctx context.Context, opt *spotify.PlayOptions) error {
+	return f.online.PlayOpt(ctx, opt)
+}
+
+func (f *fallbackClient) Pause(ctx context.Context) error {
+	return f.online.Pause(ctx)
+}
+
+func (f *fallbackClient) PauseOpt(ctx context.Context, opt *spotify.PlayOptions) error {
+	return f.online.PauseOpt(ctx, opt)
+}
+
+func (f *fallbackClient) Next(ctx context.Context) error {
+	return f.online.Next(ctx)
+}
+
+func (f *fallbackClient) NextOpt(ctx context.Context, opt *spotify.PlayOptions) error {
+	return f.online.NextOpt(ctx, opt)
+}
+
+func (f *fallbackClient) Previous(ctx context.Context) error {
+	return f.online.Previous(ctx)
+}
+
+func (f *fallbackClient) PreviousOpt(ctx context.Context, opt *spotify.PlayOptions) error {
+	return f.online.PreviousOpt(ctx, opt)
+}
+
+func (f *fallbackClient) TransferPlayback(ctx context.Context, deviceID spotify.ID, play bool) error {
+	return f.online.TransferPlayback(ctx, deviceID, play)
+}
+
+func (f *fallbackClient) Seek(ctx context.Context, position int) error {
+	return f.online.Seek(ctx, position)
+}
+
+func (f *fallbackClient) Volume(ctx context.Context, percent int) error {
+	return f.online.Volume(ctx, percent)
+}
@@ -0,0 +1,187 @@
+package offline
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iamgaru/gspotty/internal/api"
+	"github.com/iamgaru/gspotty/internal/fakespotify"
+	"github.com/iamgaru/gspotty/internal/httpcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zmb3/spotify/v2"
+)
+
+// outage fails requests with a network error while down is set
+type outage struct {
+	base http.RoundTripper
+	down atomic.Bool
+}
+
+func (o *outage) RoundTrip(req *http.Request) (*http.Response, error) {
+	if o.down.Load() {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	}
+	return o.base.RoundTrip(req)
+}
+
+// newCachedServer returns a fake catalog and a client whose responses are
+// cached in a temporary directory, and the outage its requests go through
+func newCachedServer(t *testing.T) (*fakespotify.Server, *spotify.Client, string, *outage) {
+	server := fakespotify.NewServer()
+	t.Cleanup(server.Close)
+
+	queen := []spotify.SimpleArtist{{Name: "Queen", ID: "queen"}}
+	server.AddAlbum(spotify.SimpleAlbum{ID: "opera", Name: "A Night at the Opera", Artists: queen},
+		spotify.FullTrack{SimpleTrack: spotify.SimpleTrack{ID: "bohemian", Name: "Bohemian Rhapsody", Artists: queen}},
+		spotify.FullTrack{SimpleTrack: spotify.SimpleTrack{ID: "love", Name: "Love of My Life", Artists: queen}},
+	)
+	server.AddPlaylist(spotify.SimplePlaylist{ID: "classics", Name: "Rock Classics", Owner: spotify.User{DisplayName: "Spotify"}},
+		spotify.FullTrack{SimpleTrack: spotify.SimpleTrack{ID: "stairway", Name: "Stairway to Heaven", Artists: []spotify.SimpleArtist{{Name: "Led Zeppelin"}}}},
+	)
+
+	dir := t.TempDir()
+	network := &outage{base: server.Server.Client().Transport}
+	httpClient := &http.Client{Transport: httpcache.New(dir, network)}
+	return server, spotify.New(httpClient, spotify.WithBaseURL(server.APIURL())), dir, network
+}
+
+// TestClient tests searching and browsing the cached responses
+func TestClient(t *testing.T) {
+	server, online, dir, _ := newCachedServer(t)
+	ctx := context.Background()
+
+	// Browse online first, as the results UI would
+	_, err := online.Search(ctx, "bohemian", spotify.SearchTypeTrack)
+	require.NoError(t, err)
+	_, err = online.GetAlbumTracks(ctx, "opera")
+	require.NoError(t, err)
+	_, err = online.GetPlaylist(ctx, "classics")
+	require.NoError(t, err)
+	server.Close()
+
+	client, err := Open(dir)
+	require.NoError(t, err)
+	assert.True(t, api.IsOffline(client))
+
+	results, err := client.Search(ctx, "bohemian", spotify.SearchTypeTrack|spotify.SearchTypeAlbum)
+	require.NoError(t, err)
+	require.Len(t, results.Tracks.Tracks, 1)
+	assert.Equal(t, "Bohemian Rhapsody", results.Tracks.Tracks[0].Name)
+	assert.Empty(t, results.Albums.Albums)
+
+	// The album is known from its track, and artist filters match the artist
+	results, err = client.Search(ctx, "opera artist:QUEEN", spotify.SearchTypeAlbum)
+	require.NoError(t, err)
+	require.Len(t, results.Albums.Albums, 1)
+	assert.Equal(t, spotify.ID("opera"), results.Albums.Albums[0].ID)
+
+	results, err = client.Search(ctx, "rock", spotify.SearchTypePlaylist)
+	require.NoError(t, err)
+	require.Len(t, results.Playlists.Playlists, 1)
+
+	// Tracks seen in an album or playlist can be searched too, up to the limit
+	client.Limit = 1
+	results, err = client.Search(ctx, "e", spotify.SearchTypeTrack)
+	require.NoError(t, err)
+	assert.Len(t, results.Tracks.Tracks, 1)
+	assert.Equal(t, spotify.Numeric(3), results.Tracks.Total)
+
+	tracks, err := client.GetAlbumTracks(ctx, "opera")
+	require.NoError(t, err)
+	assert.Len(t, tracks.Tracks, 2)
+
+	playlist, err := client.GetPlaylist(ctx, "classics")
+	require.NoError(t, err)
+	require.Len(t, playlist.Tracks.Tracks, 1)
+	items, err := client.GetPlaylistItems(ctx, "classics")
+	require.NoError(t, err)
+	require.Len(t, items.Items, 1)
+	assert.Equal(t, "Stairway to Heaven", items.Items[0].Track.Track.Name)
+
+	track, err := client.GetTrack(ctx, "love")
+	require.NoError(t, err)
+	assert.Equal(t, "A Night at the Opera", track.Album.Name)
+
+	_, err = client.GetAlbumTracks(ctx, "unknown")
+	assert.ErrorIs(t, err, api.ErrOffline)
+	_, err = client.PlayerDevices(ctx)
+	assert.ErrorIs(t, err, api.ErrOffline)
+	assert.ErrorIs(t, client.Pause(ctx), api.ErrOffline)
+}
+
+// TestFallback tests switching catalog lookups to the cache while Spotify
+// cannot be reached, and back once it can
+func TestFallback(t *testing.T) {
+	server, online, dir, network := newCachedServer(t)
+	server.AddDevice(spotify.PlayerDevice{ID: "laptop", Name: "Laptop", Active: true})
+	ctx := context.Background()
+
+	client := Fallback(online, dir, 10)
+	now := time.Now()
+	client.(*fallbackClient).now = func() time.Time { return now }
+
+	_, err := client.Search(ctx, "bohemian", spotify.SearchTypeTrack)
+	require.NoError(t, err)
+	assert.False(t, api.IsOffline(client))
+
+	// Errors Spotify answers with are returned as they are, server errors too
+	server.FailNext(http.MethodGet, "/v1/albums/opera/tracks", http.StatusNotFound, "non existing id")
+	_, err = client.GetAlbumTracks(ctx, "opera")
+	assert.Error(t, err)
+	assert.False(t, api.IsOffline(client))
+
+	server.FailNext(http.MethodGet, "/v1/search", http.StatusServiceUnavailable, "service unavailable")
+	_, err = client.Search(ctx, "queen", spotify.SearchTypeTrack)
+	assert.Error(t, err)
+	assert.False(t, api.IsOffline(client))
+
+	// A network outage switches lookups to the cache
+	network.down.Store(true)
+	results, err := client.Search(ctx, "queen", spotify.SearchTypeTrack)
+	require.NoError(t, err)
+	require.Len(t, results.Tracks.Tracks, 1)
+	assert.True(t, api.IsOffline(client))
+
+	// Playback still goes to Spotify, and works again as soon as it is back
+	play := &spotify.PlayOptions{URIs: []spotify.URI{"spotify:track:bohemian"}}
+	err = client.PlayOpt(ctx, play)
+	assert.True(t, Unreachable(err))
+	network.down.Store(false)
+	assert.NoError(t, client.PlayOpt(ctx, play))
+	assert.True(t, server.Playback().Playing)
+
+	// Lookups stay on the cache for a while
+	requests := len(server.Requests())
+	_, err = client.Search(ctx, "queen", spotify.SearchTypeTrack)
+	assert.NoError(t, err)
+	assert.Len(t, server.Requests(), requests)
+
+	// and then try Spotify again
+	now = now.Add(retryOnline)
+	_, err = client.Search(ctx, "queen", spotify.SearchTypeTrack)
+	assert.NoError(t, err)
+	assert.Len(t, server.Requests(), requests+1)
+	assert.False(t, api.IsOffline(client))
+}
+
+// TestUnreachable tests telling outages apart from refused requests
+func TestUnreachable(t *testing.T) {
+	server := fakespotify.NewServer()
+	client := server.Client()
+	server.Close()
+
+	_, err := client.Search(context.Background(), "queen", spotify.SearchTypeTrack)
+	assert.True(t, Unreachable(err))
+
+	// Spotify answered a server error, so it can be reached
+	assert.False(t, Unreachable(spotify.Error{Status: http.StatusBadGateway}))
+	assert.False(t, Unreachable(spotify.Error{Status: http.StatusUnauthorized}))
+	assert.False(t, Unreachable(errors.New("something else")))
+	assert.False(t, Unreachable(nil))
+}
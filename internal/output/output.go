@@ -0,0 +1,188 @@
+// Package output prints search results for scripts and pipes instead of the
+// interactive results view.
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/iamgaru/gspotty/internal/utils"
+	"github.com/zmb3/spotify/v2"
+)
+
+// Formats are the output formats, besides the interactive view
+var Formats = []string{"plain", "json", "csv", "tsv"}
+
+// Valid reports whether format is one of Formats
+func Valid(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// Track is a track result as printed
+type Track struct {
+	ID         string   `json:"id"`
+	URI        string   `json:"uri"`
+	Name       string   `json:"name"`
+	Artists    []string `json:"artists"`
+	Album      string   `json:"album"`
+	DurationMs int      `json:"duration_ms"`
+	Popularity int      `json:"popularity"`
+}
+
+// Album is an album result as printed
+type Album struct {
+	ID          string   `json:"id"`
+	URI         string   `json:"uri"`
+	Name        string   `json:"name"`
+	Artists     []string `json:"artists"`
+	ReleaseDate string   `json:"release_date"`
+	TotalTracks int      `json:"total_tracks"`
+}
+
+// Playlist is a playlist result as printed
+type Playlist struct {
+	ID          string `json:"id"`
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Owner       string `json:"owner"`
+	TotalTracks int    `json:"total_tracks"`
+}
+
+// table is a list of results in rows of text. plain holds the columns people
+// read, and data the raw values CSV and TSV carry.
+type table struct {
+	plainHeader []string
+	plain       [][]string
+	dataHeader  []string
+	data        [][]string
+}
+
+// WriteTracks prints tracks in the format
+func WriteTracks(w io.Writer, format string, tracks []spotify.FullTrack) error {
+	records := make([]Track, len(tracks))
+	t := table{
+		plainHeader: []string{"NAME", "ARTISTS", "ALBUM", "DURATION", "POPULARITY", "ID", "URI"},
+		dataHeader:  []string{"id", "uri", "name", "artists", "album", "duration_ms", "popularity"},
+	}
+	for i, track := range tracks {
+		r := Track{
+			ID:         string(track.ID),
+			URI:        string(track.URI),
+			Name:       track.Name,
+			Artists:    artistNames(track.Artists),
+			Album:      track.Album.Name,
+			DurationMs: int(track.Duration),
+			Popularity: int(track.Popularity),
+		}
+		records[i] = r
+		artists := strings.Join(r.Artists, ", ")
+		t.plain = append(t.plain, []string{r.Name, artists, r.Album, utils.FormatDuration(r.DurationMs), strconv.Itoa(r.Popularity), r.ID, r.URI})
+		t.data = append(t.data, []string{r.ID, r.URI, r.Name, artists, r.Album, strconv.Itoa(r.DurationMs), strconv.Itoa(r.Popularity)})
+	}
+	return write(w, format, records, t)
+}
+
+// WriteAlbums prints albums in the format
+func WriteAlbums(w io.Writer, format string, albums []spotify.SimpleAlbum) error {
+	records := make([]Album, len(albums))
+	t := table{
+		plainHeader: []string{"NAME", "ARTISTS", "RELEASED", "TRACKS", "ID", "URI"},
+		dataHeader:  []string{"id", "uri", "name", "artists", "release_date", "total_tracks"},
+	}
+	for i, album := range albums {
+		r := Album{
+			ID:          string(album.ID),
+			URI:         string(album.URI),
+			Name:        album.Name,
+			Artists:     artistNames(album.Artists),
+			ReleaseDate: album.ReleaseDate,
+			TotalTracks: int(album.TotalTracks),
+		}
+		records[i] = r
+		artists := strings.Join(r.Artists, ", ")
+		t.plain = append(t.plain, []string{r.Name, artists, r.ReleaseDate, strconv.Itoa(r.TotalTracks), r.ID, r.URI})
+		t.data = append(t.data, []string{r.ID, r.URI, r.Name, artists, r.ReleaseDate, strconv.Itoa(r.TotalTracks)})
+	}
+	return write(w, format, records, t)
+}
+
+// WritePlaylists prints playlists in the format
+func WritePlaylists(w io.Writer, format string, playlists []spotify.SimplePlaylist) error {
+	records := make([]Playlist, len(playlists))
+	t := table{
+		plainHeader: []string{"NAME", "OWNER", "TRACKS", "ID", "URI"},
+		dataHeader:  []string{"id", "uri", "name", "owner", "total_tracks"},
+	}
+	for i, playlist := range playlists {
+		owner := playlist.Owner.DisplayName
+		if owner == "" {
+			owner = playlist.Owner.ID
+		}
+		r := Playlist{
+			ID:          string(playlist.ID),
+			URI:         string(playlist.URI),
+			Name:        playlist.Name,
+			Owner:       owner,
+			TotalTracks: int(playlist.Tracks.Total),
+		}
+		records[i] = r
+		t.plain = append(t.plain, []string{r.Name, r.Owner, strconv.Itoa(r.TotalTracks), r.ID, r.URI})
+		t.data = append(t.data, []string{r.ID, r.URI, r.Name, r.Owner, strconv.Itoa(r.TotalTracks)})
+	}
+	return write(w, format, records, t)
+}
+
+// write prints the records as JSON, or their table in the other formats
+func write(w io.Writer, format string, records interface{}, t table) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	case "csv", "tsv":
+		writer := csv.NewWriter(w)
+		if format == "tsv" {
+			writer.Comma = '\t'
+		}
+		writer.Write(t.dataHeader)
+		writer.WriteAll(t.data)
+		return writer.Error()
+	case "plain":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(t.plainHeader, "\t"))
+		for _, row := range t.plain {
+			fmt.Fprintln(tw, strings.Join(cleanCells(row), "\t"))
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q. Must be one of: %s", format, strings.Join(Formats, ", "))
+	}
+}
+
+// cleanCells replaces the tabs and newlines that would break a plain row
+func cleanCells(row []string) []string {
+	cleaned := make([]string, len(row))
+	for i, cell := range row {
+		cleaned[i] = strings.Join(strings.Fields(cell), " ")
+	}
+	return cleaned
+}
+
+// artistNames returns the names of the artists
+func artistNames(artists []spotify.SimpleArtist) []string {
+	names := make([]string, len(artists))
+	for i, artist := range artists {
+		names[i] = artist.Name
+	}
+	return names
+}
@@ -0,0 +1,128 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zmb3/spotify/v2"
+)
+
+var testTracks = []spotify.FullTrack{
+	{
+		SimpleTrack: spotify.SimpleTrack{
+			ID:       "track1",
+			URI:      "spotify:track:track1",
+			Name:     "Bohemian Rhapsody",
+			Artists:  []spotify.SimpleArtist{{Name: "Queen"}},
+			Duration: 354000,
+		},
+		Album:      spotify.SimpleAlbum{Name: "A Night at the Opera"},
+		Popularity: 91,
+	},
+	{
+		SimpleTrack: spotify.SimpleTrack{
+			ID:       "track2",
+			URI:      "spotify:track:track2",
+			Name:     "Under Pressure",
+			Artists:  []spotify.SimpleArtist{{Name: "Queen"}, {Name: "David Bowie"}},
+			Duration: 248000,
+		},
+		Album:      spotify.SimpleAlbum{Name: "Hot Space"},
+		Popularity: 85,
+	},
+}
+
+// TestWriteTracks tests every format with the same tracks
+func TestWriteTracks(t *testing.T) {
+	t.Run("Plain", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, WriteTracks(&out, "plain", testTracks))
+		assert.Equal(t, ""+
+			"NAME               ARTISTS             ALBUM                 DURATION  POPULARITY  ID      URI\n"+
+			"Bohemian Rhapsody  Queen               A Night at the Opera  5:54      91          track1  spotify:track:track1\n"+
+			"Under Pressure     Queen, David Bowie  Hot Space             4:08      85          track2  spotify:track:track2\n",
+			out.String())
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, WriteTracks(&out, "csv", testTracks))
+		assert.Equal(t, ""+
+			"id,uri,name,artists,album,duration_ms,popularity\n"+
+			"track1,spotify:track:track1,Bohemian Rhapsody,Queen,A Night at the Opera,354000,91\n"+
+			"track2,spotify:track:track2,Under Pressure,\"Queen, David Bowie\",Hot Space,248000,85\n",
+			out.String())
+	})
+
+	t.Run("TSV", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, WriteTracks(&out, "tsv", testTracks[1:]))
+		assert.Equal(t, ""+
+			"id\turi\tname\tartists\talbum\tduration_ms\tpopularity\n"+
+			"track2\tspotify:track:track2\tUnder Pressure\tQueen, David Bowie\tHot Space\t248000\t85\n",
+			out.String())
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, WriteTracks(&out, "json", testTracks))
+		var tracks []Track
+		require.NoError(t, json.Unmarshal(out.Bytes(), &tracks))
+		assert.Equal(t, Track{
+			ID:         "track2",
+			URI:        "spotify:track:track2",
+			Name:       "Under Pressure",
+			Artists:    []string{"Queen", "David Bowie"},
+			Album:      "Hot Space",
+			DurationMs: 248000,
+			Popularity: 85,
+		}, tracks[1])
+	})
+
+	t.Run("No Results", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, WriteTracks(&out, "json", nil))
+		assert.Equal(t, "[]\n", out.String())
+	})
+
+	t.Run("Unknown Format", func(t *testing.T) {
+		assert.Error(t, WriteTracks(&bytes.Buffer{}, "xml", testTracks))
+		assert.False(t, Valid("xml"))
+		assert.True(t, Valid("tsv"))
+	})
+}
+
+// TestWriteAlbumsAndPlaylists tests the columns of albums and playlists
+func TestWriteAlbumsAndPlaylists(t *testing.T) {
+	albums := []spotify.SimpleAlbum{{
+		ID:          "album1",
+		URI:         "spotify:album:album1",
+		Name:        "A Night at the Opera",
+		Artists:     []spotify.SimpleArtist{{Name: "Queen"}},
+		ReleaseDate: "1975-11-21",
+		TotalTracks: 12,
+	}}
+	var out bytes.Buffer
+	require.NoError(t, WriteAlbums(&out, "csv", albums))
+	assert.Equal(t, ""+
+		"id,uri,name,artists,release_date,total_tracks\n"+
+		"album1,spotify:album:album1,A Night at the Opera,Queen,1975-11-21,12\n",
+		out.String())
+
+	playlist := spotify.SimplePlaylist{
+		ID:    "playlist1",
+		URI:   "spotify:playlist:playlist1",
+		Name:  "Queen\tClassics",
+		Owner: spotify.User{ID: "spotify"},
+	}
+	playlist.Tracks.Total = 3
+	out.Reset()
+	require.NoError(t, WritePlaylists(&out, "plain", []spotify.SimplePlaylist{playlist}))
+	assert.Equal(t, ""+
+		"NAME            OWNER    TRACKS  ID         URI\n"+
+		"Queen Classics  spotify  3       playlist1  spotify:playlist:playlist1\n",
+		out.String())
+}
@@ -7,6 +7,10 @@ import (
 	"time"
 
 	"github.com/gdamore/tcell/v2"
+	"github.com/iamgaru/gspotty/internal/api"
+	"github.com/iamgaru/gspotty/internal/config"
+	"github.com/iamgaru/gspotty/internal/device"
+	"github.com/iamgaru/gspotty/internal/retry"
 	"github.com/rivo/tview"
 	"github.com/zmb3/spotify/v2"
 )
@@ -18,7 +22,7 @@ type PlayerUI struct {
 	progressBar       *tview.TextView
 	infoText          *tview.TextView
 	track             spotify.FullTrack
-	client            *spotify.Client
+	client            api.Client
 	ctx               context.Context
 	returnToMenu      func()
 	timer             *time.Timer
@@ -35,10 +39,14 @@ type PlayerUI struct {
 	isSearchMode      bool
 	albumTracks       []spotify.SimpleTrack
 	isAlbumMode       bool
+	seekStep          time.Duration
+	statusUntil       time.Time // the progress bar shows a status message until then
+	device            string    // name or ID of the device to play on; the active one when empty
+	restoreNotifier   func()    // hands retry status messages back once the player closes
 }
 
 // NewPlayerUI creates a new player UI
-func NewPlayerUI(ctx context.Context, client *spotify.Client, track spotify.FullTrack, keepPlaying bool, autoQuit bool) *PlayerUI {
+func NewPlayerUI(ctx context.Context, client api.Client, track spotify.FullTrack, keepPlaying bool, autoQuit bool) *PlayerUI {
 	app := tview.NewApplication()
 	progressBar := tview.NewTextView().
 		SetDynamicColors(true).
@@ -61,6 +69,8 @@ func NewPlayerUI(ctx context.Context, client *spotify.Client, track spotify.Full
 		isPlaylistMode:    false,
 		isSearchMode:      false,
 		isAlbumMode:       false,
+		seekStep:          time.Duration(config.Active().SeekSeconds) * time.Second,
+		device:            config.Active().Device,
 	}
 
 	// Create layout
@@ -84,11 +94,11 @@ func NewPlayerUI(ctx context.Context, client *spotify.Client, track spotify.Full
 				playerUI.stopPlayback()
 			}
 			if playerUI.returnToMenu != nil {
-				app.Stop()
+				playerUI.stop()
 				playerUI.returnToMenu()
 				return nil
 			}
-			app.Stop()
+			playerUI.stop()
 		}
 
 		// Handle space key for play/pause
@@ -128,14 +138,20 @@ func NewPlayerUI(ctx context.Context, client *spotify.Client, track spotify.Full
 			}
 		}
 
-		// Handle left arrow key to seek backward 10 seconds
+		// Handle 'd' key to pick the device to play on
+		if event.Rune() == 'd' {
+			playerUI.showDevicePicker()
+			return nil
+		}
+
+		// Handle left arrow key to seek backward by the configured step
 		if event.Key() == tcell.KeyLeft {
-			playerUI.seekBackward(10 * time.Second)
+			playerUI.seekBackward(playerUI.seekStep)
 		}
 
-		// Handle right arrow key to seek forward 10 seconds
+		// Handle right arrow key to seek forward by the configured step
 		if event.Key() == tcell.KeyRight {
-			playerUI.seekForward(10 * time.Second)
+			playerUI.seekForward(playerUI.seekStep)
 		}
 
 		return event
@@ -256,21 +272,23 @@ func (p *PlayerUI) playNextAlbumTrack() {
 	p.currentTrackIndex++
 	nextTrack := p.albumTracks[p.currentTrackIndex]
 
-	// Get the full track info
-	fullTrack, err := p.client.GetTrack(p.ctx, nextTrack.ID)
-	if err != nil {
+	// Get the full track info off the event loop, then play it from there
+	go func() {
+		fullTrack, err := p.client.GetTrack(p.ctx, nextTrack.ID)
 		p.app.QueueUpdateDraw(func() {
-			p.progressBar.SetText(fmt.Sprintf("[red]Error getting next track: %v[white]", err))
-		})
-		return
-	}
+			if err != nil {
+				p.progressBar.SetText(fmt.Sprintf("[red]Error getting next track: %v[white]", err))
+				return
+			}
 
-	p.track = *fullTrack
-	p.totalDuration = time.Duration(fullTrack.Duration) * time.Millisecond
-	p.pausedPosition = 0
-	p.startTime = time.Now()
-	p.updateInfoText()
-	p.startPlayback()
+			p.track = *fullTrack
+			p.totalDuration = time.Duration(fullTrack.Duration) * time.Millisecond
+			p.pausedPosition = 0
+			p.startTime = time.Now()
+			p.updateInfoText()
+			p.startPlayback()
+		})
+	}()
 }
 
 // updateInfoText updates the track information display
@@ -300,6 +318,7 @@ func (p *PlayerUI) updateInfoText() {
 			"Press 'k' to toggle keep playing (%s).\n"+
 			"Press 'n' for the next track, 'p' for the previous.\n"+
 			"Use arrow keys (left & right) to seek within a playing track.\n"+
+			"Press 'd' to choose the device to play on.\n"+
 			"Press Esc to return.[white]",
 		p.track.Name,
 		strings.Join(artists, ", "),
@@ -314,6 +333,12 @@ func (p *PlayerUI) updateInfoText() {
 
 // Play starts the playback UI
 func (p *PlayerUI) Play() {
+	// The player UI shows retry waits while it is up
+	if !p.autoQuit {
+		p.restoreNotifier = retry.SetNotifier(p.showStatus)
+		defer p.releaseNotifier()
+	}
+
 	// Start playback and get the result channel
 	resultCh := p.startPlayback()
 
@@ -357,53 +382,34 @@ func (p *PlayerUI) startPlayback() chan error {
 	// Create a channel to signal when playback has started or encountered an error
 	resultCh := make(chan error, 1)
 
+	// The event loop changes the device, track and paused position, so the
+	// goroutine works from their values when playback starts
+	chosen, uri, pausedPosition := p.device, p.track.URI, p.pausedPosition
+
 	// Start playback using Spotify Web API instead of opening URI
 	go func() {
-		// Get available devices first
-		devices, err := p.client.PlayerDevices(p.ctx)
+		// Play on the chosen device, or the active one, or the first available one
+		target, err := device.Select(p.ctx, p.client, chosen)
 		if err != nil {
-			if p.app != nil {
-				p.app.QueueUpdateDraw(func() {
-					p.progressBar.SetText(fmt.Sprintf("[red]Error getting devices: %v[white]", err))
-				})
-			}
-			resultCh <- fmt.Errorf("error getting devices: %v", err)
-			return
-		}
-
-		// Check if there are any active devices
-		if len(devices) == 0 {
-			if p.app != nil {
+			// The UI never runs in auto-quit mode, so a queued draw would block forever
+			if !p.autoQuit {
 				p.app.QueueUpdateDraw(func() {
-					p.progressBar.SetText("[red]No active Spotify devices found. Please open Spotify on any device first.[white]")
+					p.progressBar.SetText(fmt.Sprintf("[red]%v[white]", err))
 				})
 			}
-			resultCh <- fmt.Errorf("no active Spotify devices found")
+			resultCh <- err
 			return
 		}
-
-		// Find an active device to use
-		var deviceID spotify.ID
-		for _, device := range devices {
-			if device.Active {
-				deviceID = device.ID
-				break
-			}
-		}
-
-		// If no active device found, use the first available one
-		if deviceID == "" && len(devices) > 0 {
-			deviceID = devices[0].ID
-		}
+		deviceID := target.ID
 
 		// Set playback options
 		playOpts := &spotify.PlayOptions{
-			URIs: []spotify.URI{p.track.URI},
+			URIs: []spotify.URI{uri},
 		}
 
 		// If we have a paused position, set the position_ms parameter to resume from that point
-		if p.pausedPosition > 0 {
-			positionMs := spotify.Numeric(p.pausedPosition.Milliseconds())
+		if pausedPosition > 0 {
+			positionMs := spotify.Numeric(pausedPosition.Milliseconds())
 			playOpts.PositionMs = positionMs
 		}
 
@@ -415,7 +421,7 @@ func (p *PlayerUI) startPlayback() chan error {
 		// Start playback on the device
 		err = p.client.PlayOpt(p.ctx, playOpts)
 		if err != nil {
-			if p.app != nil {
+			if !p.autoQuit {
 				p.app.QueueUpdateDraw(func() {
 					p.progressBar.SetText(fmt.Sprintf("[red]Error starting playback: %v[white]", err))
 				})
@@ -573,10 +579,103 @@ func (p *PlayerUI) updateProgressBar(elapsed time.Duration) {
 		percentage)
 
 	p.app.QueueUpdateDraw(func() {
+		// Leave a status message up while it applies
+		if time.Now().Before(p.statusUntil) {
+			return
+		}
 		p.progressBar.SetText(bar + timeText)
 	})
 }
 
+// showStatus shows a status message, such as a rate limit wait, in the progress bar
+func (p *PlayerUI) showStatus(message string, wait time.Duration) {
+	// Requests made on the event loop notify from it, so queue the update
+	// without waiting for the loop to run it
+	go p.app.QueueUpdateDraw(func() {
+		p.statusUntil = time.Now().Add(wait)
+		p.progressBar.SetText("[yellow]" + message + "[white]")
+	})
+}
+
+// releaseNotifier stops routing retry status messages to the player
+func (p *PlayerUI) releaseNotifier() {
+	if p.restoreNotifier != nil {
+		p.restoreNotifier()
+		p.restoreNotifier = nil
+	}
+}
+
+// stop stops the player UI. The menu shown next may run before the event
+// loop returns, so the notifier is released first.
+func (p *PlayerUI) stop() {
+	p.releaseNotifier()
+	p.app.Stop()
+}
+
+// showDevicePicker lists the devices in a modal; picking one moves playback
+// there. The devices are fetched off the event loop, like transferTo.
+func (p *PlayerUI) showDevicePicker() {
+	go func() {
+		devices, err := p.client.PlayerDevices(p.ctx)
+		p.app.QueueUpdateDraw(func() {
+			if err != nil {
+				p.progressBar.SetText(fmt.Sprintf("[red]Error getting devices: %v[white]", err))
+				return
+			}
+			if len(devices) == 0 {
+				p.progressBar.SetText("[red]No Spotify devices found. Please open Spotify on any device first.[white]")
+				return
+			}
+
+			list := tview.NewList().ShowSecondaryText(false)
+			for _, d := range devices {
+				target := d
+				label := fmt.Sprintf("%s (%s)", tview.Escape(target.Name), target.Type)
+				if target.Active {
+					label += " - playing here"
+				}
+				list.AddItem(label, "", 0, func() {
+					p.app.SetRoot(p.flex, true)
+					p.transferTo(target)
+				})
+			}
+			list.SetDoneFunc(func() {
+				p.app.SetRoot(p.flex, true)
+			})
+			list.SetBorder(true).
+				SetTitle(" Play On (Esc to cancel) ").
+				SetTitleAlign(tview.AlignCenter)
+
+			// Center the list over the player
+			width, height := 50, len(devices)+2
+			modal := tview.NewFlex().
+				AddItem(nil, 0, 1, false).
+				AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+					AddItem(nil, 0, 1, false).
+					AddItem(list, height, 0, true).
+					AddItem(nil, 0, 1, false), width, 0, true).
+				AddItem(nil, 0, 1, false)
+			p.app.SetRoot(modal, true)
+		})
+	}()
+}
+
+// transferTo moves playback to the device. The track keeps its position, and
+// later tracks play there too.
+func (p *PlayerUI) transferTo(target spotify.PlayerDevice) {
+	p.device = string(target.ID)
+	playing := p.isPlaying
+	go func() {
+		if err := p.client.TransferPlayback(p.ctx, target.ID, playing); err != nil {
+			p.app.QueueUpdateDraw(func() {
+				p.progressBar.SetText(fmt.Sprintf("[red]Error transferring playback: %v[white]", err))
+			})
+			return
+		}
+		p.showStatus(fmt.Sprintf("Playback moved to %s", target.Name), 3*time.Second)
+	}()
+}
+
 // SetReturnToMenuFunction sets the function to return to the main menu
 func (p *PlayerUI) SetReturnToMenuFunction(returnFunc func()) {
 	p.returnToMenu = returnFunc
@@ -648,27 +747,30 @@ func (p *PlayerUI) playPreviousAlbumTrack() {
 	p.currentTrackIndex--
 	previousTrack := p.albumTracks[p.currentTrackIndex]
 
-	// Get the full track info
-	fullTrack, err := p.client.GetTrack(p.ctx, previousTrack.ID)
-	if err != nil {
+	// Get the full track info off the event loop, then play it from there
+	go func() {
+		fullTrack, err := p.client.GetTrack(p.ctx, previousTrack.ID)
 		p.app.QueueUpdateDraw(func() {
-			p.progressBar.SetText(fmt.Sprintf("[red]Error getting previous track: %v[white]", err))
-		})
-		return
-	}
+			if err != nil {
+				p.progressBar.SetText(fmt.Sprintf("[red]Error getting previous track: %v[white]", err))
+				return
+			}
 
-	p.track = *fullTrack
-	p.totalDuration = time.Duration(fullTrack.Duration) * time.Millisecond
-	p.pausedPosition = 0
-	p.startTime = time.Now()
-	p.updateInfoText()
-	p.startPlayback()
+			p.track = *fullTrack
+			p.totalDuration = time.Duration(fullTrack.Duration) * time.Millisecond
+			p.pausedPosition = 0
+			p.startTime = time.Now()
+			p.updateInfoText()
+			p.startPlayback()
+		})
+	}()
 }
 
-// seekForward seeks forward by the specified duration
-func (p *PlayerUI) seekForward(duration time.Duration) {
+// seekForward seeks forward by the specified duration, like seekTo, or
+// returns nil when nothing is playing
+func (p *PlayerUI) seekForward(duration time.Duration) chan error {
 	if !p.isPlaying {
-		return
+		return nil
 	}
 
 	// Calculate new position
@@ -680,23 +782,14 @@ func (p *PlayerUI) seekForward(duration time.Duration) {
 		newPosition = p.totalDuration
 	}
 
-	// Seek to the new position
-	err := p.client.Seek(p.ctx, int(newPosition.Milliseconds()))
-	if err != nil {
-		p.app.QueueUpdateDraw(func() {
-			p.progressBar.SetText(fmt.Sprintf("[red]Error seeking forward: %v[white]", err))
-		})
-		return
-	}
-
-	// Update the start time to reflect the new position
-	p.startTime = time.Now().Add(-newPosition)
+	return p.seekTo(newPosition, "forward")
 }
 
-// seekBackward seeks backward by the specified duration
-func (p *PlayerUI) seekBackward(duration time.Duration) {
+// seekBackward seeks backward by the specified duration, like seekTo, or
+// returns nil when nothing is playing
+func (p *PlayerUI) seekBackward(duration time.Duration) chan error {
 	if !p.isPlaying {
-		return
+		return nil
 	}
 
 	// Calculate new position
@@ -708,15 +801,37 @@ func (p *PlayerUI) seekBackward(duration time.Duration) {
 		newPosition = 0
 	}
 
-	// Seek to the new position
-	err := p.client.Seek(p.ctx, int(newPosition.Milliseconds()))
-	if err != nil {
+	return p.seekTo(newPosition, "backward")
+}
+
+// seekTo seeks to the position off the event loop. The returned channel
+// reports when the seek is done or failed.
+func (p *PlayerUI) seekTo(position time.Duration, direction string) chan error {
+	resultCh := make(chan error, 1)
+	go func() {
+		err := p.client.Seek(p.ctx, int(position.Milliseconds()))
+		if err != nil {
+			if !p.autoQuit {
+				p.app.QueueUpdateDraw(func() {
+					p.progressBar.SetText(fmt.Sprintf("[red]Error seeking %s: %v[white]", direction, err))
+				})
+			}
+			resultCh <- err
+			return
+		}
+
+		// Update the start time to reflect the new position on the event loop,
+		// which reads it for the progress bar
+		seeked := time.Now()
+		if p.autoQuit {
+			p.startTime = seeked.Add(-position)
+			resultCh <- nil
+			return
+		}
 		p.app.QueueUpdateDraw(func() {
-			p.progressBar.SetText(fmt.Sprintf("[red]Error seeking backward: %v[white]", err))
+			p.startTime = seeked.Add(-position)
+			resultCh <- nil
 		})
-		return
-	}
-
-	// Update the start time to reflect the new position
-	p.startTime = time.Now().Add(-newPosition)
+	}()
+	return resultCh
 }
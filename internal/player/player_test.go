@@ -2,76 +2,19 @@ package player
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/gdamore/tcell/v2"
+	"github.com/iamgaru/gspotty/internal/api"
+	"github.com/iamgaru/gspotty/internal/fakespotify"
 	"github.com/iamgaru/gspotty/internal/testutils"
+	"github.com/rivo/tview"
 	"github.com/stretchr/testify/assert"
 	"github.com/zmb3/spotify/v2"
 )
 
-// MockPlayerUI is a mock implementation of the PlayerUI for testing
-type MockPlayerUI struct {
-	app            interface{}
-	track          spotify.FullTrack
-	client         *testutils.MockSpotifyClient
-	ctx            context.Context
-	isPlaying      bool
-	totalDuration  time.Duration
-	keepPlaying    bool
-	autoQuit       bool
-	playlistTracks []spotify.PlaylistTrack
-	searchTracks   []spotify.FullTrack
-	albumTracks    []spotify.SimpleTrack
-}
-
-// NewMockPlayerUI creates a new mock player UI
-func NewMockPlayerUI(ctx context.Context, client interface{}, track spotify.FullTrack, keepPlaying bool, autoQuit bool) *MockPlayerUI {
-	return &MockPlayerUI{
-		app:           nil,
-		track:         track,
-		client:        client.(*testutils.MockSpotifyClient),
-		ctx:           ctx,
-		isPlaying:     false,
-		totalDuration: time.Duration(track.Duration) * time.Millisecond,
-		keepPlaying:   keepPlaying,
-		autoQuit:      autoQuit,
-	}
-}
-
-// Play starts playback
-func (p *MockPlayerUI) Play() {
-	p.isPlaying = true
-	p.client.PlayCalled = true
-}
-
-// Pause pauses playback
-func (p *MockPlayerUI) Pause() {
-	p.isPlaying = false
-	p.client.PauseCalled = true
-}
-
-// Stop stops playback
-func (p *MockPlayerUI) Stop() {
-	p.isPlaying = false
-	p.client.PauseCalled = true
-}
-
-// SetPlaylistTracks sets the playlist tracks
-func (p *MockPlayerUI) SetPlaylistTracks(tracks []spotify.PlaylistTrack) {
-	p.playlistTracks = tracks
-}
-
-// SetSearchTracks sets the search tracks
-func (p *MockPlayerUI) SetSearchTracks(tracks []spotify.FullTrack) {
-	p.searchTracks = tracks
-}
-
-// SetAlbumTracks sets the album tracks
-func (p *MockPlayerUI) SetAlbumTracks(tracks []spotify.SimpleTrack) {
-	p.albumTracks = tracks
-}
-
 // TestPlayerUI tests the PlayerUI functionality
 func TestPlayerUI(t *testing.T) {
 	// Create a mock Spotify client
@@ -92,8 +35,8 @@ func TestPlayerUI(t *testing.T) {
 		},
 	}
 
-	// Create a new PlayerUI instance
-	player := NewMockPlayerUI(context.Background(), mockClient, testTrack, false, false)
+	// Create a new PlayerUI instance backed by the mock client
+	player := NewPlayerUI(context.Background(), mockClient, testTrack, false, true)
 
 	// Test initial state
 	assert.False(t, player.isPlaying)
@@ -103,19 +46,35 @@ func TestPlayerUI(t *testing.T) {
 	// Test playback controls
 	t.Run("Playback Controls", func(t *testing.T) {
 		// Test play
-		player.Play()
+		err := <-player.startPlayback()
+		assert.NoError(t, err)
 		assert.True(t, player.isPlaying)
+		assert.True(t, mockClient.PlayerDevicesCalled)
 		assert.True(t, mockClient.PlayCalled)
+		if assert.NotNil(t, mockClient.LastPlayOptions) {
+			assert.Equal(t, []spotify.URI{testTrack.URI}, mockClient.LastPlayOptions.URIs)
+			if assert.NotNil(t, mockClient.LastPlayOptions.DeviceID) {
+				assert.Equal(t, spotify.ID("test_device_id"), *mockClient.LastPlayOptions.DeviceID)
+			}
+		}
+
+		// Test seek
+		assert.NoError(t, <-player.seekForward(10*time.Second))
+		assert.True(t, mockClient.SeekCalled)
+		assert.GreaterOrEqual(t, mockClient.SeekPosition, 10000)
 
 		// Test pause
-		player.Pause()
+		player.pausePlayback()
 		assert.False(t, player.isPlaying)
-		assert.True(t, mockClient.PauseCalled)
+		assert.Greater(t, player.pausedPosition, time.Duration(0))
+	})
 
-		// Test stop
-		player.Stop()
-		assert.False(t, player.isPlaying)
-		assert.True(t, mockClient.PauseCalled)
+	t.Run("No Devices", func(t *testing.T) {
+		noDevicesClient := &testutils.MockSpotifyClient{Devices: []spotify.PlayerDevice{}}
+		p := NewPlayerUI(context.Background(), noDevicesClient, testTrack, false, true)
+		err := <-p.startPlayback()
+		assert.Error(t, err)
+		assert.False(t, noDevicesClient.PlayCalled)
 	})
 
 	// Test playlist mode
@@ -137,6 +96,8 @@ func TestPlayerUI(t *testing.T) {
 
 		player.SetPlaylistTracks(playlistTracks)
 		assert.Equal(t, 2, len(player.playlistTracks))
+		assert.True(t, player.isPlaylistMode)
+		assert.Equal(t, 0, player.currentTrackIndex)
 	})
 
 	// Test search mode
@@ -158,6 +119,8 @@ func TestPlayerUI(t *testing.T) {
 
 		player.SetSearchTracks(searchTracks)
 		assert.Equal(t, 2, len(player.searchTracks))
+		assert.True(t, player.isSearchMode)
+		assert.Equal(t, 0, player.currentTrackIndex)
 	})
 
 	// Test album mode
@@ -184,6 +147,8 @@ func TestPlayerUI(t *testing.T) {
 
 		player.SetAlbumTracks(albumTracks)
 		assert.Equal(t, 2, len(player.albumTracks))
+		assert.True(t, player.isAlbumMode)
+		assert.Equal(t, 0, player.currentTrackIndex)
 	})
 }
 
@@ -204,7 +169,7 @@ func TestPlayerUIWithMockContext(t *testing.T) {
 		},
 	}
 
-	_ = NewMockPlayerUI(ctx, mockClient, testTrack, false, false)
+	_ = NewPlayerUI(ctx, mockClient, testTrack, false, false)
 
 	// Test context cancellation
 	cancel()
@@ -247,18 +212,186 @@ func TestPlayer(t *testing.T) {
 
 		// Test seek
 		t.Run("Seek", func(t *testing.T) {
-			position := 30 * time.Second
+			position := int((30 * time.Second).Milliseconds())
 			err := mockClient.Seek(ctx, position)
 			assert.NoError(t, err)
 			assert.True(t, mockClient.SeekCalled)
+			assert.Equal(t, position, mockClient.SeekPosition)
 		})
 
 		// Test volume
 		t.Run("Volume", func(t *testing.T) {
 			volume := 50
-			err := mockClient.SetVolume(ctx, volume)
+			err := mockClient.Volume(ctx, volume)
 			assert.NoError(t, err)
-			assert.True(t, mockClient.SetVolumeCalled)
+			assert.True(t, mockClient.VolumeCalled)
+		})
+	})
+}
+
+// TestStartPlaybackAgainstFakeServer tests startPlayback against realistic HTTP responses
+func TestStartPlaybackAgainstFakeServer(t *testing.T) {
+	server := fakespotify.NewServer()
+	defer server.Close()
+
+	testTrack := spotify.FullTrack{
+		SimpleTrack: spotify.SimpleTrack{
+			ID:       "track1",
+			Name:     "Bohemian Rhapsody",
+			URI:      "spotify:track:track1",
+			Duration: 354000,
+		},
+	}
+	server.AddTrack(testTrack)
+
+	t.Run("No Devices", func(t *testing.T) {
+		p := NewPlayerUI(context.Background(), server.Client(), testTrack, false, true)
+		err := <-p.startPlayback()
+		assert.Error(t, err)
+	})
+
+	// Inactive devices fall back to the first available one
+	server.AddDevice(spotify.PlayerDevice{ID: "device1", Name: "Laptop"})
+	server.AddDevice(spotify.PlayerDevice{ID: "device2", Name: "Phone"})
+
+	t.Run("Resume From Paused Position", func(t *testing.T) {
+		p := NewPlayerUI(context.Background(), server.Client(), testTrack, false, true)
+		p.pausedPosition = 90 * time.Second
+
+		err := <-p.startPlayback()
+		assert.NoError(t, err)
+
+		playback := server.Playback()
+		assert.True(t, playback.Playing)
+		assert.Equal(t, spotify.ID("device1"), playback.DeviceID)
+		assert.Equal(t, testTrack.URI, playback.CurrentURI())
+		assert.Equal(t, 90000, playback.ProgressMs)
+	})
+
+	t.Run("Chosen Device", func(t *testing.T) {
+		p := NewPlayerUI(context.Background(), server.Client(), testTrack, false, true)
+		p.device = "phone"
+
+		err := <-p.startPlayback()
+		assert.NoError(t, err)
+		assert.Equal(t, spotify.ID("device2"), server.Playback().DeviceID)
+
+		p.device = "Toaster"
+		err = <-p.startPlayback()
+		assert.True(t, errors.Is(err, api.ErrNoDevice))
+	})
+
+	t.Run("Playback Error", func(t *testing.T) {
+		server.FailNext("PUT", "/v1/me/player/play", 403, "Player command failed: Premium required")
+		p := NewPlayerUI(context.Background(), server.Client(), testTrack, false, true)
+
+		err := <-p.startPlayback()
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Premium required")
+		}
+	})
+}
+
+// runOnSimulationScreen runs the player on a simulation screen without
+// starting playback until the test ends, and returns a function that runs f on
+// the event loop, failing the test if the loop is stuck
+func runOnSimulationScreen(t *testing.T, p *PlayerUI) func(f func()) {
+	p.app.SetScreen(tcell.NewSimulationScreen("UTF-8"))
+	p.app.SetRoot(p.flex, true)
+	done := make(chan struct{})
+	go func() {
+		p.app.Run()
+		close(done)
+	}()
+	t.Cleanup(func() {
+		p.app.Stop()
+		<-done
+	})
+
+	return func(f func()) {
+		ran := make(chan struct{})
+		go p.app.QueueUpdate(func() {
+			f()
+			close(ran)
 		})
+		select {
+		case <-ran:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the event loop is blocked")
+		}
+	}
+}
+
+// slowDevicesClient answers PlayerDevices once release is closed, like a
+// request waiting out a rate limit
+type slowDevicesClient struct {
+	*testutils.MockSpotifyClient
+	release chan struct{}
+}
+
+func (c slowDevicesClient) PlayerDevices(ctx context.Context) ([]spotify.PlayerDevice, error) {
+	<-c.release
+	return c.MockSpotifyClient.PlayerDevices(ctx)
+}
+
+// TestDevicePickerWaits tests that the player stays responsive while the
+// device picker waits for the device list
+func TestDevicePickerWaits(t *testing.T) {
+	client := slowDevicesClient{&testutils.MockSpotifyClient{}, make(chan struct{})}
+	p := NewPlayerUI(context.Background(), client, spotify.FullTrack{}, false, false)
+
+	onEventLoop := runOnSimulationScreen(t, p)
+	focusedList := func() bool {
+		var picking bool
+		onEventLoop(func() {
+			_, picking = p.app.GetFocus().(*tview.List)
+		})
+		return picking
+	}
+
+	onEventLoop(p.showDevicePicker)
+	assert.False(t, focusedList())
+
+	close(client.release)
+	for deadline := time.Now().Add(5 * time.Second); !focusedList(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the device picker was not shown")
+		}
+	}
+}
+
+// TestSeekOnEventLoop tests that seeking moves the progress on the event loop,
+// which reads it while the player runs
+func TestSeekOnEventLoop(t *testing.T) {
+	p := NewPlayerUI(context.Background(), &testutils.MockSpotifyClient{}, spotify.FullTrack{
+		SimpleTrack: spotify.SimpleTrack{Duration: 180000},
+	}, false, false)
+	onEventLoop := runOnSimulationScreen(t, p)
+
+	var seeked chan error
+	onEventLoop(func() {
+		p.isPlaying = true
+		p.startTime = time.Now()
+		seeked = p.seekForward(time.Minute)
+	})
+	assert.NoError(t, <-seeked)
+
+	var elapsed time.Duration
+	onEventLoop(func() { elapsed = time.Since(p.startTime) })
+	assert.GreaterOrEqual(t, elapsed, time.Minute)
+}
+
+// TestPickDeviceWhileStarting tests that picking a device on the event loop
+// does not race with playback starting on the previous one
+func TestPickDeviceWhileStarting(t *testing.T) {
+	client := &testutils.MockSpotifyClient{}
+	p := NewPlayerUI(context.Background(), client, spotify.FullTrack{}, false, false)
+	onEventLoop := runOnSimulationScreen(t, p)
+
+	var started chan error
+	onEventLoop(func() {
+		started = p.startPlayback()
+		p.device = "test_device_id"
 	})
+	assert.NoError(t, <-started)
 }
@@ -4,54 +4,57 @@ package profile
 import (
 	"context"
 	"fmt"
-	"log"
 	"os"
 
-	spotifyauth "github.com/zmb3/spotify/v2/auth"
-
-	"golang.org/x/oauth2/clientcredentials"
+	"github.com/iamgaru/gspotty/internal/api"
+	"github.com/iamgaru/gspotty/internal/cli"
+	"github.com/iamgaru/gspotty/internal/config"
 
 	"github.com/zmb3/spotify/v2"
 )
 
-// SpotifyClient interface for testing
-type SpotifyClient interface {
-	GetUsersPublicProfile(ctx context.Context, userID spotify.ID) (*spotify.User, error)
-}
-
 // For testing purposes
 var getSpotifyClientFunc = defaultGetSpotifyClient
 
 // GetProfile gets and displays the public profile information about a Spotify user.
-func GetProfile(userID string) {
+// It returns an error when no client can be created from the client credentials.
+func GetProfile(userID string) error {
 	if userID == "" {
 		fmt.Fprintf(os.Stderr, "Error: missing user ID\n")
-		return
+		return nil
 	}
 
 	ctx := context.Background()
-	client := getSpotifyClientFunc(ctx)
+	client, err := getSpotifyClientFunc(ctx)
+	if err != nil {
+		return err
+	}
 	displayProfile(ctx, client, userID)
+	return nil
 }
 
-// defaultGetSpotifyClient creates a new Spotify client
-func defaultGetSpotifyClient(ctx context.Context) SpotifyClient {
-	config := &clientcredentials.Config{
-		ClientID:     os.Getenv("SPOTIFY_ID"),
-		ClientSecret: os.Getenv("SPOTIFY_SECRET"),
-		TokenURL:     spotifyauth.TokenURL,
+// GetProfileWithClient displays a user's public profile using an already authorized client.
+func GetProfileWithClient(ctx context.Context, client api.Client, userID string) {
+	if userID == "" {
+		fmt.Fprintf(os.Stderr, "Error: missing user ID\n")
+		return
 	}
-	token, err := config.Token(ctx)
+
+	displayProfile(ctx, client, userID)
+}
+
+// defaultGetSpotifyClient creates a new Spotify client using the client credentials flow
+func defaultGetSpotifyClient(ctx context.Context) (api.Client, error) {
+	// The client credentials flow always needs the secret
+	credentials, err := config.LoadCredentials(config.AuthFlowCode)
 	if err != nil {
-		log.Fatalf("couldn't get token: %v", err)
+		return nil, err
 	}
-
-	httpClient := spotifyauth.New().Client(ctx, token)
-	return spotify.New(httpClient)
+	return cli.NewAppClient(ctx, credentials)
 }
 
 // displayProfile displays the user profile information
-func displayProfile(ctx context.Context, client SpotifyClient, userID string) {
+func displayProfile(ctx context.Context, client api.Client, userID string) {
 	user, err := client.GetUsersPublicProfile(ctx, spotify.ID(userID))
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
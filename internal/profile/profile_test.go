@@ -5,8 +5,13 @@ import (
 	"os"
 	"testing"
 
+	"github.com/iamgaru/gspotty/internal/api"
+	"github.com/iamgaru/gspotty/internal/config"
+	"github.com/iamgaru/gspotty/internal/fakespotify"
 	"github.com/iamgaru/gspotty/internal/testutils"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zmb3/spotify/v2"
 )
 
 // MockGetProfile is a test helper that uses a mock client
@@ -19,13 +24,11 @@ func MockGetProfile(t *testing.T) {
 	defer func() {
 		os.Setenv("SPOTIFY_ID", originalID)
 		os.Setenv("SPOTIFY_SECRET", originalSecret)
-		*userID = "" // Reset the flag
 	}()
 
 	t.Run("Missing User ID", func(t *testing.T) {
-		*userID = ""
 		assert.NotPanics(t, func() {
-			GetProfile()
+			GetProfile("")
 		})
 	})
 
@@ -33,10 +36,9 @@ func MockGetProfile(t *testing.T) {
 		// Set required environment variables
 		os.Setenv("SPOTIFY_ID", "test_id")
 		os.Setenv("SPOTIFY_SECRET", "test_secret")
-		*userID = "test_user"
 
 		assert.NotPanics(t, func() {
-			GetProfile()
+			GetProfile("test_user")
 		})
 	})
 }
@@ -52,8 +54,8 @@ func TestProfile(t *testing.T) {
 	}()
 
 	// Replace with mock function
-	getSpotifyClientFunc = func(ctx context.Context) SpotifyClient {
-		return mockClient
+	getSpotifyClientFunc = func(ctx context.Context) (api.Client, error) {
+		return mockClient, nil
 	}
 
 	t.Run("Display Profile", func(t *testing.T) {
@@ -70,21 +72,51 @@ func TestProfile(t *testing.T) {
 		defer func() {
 			os.Setenv("SPOTIFY_ID", originalID)
 			os.Setenv("SPOTIFY_SECRET", originalSecret)
-			*userID = "" // Reset the flag
 		}()
 
 		t.Run("Missing User ID", func(t *testing.T) {
-			*userID = ""
 			assert.NotPanics(t, func() {
-				GetProfile()
+				GetProfile("")
 			})
 		})
 
 		t.Run("With Valid Configuration", func(t *testing.T) {
-			*userID = "test_user"
 			assert.NotPanics(t, func() {
-				GetProfile()
+				GetProfile("test_user")
 			})
 		})
 	})
 }
+
+// TestDefaultGetSpotifyClient tests the client credentials flow against overridden endpoints
+func TestDefaultGetSpotifyClient(t *testing.T) {
+	server := fakespotify.NewServer()
+	defer server.Close()
+	server.SetClientCredentials("test_id", "test_secret")
+	server.AddUser(spotify.User{ID: "test_user", DisplayName: "Test User"})
+
+	t.Setenv("SPOTIFY_ID", "test_id")
+	t.Setenv("SPOTIFY_SECRET", "test_secret")
+	t.Setenv(config.APIURLEnv, server.APIURL())
+	t.Setenv(config.AccountsURLEnv, server.AccountsURL())
+
+	client, err := defaultGetSpotifyClient(context.Background())
+	require.NoError(t, err)
+	user, err := client.GetUsersPublicProfile(context.Background(), "test_user")
+	require.NoError(t, err)
+	assert.Equal(t, "Test User", user.DisplayName)
+	assert.Equal(t, []string{"POST /api/token", "GET /v1/users/test_user"}, server.Requests())
+
+	t.Run("Wrong Secret", func(t *testing.T) {
+		t.Setenv("SPOTIFY_SECRET", "wrong_secret")
+		_, err := defaultGetSpotifyClient(context.Background())
+		assert.ErrorIs(t, err, api.ErrTokenExchange)
+	})
+
+	t.Run("Missing Credentials", func(t *testing.T) {
+		t.Setenv("SPOTIFY_SECRET", "")
+		_, err := defaultGetSpotifyClient(context.Background())
+		assert.ErrorIs(t, err, api.ErrMissingCredentials)
+		assert.ErrorIs(t, GetProfile("test_user"), api.ErrMissingCredentials)
+	})
+}
@@ -0,0 +1,204 @@
+// Package retry provides an HTTP transport that retries requests the Spotify
+// Web API turned away because of rate limiting, server errors or network
+// errors, and reports each wait to whichever UI is active.
+package retry
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxRetries is how many times a request is retried before its error is returned
+	DefaultMaxRetries = 3
+	// DefaultMaxWait caps the wait before a retry; a longer Retry-After returns the response instead
+	DefaultMaxWait = 30 * time.Second
+	// DefaultBaseDelay is the backoff before the first retry, doubling after each one
+	DefaultBaseDelay = 500 * time.Millisecond
+)
+
+// Notifier shows a retry status message to the user while the transport waits
+type Notifier func(message string, wait time.Duration)
+
+var (
+	notifyMu sync.Mutex
+	notifier Notifier
+)
+
+// SetNotifier routes retry status messages to n until the returned function
+// restores the previous notifier. UIs set one while they are on screen. With
+// no notifier set, messages are dropped.
+func SetNotifier(n Notifier) func() {
+	notifyMu.Lock()
+	defer notifyMu.Unlock()
+	previous := notifier
+	notifier = n
+	return func() {
+		notifyMu.Lock()
+		defer notifyMu.Unlock()
+		notifier = previous
+	}
+}
+
+// notify tells the active notifier why and how long the transport waits
+func notify(reason string, wait time.Duration) {
+	notifyMu.Lock()
+	n := notifier
+	notifyMu.Unlock()
+	if n != nil {
+		n(fmt.Sprintf("%s, retrying in %s", reason, formatWait(wait)), wait)
+	}
+}
+
+// Transport retries requests that failed with 429 Too Many Requests, honouring
+// Retry-After. Idempotent requests are also retried with jittered exponential
+// backoff after 5xx responses and network errors.
+type Transport struct {
+	Base       http.RoundTripper
+	MaxRetries int
+	MaxWait    time.Duration
+	BaseDelay  time.Duration
+
+	// sleep waits between attempts; tests replace it
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// New returns a transport with the default policy on top of base, or
+// http.DefaultTransport when base is nil
+func New(base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{
+		Base:       base,
+		MaxRetries: DefaultMaxRetries,
+		MaxWait:    DefaultMaxWait,
+		BaseDelay:  DefaultBaseDelay,
+		sleep:      sleep,
+	}
+}
+
+// RoundTrip sends the request, retrying it while the policy allows
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.Body != nil && req.Body != http.NoBody {
+			// The previous attempt consumed the body, so send a fresh copy.
+			// decide only retries bodies that have GetBody.
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		resp, err := t.Base.RoundTrip(req)
+		wait, reason, retry := t.decide(req, resp, err, attempt)
+		if !retry {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		notify(reason, wait)
+		if err := t.sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// decide returns how long to wait before retrying, and why, or false when the
+// result should be returned as it is
+func (t *Transport) decide(req *http.Request, resp *http.Response, err error, attempt int) (time.Duration, string, bool) {
+	if attempt >= t.MaxRetries || req.Context().Err() != nil {
+		return 0, "", false
+	}
+	// A body that cannot be replayed cannot be sent again
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return 0, "", false
+	}
+
+	switch {
+	case err != nil:
+		if !idempotent(req.Method) {
+			return 0, "", false
+		}
+		return t.backoff(attempt), "network error", true
+
+	case resp.StatusCode == http.StatusTooManyRequests:
+		// Spotify did not process the request, so any method can be sent again
+		wait, ok := retryAfter(resp.Header.Get("Retry-After"))
+		if !ok {
+			wait = t.backoff(attempt)
+		}
+		if wait > t.MaxWait {
+			return 0, "", false
+		}
+		return wait, "rate limited", true
+
+	case resp.StatusCode >= 500 && idempotent(req.Method):
+		return t.backoff(attempt), fmt.Sprintf("server error %d", resp.StatusCode), true
+	}
+	return 0, "", false
+}
+
+// backoff returns the jittered delay before a retry: between half and all of
+// the base delay doubled for each earlier retry
+func (t *Transport) backoff(attempt int) time.Duration {
+	d := t.BaseDelay << attempt
+	if d > t.MaxWait {
+		d = t.MaxWait
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// idempotent reports whether sending a request twice has the same effect as once
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// formatWait rounds a wait up to whole seconds for display
+func formatWait(d time.Duration) string {
+	seconds := int((d + time.Second - 1) / time.Second)
+	return fmt.Sprintf("%ds", seconds)
+}
+
+// sleep waits for d or until the context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
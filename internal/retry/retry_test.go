@@ -0,0 +1,208 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// roundTripFunc adapts a function to http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// newTestTransport returns a transport that records its waits instead of sleeping
+func newTestTransport(base http.RoundTripper) (*Transport, *[]time.Duration) {
+	var waits []time.Duration
+	transport := New(base)
+	transport.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	return transport, &waits
+}
+
+// newStatusServer answers with the given statuses in turn, then 200, and records the request bodies
+func newStatusServer(t *testing.T, header http.Header, statuses ...int) (*httptest.Server, *[]string) {
+	var (
+		mu     sync.Mutex
+		bodies []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+
+		if len(bodies) <= len(statuses) {
+			for name, values := range header {
+				w.Header()[name] = values
+			}
+			w.WriteHeader(statuses[len(bodies)-1])
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, &bodies
+}
+
+// TestRateLimit tests that 429 responses are retried after Retry-After and reported
+func TestRateLimit(t *testing.T) {
+	var messages []string
+	defer SetNotifier(func(message string, wait time.Duration) {
+		messages = append(messages, message)
+	})()
+
+	server, bodies := newStatusServer(t, http.Header{"Retry-After": {"2"}}, http.StatusTooManyRequests)
+	transport, waits := newTestTransport(nil)
+	client := &http.Client{Transport: transport}
+
+	// Even a POST is sent again, since Spotify did not process it
+	resp, err := client.Post(server.URL, "application/json", strings.NewReader(`{"uris":["a"]}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{`{"uris":["a"]}`, `{"uris":["a"]}`}, *bodies)
+	assert.Equal(t, []time.Duration{2 * time.Second}, *waits)
+	assert.Equal(t, []string{"rate limited, retrying in 2s"}, messages)
+
+	t.Run("Too Long", func(t *testing.T) {
+		server, bodies := newStatusServer(t, http.Header{"Retry-After": {"3600"}}, http.StatusTooManyRequests)
+		resp, err := (&http.Client{Transport: New(nil)}).Get(server.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.Len(t, *bodies, 1)
+	})
+}
+
+// TestServerErrors tests that only idempotent requests are retried after 5xx responses
+func TestServerErrors(t *testing.T) {
+	server, bodies := newStatusServer(t, nil, http.StatusBadGateway, http.StatusServiceUnavailable)
+	transport, waits := newTestTransport(nil)
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, *waits, 2)
+	assert.True(t, (*waits)[0] >= DefaultBaseDelay/2 && (*waits)[0] <= DefaultBaseDelay)
+	assert.True(t, (*waits)[1] >= DefaultBaseDelay && (*waits)[1] <= 2*DefaultBaseDelay)
+	assert.Len(t, *bodies, 3)
+
+	t.Run("Not Idempotent", func(t *testing.T) {
+		server, bodies := newStatusServer(t, nil, http.StatusInternalServerError)
+		transport, _ := newTestTransport(nil)
+		resp, err := (&http.Client{Transport: transport}).Post(server.URL, "text/plain", strings.NewReader("next"))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		assert.Len(t, *bodies, 1)
+	})
+
+	t.Run("Gives Up", func(t *testing.T) {
+		server, bodies := newStatusServer(t, nil, 500, 500, 500, 500, 500)
+		transport, _ := newTestTransport(nil)
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		assert.Len(t, *bodies, DefaultMaxRetries+1)
+	})
+}
+
+// TestRequestBodies tests that empty bodies are sent again as they are, and
+// bodies that cannot be replayed are not sent again
+func TestRequestBodies(t *testing.T) {
+	t.Run("Empty Body", func(t *testing.T) {
+		server, bodies := newStatusServer(t, nil, http.StatusServiceUnavailable)
+		transport, _ := newTestTransport(nil)
+
+		// Requests built by hand may have an empty body but no GetBody
+		req, err := http.NewRequest(http.MethodPut, server.URL, nil)
+		require.NoError(t, err)
+		req.Body = http.NoBody
+		req.GetBody = nil
+
+		resp, err := transport.RoundTrip(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, []string{"", ""}, *bodies)
+	})
+
+	t.Run("Unreplayable Body", func(t *testing.T) {
+		server, bodies := newStatusServer(t, nil, http.StatusServiceUnavailable)
+		transport, _ := newTestTransport(nil)
+
+		req, err := http.NewRequest(http.MethodPut, server.URL, io.NopCloser(strings.NewReader("volume")))
+		require.NoError(t, err)
+		require.Nil(t, req.GetBody)
+
+		resp, err := transport.RoundTrip(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		assert.Equal(t, []string{"volume"}, *bodies)
+	})
+}
+
+// TestNetworkErrors tests that network errors are retried and that cancellation stops the retries
+func TestNetworkErrors(t *testing.T) {
+	attempts := 0
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		if attempts < 3 {
+			return nil, errors.New("connection reset by peer")
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	})
+	transport, _ := newTestTransport(base)
+
+	req, err := http.NewRequest(http.MethodGet, "http://spotify.invalid/v1/me/player", nil)
+	require.NoError(t, err)
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 3, attempts)
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		transport := New(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			cancel()
+			return nil, errors.New("connection refused")
+		}))
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://spotify.invalid/v1/search", nil)
+		require.NoError(t, err)
+		_, err = transport.RoundTrip(req)
+		assert.Error(t, err)
+	})
+}
+
+// TestRetryAfter tests parsing both forms of the Retry-After header
+func TestRetryAfter(t *testing.T) {
+	wait, ok := retryAfter("5")
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Second, wait)
+
+	wait, ok = retryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.True(t, ok)
+	assert.True(t, wait > 55*time.Second && wait <= time.Minute)
+
+	_, ok = retryAfter("soon")
+	assert.False(t, ok)
+}
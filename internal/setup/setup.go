@@ -0,0 +1,123 @@
+// Package setup walks a new user through configuring gspotty's Spotify app credentials.
+package setup
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/iamgaru/gspotty/internal/config"
+	"golang.org/x/oauth2/clientcredentials"
+	"golang.org/x/term"
+)
+
+// Validate checks credentials against the token endpoint with a client credentials request
+func Validate(ctx context.Context, endpoints config.Endpoints, credentials config.Credentials) error {
+	cc := &clientcredentials.Config{
+		ClientID:     credentials.ClientID,
+		ClientSecret: credentials.ClientSecret,
+		TokenURL:     endpoints.TokenURL(),
+	}
+	if _, err := cc.Token(ctx); err != nil {
+		return fmt.Errorf("the credentials were rejected: %v", err)
+	}
+	return nil
+}
+
+// prompter reads answers from the user, hiding secrets when reading from a terminal
+type prompter struct {
+	in   *bufio.Reader
+	file *os.File
+	out  io.Writer
+}
+
+// newPrompter creates a prompter for the given input and output
+func newPrompter(in io.Reader, out io.Writer) *prompter {
+	p := &prompter{in: bufio.NewReader(in), out: out}
+	if file, ok := in.(*os.File); ok && term.IsTerminal(int(file.Fd())) {
+		p.file = file
+	}
+	return p
+}
+
+// ask prints a prompt and returns the trimmed answer
+func (p *prompter) ask(prompt string, secret bool) (string, error) {
+	fmt.Fprint(p.out, prompt)
+
+	if secret && p.file != nil {
+		answer, err := term.ReadPassword(int(p.file.Fd()))
+		fmt.Fprintln(p.out)
+		return strings.TrimSpace(string(answer)), err
+	}
+
+	answer, err := p.in.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && answer != "") {
+		return "", err
+	}
+	return strings.TrimSpace(answer), nil
+}
+
+// askRequired repeats a prompt until it gets a non-empty answer
+func (p *prompter) askRequired(prompt string, secret bool) (string, error) {
+	for {
+		answer, err := p.ask(prompt, secret)
+		if err != nil || answer != "" {
+			return answer, err
+		}
+		fmt.Fprintln(p.out, "A value is required.")
+	}
+}
+
+// Run asks for the app's client ID, and its secret unless the PKCE flow is in
+// use, checks them with Spotify and saves them to the credentials file. It
+// asks again until the credentials are accepted or the input ends.
+func Run(ctx context.Context, in io.Reader, out io.Writer, flow string) (config.Credentials, error) {
+	callback, err := config.LoadCallback()
+	if err != nil {
+		return config.Credentials{}, err
+	}
+	path, err := config.CredentialsPath()
+	if err != nil {
+		return config.Credentials{}, err
+	}
+
+	fmt.Fprintln(out, "Let's set up gspotty with your Spotify app.")
+	fmt.Fprintln(out, "1. Go to https://developer.spotify.com/dashboard/ and create an app")
+	fmt.Fprintf(out, "2. Add %s as a redirect URI in the app settings\n", callback.RedirectURI)
+	fmt.Fprintln(out, "3. Copy the client ID and client secret from the app's settings page")
+	fmt.Fprintln(out)
+
+	p := newPrompter(in, out)
+	endpoints := config.LoadEndpoints()
+	for {
+		var credentials config.Credentials
+		if credentials.ClientID, err = p.askRequired("Client ID: ", false); err != nil {
+			return config.Credentials{}, fmt.Errorf("setup cancelled: %v", err)
+		}
+
+		// The PKCE flow is a public client, so there is no secret to check
+		if flow == config.AuthFlowPKCE {
+			fmt.Fprintln(out, "Using PKCE, so no client secret is needed. The client ID is checked at login.")
+		} else {
+			if credentials.ClientSecret, err = p.askRequired("Client secret: ", true); err != nil {
+				return config.Credentials{}, fmt.Errorf("setup cancelled: %v", err)
+			}
+
+			fmt.Fprintln(out, "Checking the credentials with Spotify...")
+			if err := Validate(ctx, endpoints, credentials); err != nil {
+				fmt.Fprintf(out, "%v\nPlease check them and try again.\n\n", err)
+				continue
+			}
+		}
+
+		if err := config.SaveCredentials(credentials); err != nil {
+			return config.Credentials{}, err
+		}
+		fmt.Fprintf(out, "Saved the credentials to %s\n", path)
+		return credentials, nil
+	}
+}
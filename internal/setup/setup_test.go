@@ -0,0 +1,72 @@
+package setup
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/iamgaru/gspotty/internal/config"
+	"github.com/iamgaru/gspotty/internal/fakespotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupEnv points the config directory and accounts service at test locations
+func setupEnv(t *testing.T) *fakespotify.Server {
+	server := fakespotify.NewServer()
+	t.Cleanup(server.Close)
+	server.SetClientCredentials("team_id", "team_secret")
+
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv(config.ClientIDEnv, "")
+	t.Setenv(config.ClientSecretEnv, "")
+	t.Setenv(config.AccountsURLEnv, server.AccountsURL())
+	return server
+}
+
+// TestRun tests that the wizard checks the credentials and saves them privately
+func TestRun(t *testing.T) {
+	setupEnv(t)
+
+	var out bytes.Buffer
+	in := strings.NewReader("\nteam_id\nwrong_secret\nteam_id\nteam_secret\n")
+	credentials, err := Run(context.Background(), in, &out, config.AuthFlowCode)
+	require.NoError(t, err)
+	assert.Equal(t, config.Credentials{ClientID: "team_id", ClientSecret: "team_secret"}, credentials)
+	assert.Contains(t, out.String(), "A value is required.")
+	assert.Contains(t, out.String(), "the credentials were rejected")
+
+	path, err := config.CredentialsPath()
+	require.NoError(t, err)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	loaded, err := config.LoadCredentials(config.AuthFlowCode)
+	require.NoError(t, err)
+	assert.Equal(t, credentials, loaded)
+}
+
+// TestRunPKCE tests that the PKCE flow only asks for the client ID
+func TestRunPKCE(t *testing.T) {
+	setupEnv(t)
+
+	credentials, err := Run(context.Background(), strings.NewReader("team_id\n"), &bytes.Buffer{}, config.AuthFlowPKCE)
+	require.NoError(t, err)
+	assert.Equal(t, config.Credentials{ClientID: "team_id"}, credentials)
+}
+
+// TestRunCancelled tests that running out of input ends the wizard without saving
+func TestRunCancelled(t *testing.T) {
+	setupEnv(t)
+
+	_, err := Run(context.Background(), strings.NewReader("team_id\n"), &bytes.Buffer{}, config.AuthFlowCode)
+	assert.Error(t, err)
+
+	path, err := config.CredentialsPath()
+	require.NoError(t, err)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
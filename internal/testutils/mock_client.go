@@ -2,28 +2,48 @@ package testutils
 
 import (
 	"context"
-	"time"
 
+	"github.com/iamgaru/gspotty/internal/api"
 	"github.com/zmb3/spotify/v2"
 )
 
-// MockSpotifyClient is a mock implementation of the Spotify client for testing
+// MockSpotifyClient is a mock implementation of the Spotify client for testing.
+// It satisfies api.Client.
 type MockSpotifyClient struct {
-	PlayCalled        bool
-	PauseCalled       bool
-	NextCalled        bool
-	PreviousCalled    bool
-	SeekCalled        bool
-	SetVolumeCalled   bool
-	GetPlaybackCalled bool
-	CurrentTrack      *spotify.FullTrack
-	CurrentState      *spotify.PlayerState
-	SearchCalled      bool
-	GetTrackCalled    bool
-	GetAlbumCalled    bool
-	GetPlaylistCalled bool
+	PlayCalled             bool
+	PauseCalled            bool
+	NextCalled             bool
+	PreviousCalled         bool
+	SeekCalled             bool
+	VolumeCalled           bool
+	GetPlaybackCalled      bool
+	CurrentTrack           *spotify.FullTrack
+	CurrentState           *spotify.PlayerState
+	SearchCalled           bool
+	GetTrackCalled         bool
+	GetAlbumCalled         bool
+	GetAlbumTracksCalled   bool
+	GetPlaylistCalled      bool
+	GetPlaylistItemsCalled bool
+	PlayerDevicesCalled    bool
+	TransferCalled         bool
+
+	// Devices is returned by PlayerDevices; when nil a single active device is returned
+	Devices []spotify.PlayerDevice
+	// LastPlayOptions records the options passed to the most recent PlayOpt, PauseOpt, NextOpt or PreviousOpt call
+	LastPlayOptions *spotify.PlayOptions
+	// TransferDeviceID and TransferPlay record the arguments of the most recent TransferPlayback call
+	TransferDeviceID spotify.ID
+	TransferPlay     bool
+	// SearchErr, when set, is returned by Search
+	SearchErr error
+	// SeekPosition records the position passed to the most recent Seek call
+	SeekPosition int
 }
 
+// Ensure the mock satisfies the interface used by the application
+var _ api.Client = (*MockSpotifyClient)(nil)
+
 // Play implements the Play method
 func (m *MockSpotifyClient) Play(ctx context.Context) error {
 	m.PlayCalled = true
@@ -48,21 +68,87 @@ func (m *MockSpotifyClient) Previous(ctx context.Context) error {
 	return nil
 }
 
+// NextOpt implements the NextOpt method
+func (m *MockSpotifyClient) NextOpt(ctx context.Context, opt *spotify.PlayOptions) error {
+	m.NextCalled = true
+	m.LastPlayOptions = opt
+	return nil
+}
+
+// PreviousOpt implements the PreviousOpt method
+func (m *MockSpotifyClient) PreviousOpt(ctx context.Context, opt *spotify.PlayOptions) error {
+	m.PreviousCalled = true
+	m.LastPlayOptions = opt
+	return nil
+}
+
+// TransferPlayback implements the TransferPlayback method
+func (m *MockSpotifyClient) TransferPlayback(ctx context.Context, deviceID spotify.ID, play bool) error {
+	m.TransferCalled = true
+	m.TransferDeviceID = deviceID
+	m.TransferPlay = play
+	return nil
+}
+
+// PlayOpt implements the PlayOpt method
+func (m *MockSpotifyClient) PlayOpt(ctx context.Context, opt *spotify.PlayOptions) error {
+	m.PlayCalled = true
+	m.LastPlayOptions = opt
+	return nil
+}
+
+// PauseOpt implements the PauseOpt method
+func (m *MockSpotifyClient) PauseOpt(ctx context.Context, opt *spotify.PlayOptions) error {
+	m.PauseCalled = true
+	m.LastPlayOptions = opt
+	return nil
+}
+
 // Seek implements the Seek method
-func (m *MockSpotifyClient) Seek(ctx context.Context, position time.Duration) error {
+func (m *MockSpotifyClient) Seek(ctx context.Context, position int) error {
 	m.SeekCalled = true
+	m.SeekPosition = position
 	return nil
 }
 
-// SetVolume implements the SetVolume method
-func (m *MockSpotifyClient) SetVolume(ctx context.Context, volume int) error {
-	m.SetVolumeCalled = true
+// Volume implements the Volume method
+func (m *MockSpotifyClient) Volume(ctx context.Context, percent int) error {
+	m.VolumeCalled = true
 	return nil
 }
 
+// PlayerDevices implements the PlayerDevices method
+func (m *MockSpotifyClient) PlayerDevices(ctx context.Context) ([]spotify.PlayerDevice, error) {
+	m.PlayerDevicesCalled = true
+	if m.Devices != nil {
+		return m.Devices, nil
+	}
+	return []spotify.PlayerDevice{
+		{
+			ID:     "test_device_id",
+			Name:   "Test Device",
+			Type:   "Computer",
+			Active: true,
+			Volume: 50,
+		},
+	}, nil
+}
+
+// PlayerState implements the PlayerState method
+func (m *MockSpotifyClient) PlayerState(ctx context.Context, opts ...spotify.RequestOption) (*spotify.PlayerState, error) {
+	m.GetPlaybackCalled = true
+	if m.CurrentState != nil {
+		return m.CurrentState, nil
+	}
+	return &spotify.PlayerState{}, nil
+}
+
 // Search implements the Search method
 func (m *MockSpotifyClient) Search(ctx context.Context, query string, searchType spotify.SearchType, opts ...spotify.RequestOption) (*spotify.SearchResult, error) {
 	m.SearchCalled = true
+	if m.SearchErr != nil {
+		return nil, m.SearchErr
+	}
 	return &spotify.SearchResult{
 		Tracks: &spotify.FullTrackPage{
 			Tracks: []spotify.FullTrack{
@@ -107,7 +193,7 @@ func (m *MockSpotifyClient) Search(ctx context.Context, query string, searchType
 }
 
 // GetTrack implements the GetTrack method
-func (m *MockSpotifyClient) GetTrack(ctx context.Context, id spotify.ID) (*spotify.FullTrack, error) {
+func (m *MockSpotifyClient) GetTrack(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) (*spotify.FullTrack, error) {
 	m.GetTrackCalled = true
 	return &spotify.FullTrack{
 		SimpleTrack: spotify.SimpleTrack{
@@ -125,7 +211,7 @@ func (m *MockSpotifyClient) GetTrack(ctx context.Context, id spotify.ID) (*spoti
 }
 
 // GetAlbum implements the GetAlbum method
-func (m *MockSpotifyClient) GetAlbum(ctx context.Context, id spotify.ID) (*spotify.FullAlbum, error) {
+func (m *MockSpotifyClient) GetAlbum(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) (*spotify.FullAlbum, error) {
 	m.GetAlbumCalled = true
 	return &spotify.FullAlbum{
 		SimpleAlbum: spotify.SimpleAlbum{
@@ -139,7 +225,7 @@ func (m *MockSpotifyClient) GetAlbum(ctx context.Context, id spotify.ID) (*spoti
 }
 
 // GetPlaylist implements the GetPlaylist method
-func (m *MockSpotifyClient) GetPlaylist(ctx context.Context, id spotify.ID) (*spotify.FullPlaylist, error) {
+func (m *MockSpotifyClient) GetPlaylist(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) (*spotify.FullPlaylist, error) {
 	m.GetPlaylistCalled = true
 	return &spotify.FullPlaylist{
 		SimplePlaylist: spotify.SimplePlaylist{
@@ -169,7 +255,8 @@ func (m *MockSpotifyClient) GetPlaylist(ctx context.Context, id spotify.ID) (*sp
 }
 
 // GetAlbumTracks implements the GetAlbumTracks method
-func (m *MockSpotifyClient) GetAlbumTracks(ctx context.Context, id spotify.ID) (*spotify.SimpleTrackPage, error) {
+func (m *MockSpotifyClient) GetAlbumTracks(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) (*spotify.SimpleTrackPage, error) {
+	m.GetAlbumTracksCalled = true
 	return &spotify.SimpleTrackPage{
 		Tracks: []spotify.SimpleTrack{
 			{
@@ -184,6 +271,29 @@ func (m *MockSpotifyClient) GetAlbumTracks(ctx context.Context, id spotify.ID) (
 	}, nil
 }
 
+// GetPlaylistItems implements the GetPlaylistItems method
+func (m *MockSpotifyClient) GetPlaylistItems(ctx context.Context, playlistID spotify.ID, opts ...spotify.RequestOption) (*spotify.PlaylistItemPage, error) {
+	m.GetPlaylistItemsCalled = true
+	return &spotify.PlaylistItemPage{
+		Items: []spotify.PlaylistItem{
+			{
+				Track: spotify.PlaylistItemTrack{
+					Track: &spotify.FullTrack{
+						SimpleTrack: spotify.SimpleTrack{
+							ID:   "test_track_id",
+							Name: "Test Track",
+							Artists: []spotify.SimpleArtist{
+								{Name: "Test Artist"},
+							},
+							Duration: 180000,
+						},
+					},
+				},
+			},
+		},
+	}, nil
+}
+
 // GetUsersPublicProfile implements the GetUsersPublicProfile method
 func (m *MockSpotifyClient) GetUsersPublicProfile(ctx context.Context, userID spotify.ID) (*spotify.User, error) {
 	return &spotify.User{
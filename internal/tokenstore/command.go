@@ -0,0 +1,91 @@
+package tokenstore
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/iamgaru/gspotty/internal/config"
+	"github.com/iamgaru/gspotty/internal/filelock"
+)
+
+// accountPlaceholder is replaced by the account name in helper commands
+const accountPlaceholder = "{account}"
+
+// Command stores the token through external helper commands, such as
+// "pass show gspotty/{account}" and "pass insert -m -f gspotty/{account}"
+type Command struct {
+	commands config.TokenCommands
+	account  string
+	lockPath string
+}
+
+// NewCommand returns a store that runs the configured helper commands for an
+// account. The read and write commands are required.
+func NewCommand(commands config.TokenCommands, account, lockPath string) (*Command, error) {
+	if commands.Read == "" || commands.Write == "" {
+		return nil, fmt.Errorf("the command token store needs token_read_command and token_write_command")
+	}
+	return &Command{commands: commands, account: account, lockPath: lockPath}, nil
+}
+
+// run runs a helper command through the shell with data on its standard input
+func (c *Command) run(command string, data []byte) ([]byte, error) {
+	command = strings.ReplaceAll(command, accountPlaceholder, c.account)
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("token command %q failed: %v: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// Load returns the read command's output. No output means no stored token.
+func (c *Command) Load() ([]byte, error) {
+	data, err := c.run(c.commands.Read, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, fmt.Errorf("no token from %q: %w", c.commands.Read, fs.ErrNotExist)
+	}
+	return data, nil
+}
+
+// Save passes the token to the write command's standard input
+func (c *Command) Save(data []byte) error {
+	_, err := c.run(c.commands.Write, data)
+	return err
+}
+
+// Delete runs the delete command
+func (c *Command) Delete() error {
+	if c.commands.Delete == "" {
+		return fmt.Errorf("no token_delete_command is configured; remove the token with your helper")
+	}
+	_, err := c.run(c.commands.Delete, nil)
+	return err
+}
+
+// Lock takes the lock on the account's token file, which the helper never touches
+func (c *Command) Lock() (func(), error) {
+	return filelock.Lock(c.lockPath)
+}
+
+// String describes the read command
+func (c *Command) String() string {
+	return "command: " + strings.ReplaceAll(c.commands.Read, accountPlaceholder, c.account)
+}
@@ -0,0 +1,219 @@
+package tokenstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+const (
+	// PassphraseEnv holds the passphrase of the encrypted token store
+	PassphraseEnv = "GSPOTTY_TOKEN_PASSPHRASE"
+
+	envelopeVersion = 1
+	kdfName         = "pbkdf2-sha256"
+	saltSize        = 16
+	keySize         = 32
+)
+
+// iterations is the PBKDF2 work factor for newly encrypted tokens
+var iterations = 600000
+
+// envelope is the on-disk format of an encrypted token
+type envelope struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Encrypted stores the token in a file, encrypted with AES-256-GCM under a
+// key derived from a passphrase with PBKDF2
+type Encrypted struct {
+	file       *File
+	passphrase func() ([]byte, error)
+
+	mu     sync.Mutex
+	cached []byte
+}
+
+// NewEncrypted returns a store that encrypts the token into the file at path,
+// asking passphrase for the passphrase the first time it is needed
+func NewEncrypted(path string, passphrase func() ([]byte, error)) *Encrypted {
+	return &Encrypted{file: NewFile(path), passphrase: passphrase}
+}
+
+// key derives the encryption key for a salt
+func (e *Encrypted) key(salt []byte, rounds int) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.cached == nil {
+		passphrase, err := e.passphrase()
+		if err != nil {
+			return nil, err
+		}
+		if len(passphrase) == 0 {
+			return nil, errors.New("the token passphrase is empty")
+		}
+		e.cached = passphrase
+	}
+	return pbkdf2(e.cached, salt, rounds, keySize), nil
+}
+
+// Load reads and decrypts the token file
+func (e *Encrypted) Load() ([]byte, error) {
+	data, err := e.file.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil || env.Version == 0 {
+		return nil, fmt.Errorf("token file %s is not encrypted (run: gspotty auth login)", e.file)
+	}
+	if env.Version != envelopeVersion || env.KDF != kdfName {
+		return nil, fmt.Errorf("token file %s uses unsupported encryption %d/%s", e.file, env.Version, env.KDF)
+	}
+
+	key, err := e.key(env.Salt, env.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(env.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("token file %s is corrupt", e.file)
+	}
+	plaintext, err := aead.Open(nil, env.Nonce, env.Ciphertext, []byte(kdfName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt token file %s: wrong passphrase or corrupt file", e.file)
+	}
+	return plaintext, nil
+}
+
+// Save encrypts the token under a fresh salt and nonce and writes it
+func (e *Encrypted) Save(data []byte) error {
+	env := envelope{
+		Version:    envelopeVersion,
+		KDF:        kdfName,
+		Iterations: iterations,
+		Salt:       make([]byte, saltSize),
+	}
+	if _, err := rand.Read(env.Salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %v", err)
+	}
+
+	key, err := e.key(env.Salt, env.Iterations)
+	if err != nil {
+		return err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	env.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(env.Nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	env.Ciphertext = aead.Seal(nil, env.Nonce, data, []byte(kdfName))
+
+	sealed, err := json.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("failed to marshal encrypted token: %v", err)
+	}
+	return e.file.Save(sealed)
+}
+
+// Delete removes the token file
+func (e *Encrypted) Delete() error {
+	return e.file.Delete()
+}
+
+// Lock takes the lock on the token file
+func (e *Encrypted) Lock() (func(), error) {
+	return e.file.Lock()
+}
+
+// String returns the token file's path
+func (e *Encrypted) String() string {
+	return e.file.String() + " (encrypted)"
+}
+
+// newAEAD returns AES-GCM for a key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2 derives a key from a password with PBKDF2-HMAC-SHA256 (RFC 8018)
+func pbkdf2(password, salt []byte, rounds, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	blocks := (keyLen + prf.Size() - 1) / prf.Size()
+
+	key := make([]byte, 0, blocks*prf.Size())
+	u := make([]byte, 0, prf.Size())
+	for block := 1; block <= blocks; block++ {
+		// U1 = PRF(password, salt || INT(block))
+		prf.Reset()
+		prf.Write(salt)
+		binary.Write(prf, binary.BigEndian, uint32(block))
+		u = prf.Sum(u[:0])
+		t := append([]byte(nil), u...)
+
+		// Ui = PRF(password, Ui-1), T = U1 ^ U2 ^ ... ^ Uc
+		for i := 1; i < rounds; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+var (
+	passphraseOnce  sync.Once
+	passphraseValue []byte
+	passphraseErr   error
+)
+
+// Passphrase returns the token passphrase from GSPOTTY_TOKEN_PASSPHRASE, or
+// asks for it once on the terminal
+func Passphrase() ([]byte, error) {
+	passphraseOnce.Do(func() {
+		if value := os.Getenv(PassphraseEnv); value != "" {
+			passphraseValue = []byte(value)
+			return
+		}
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			passphraseErr = fmt.Errorf("the encrypted token store needs a passphrase: set %s", PassphraseEnv)
+			return
+		}
+		fmt.Fprint(os.Stderr, "Token passphrase: ")
+		value, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		passphraseValue, passphraseErr = []byte(strings.TrimSpace(string(value))), err
+	})
+	return passphraseValue, passphraseErr
+}
@@ -0,0 +1,116 @@
+// Package tokenstore keeps an account's OAuth token, either in a file (plain
+// or encrypted with a passphrase) or through an external helper command such
+// as pass, so refresh tokens need not sit on disk in the clear.
+package tokenstore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/iamgaru/gspotty/internal/config"
+	"github.com/iamgaru/gspotty/internal/filelock"
+)
+
+// Backends that the token_store setting selects
+const (
+	BackendFile      = "file"
+	BackendEncrypted = "encrypted"
+	BackendCommand   = "command"
+)
+
+// Store keeps the serialized token of one account
+type Store interface {
+	// Load returns the stored token, or an error wrapping fs.ErrNotExist if there is none
+	Load() ([]byte, error)
+	// Save replaces the stored token
+	Save(data []byte) error
+	// Delete removes the stored token, returning an error wrapping fs.ErrNotExist if there is none
+	Delete() error
+	// Lock serializes access to the token between processes
+	Lock() (func(), error)
+	// String describes where the token is kept
+	String() string
+}
+
+// Open returns the store selected by the settings for an account. path is the
+// account's token file, which also serves as the lock for every backend.
+func Open(settings config.Settings, accountName, path string) (Store, error) {
+	switch settings.TokenStore {
+	case "", BackendFile:
+		return NewFile(path), nil
+	case BackendEncrypted:
+		return NewEncrypted(path, Passphrase), nil
+	case BackendCommand:
+		return NewCommand(settings.TokenCommands, accountName, path)
+	default:
+		return nil, fmt.Errorf("unknown token store %q: must be %s, %s or %s", settings.TokenStore, BackendFile, BackendEncrypted, BackendCommand)
+	}
+}
+
+// File stores the token as a file readable only by the user
+type File struct {
+	path string
+}
+
+// NewFile returns a store that keeps the token in the file at path
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+// Load reads the token file, refusing files that other users can read
+func (f *File) Load() ([]byte, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, err
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("token file %s has permissions %#o, expected 0600 (fix with: chmod 600 %s)",
+			f.path, info.Mode().Perm(), f.path)
+	}
+	return os.ReadFile(f.path)
+}
+
+// Save writes the token to a temporary file that is renamed into place, so a
+// crash or a concurrent reader never sees a partially written token
+func (f *File) Save(data []byte) error {
+	// CreateTemp restricts the file permissions to the current user only
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create token file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write token file: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write token file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write token file: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("failed to replace token file: %v", err)
+	}
+	return nil
+}
+
+// Delete removes the token file
+func (f *File) Delete() error {
+	return os.Remove(f.path)
+}
+
+// Lock takes the lock on the token file
+func (f *File) Lock() (func(), error) {
+	return filelock.Lock(f.path)
+}
+
+// String returns the token file's path
+func (f *File) String() string {
+	return f.path
+}
@@ -0,0 +1,162 @@
+package tokenstore
+
+import (
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/iamgaru/gspotty/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const token = `{"refresh_token":"secret-refresh-token"}`
+
+// testStore tests saving, loading and deleting through a store
+func testStore(t *testing.T, store Store) {
+	_, err := store.Load()
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+
+	require.NoError(t, store.Save([]byte(token)))
+	data, err := store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, token, string(data))
+
+	unlock, err := store.Lock()
+	require.NoError(t, err)
+	unlock()
+
+	require.NoError(t, store.Delete())
+	_, err = store.Load()
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+}
+
+// TestFile tests the plaintext store and its permission check
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	testStore(t, NewFile(path))
+
+	require.NoError(t, NewFile(path).Save([]byte(token)))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	if runtime.GOOS != "windows" {
+		require.NoError(t, os.Chmod(path, 0644))
+		_, err = NewFile(path).Load()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "permissions")
+	}
+}
+
+// TestEncrypted tests that the encrypted store keeps the token out of the file and needs the passphrase
+func TestEncrypted(t *testing.T) {
+	original := iterations
+	defer func() { iterations = original }()
+	iterations = 1000
+
+	passphrase := func(value string) func() ([]byte, error) {
+		return func() ([]byte, error) { return []byte(value), nil }
+	}
+
+	path := filepath.Join(t.TempDir(), "token.json")
+	testStore(t, NewEncrypted(path, passphrase("correct horse")))
+
+	require.NoError(t, NewEncrypted(path, passphrase("correct horse")).Save([]byte(token)))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret-refresh-token")
+
+	_, err = NewEncrypted(path, passphrase("wrong")).Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "wrong passphrase")
+
+	_, err = NewEncrypted(path, passphrase("")).Load()
+	assert.Error(t, err)
+
+	// A token saved by the plaintext store is not silently accepted
+	require.NoError(t, NewFile(path).Save([]byte(token)))
+	_, err = NewEncrypted(path, passphrase("correct horse")).Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not encrypted")
+}
+
+// TestPBKDF2 tests the key derivation against the published PBKDF2-HMAC-SHA256 vectors
+func TestPBKDF2(t *testing.T) {
+	tests := []struct {
+		rounds   int
+		expected string
+	}{
+		{1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	}
+
+	for _, tt := range tests {
+		key := pbkdf2([]byte("password"), []byte("salt"), tt.rounds, 32)
+		assert.Equal(t, tt.expected, hex.EncodeToString(key))
+	}
+	assert.Len(t, pbkdf2([]byte("password"), []byte("salt"), 1, 40), 40)
+}
+
+// TestCommand tests the helper command store with shell commands standing in for pass
+func TestCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test commands need a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	store, err := NewCommand(config.TokenCommands{
+		Read:   "cat " + dir + "/{account} 2>/dev/null || true",
+		Write:  "cat > " + dir + "/{account}",
+		Delete: "rm " + dir + "/{account}",
+	}, "work", filepath.Join(dir, "lock"))
+	require.NoError(t, err)
+	assert.Equal(t, "command: cat "+dir+"/work 2>/dev/null || true", store.String())
+
+	_, err = store.Load()
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+
+	require.NoError(t, store.Save([]byte(token)))
+	_, err = os.Stat(filepath.Join(dir, "work"))
+	require.NoError(t, err)
+
+	data, err := store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, token, string(data))
+	require.NoError(t, store.Delete())
+
+	failing, err := NewCommand(config.TokenCommands{Read: "echo locked >&2; exit 1", Write: "true"}, "work", filepath.Join(dir, "lock"))
+	require.NoError(t, err)
+	_, err = failing.Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "locked")
+	assert.Error(t, failing.Delete())
+}
+
+// TestOpen tests selecting the backend from the settings
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	settings := config.DefaultSettings()
+
+	store, err := Open(settings, "default", path)
+	require.NoError(t, err)
+	assert.IsType(t, &File{}, store)
+
+	settings.TokenStore = BackendEncrypted
+	store, err = Open(settings, "default", path)
+	require.NoError(t, err)
+	assert.IsType(t, &Encrypted{}, store)
+
+	settings.TokenStore = BackendCommand
+	_, err = Open(settings, "default", path)
+	assert.Error(t, err)
+
+	settings.TokenStore = "keychain"
+	_, err = Open(settings, "default", path)
+	assert.Error(t, err)
+}
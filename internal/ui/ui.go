@@ -6,9 +6,12 @@ import (
 	"os/exec"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
+	"github.com/iamgaru/gspotty/internal/api"
 	"github.com/iamgaru/gspotty/internal/player"
+	"github.com/iamgaru/gspotty/internal/retry"
 	"github.com/rivo/tview"
 	"github.com/zmb3/spotify/v2"
 )
@@ -36,15 +39,20 @@ type ResultsUI struct {
 	frame        *tview.Frame
 	results      interface{}
 	resultType   string
-	client       *spotify.Client
+	client       api.Client
 	ctx          context.Context
 	showDetails  bool
 	keepPlaying  bool   // Whether to keep music playing when exiting player
 	returnToMenu func() // Function to return to the main menu
+	title        string
+	statusUntil  time.Time // the frame shows a status message until then
+	offline      bool      // results come from the cache, so playback is disabled
+
+	restoreNotifier func() // hands retry status messages back once the results close
 }
 
 // NewResultsUI creates a new scrollable UI for displaying search results
-func NewResultsUI(resultType string, ctx context.Context, client *spotify.Client, showDetails bool) *ResultsUI {
+func NewResultsUI(resultType string, ctx context.Context, client api.Client, showDetails bool) *ResultsUI {
 	app := tview.NewApplication()
 	table := tview.NewTable().
 		SetBorders(false).
@@ -58,6 +66,7 @@ func NewResultsUI(resultType string, ctx context.Context, client *spotify.Client
 		ctx:         ctx,
 		showDetails: showDetails,
 		keepPlaying: false, // Default to false
+		offline:     api.IsOffline(client),
 	}
 
 	// Set up key bindings
@@ -66,11 +75,11 @@ func NewResultsUI(resultType string, ctx context.Context, client *spotify.Client
 		case tcell.KeyEscape, tcell.KeyCtrlC:
 			// Handle the case where returnToMenu is provided
 			if ui.returnToMenu != nil {
-				app.Stop()
+				ui.stop()
 				ui.returnToMenu()
 				return nil
 			}
-			app.Stop()
+			ui.stop()
 		case tcell.KeyEnter:
 			// Get the selected row
 			row, _ := table.GetSelection()
@@ -123,8 +132,70 @@ func NewResultsUI(resultType string, ctx context.Context, client *spotify.Client
 	return ui
 }
 
+// setFrameText sets the title, the key help and an optional status line around the results
+func (ui *ResultsUI) setFrameText(status string) {
+	ui.frame.Clear()
+	ui.frame.AddText(ui.title, true, tview.AlignCenter, tcell.ColorWhite)
+	if ui.offline {
+		ui.frame.AddText("[OFFLINE] Showing cached results • Playback needs a connection to Spotify", true, tview.AlignCenter, tcell.ColorYellow)
+	}
+
+	// Add different bottom text based on whether returnToMenu is available
+	if ui.returnToMenu != nil {
+		ui.frame.AddText("↑/↓: Navigate • Enter: Show Details • Click on Spotify Link to Open • ESC/Ctrl-C: Return to Menu", false, tview.AlignCenter, tcell.ColorWhite)
+	} else {
+		ui.frame.AddText("↑/↓: Navigate • Enter: Show Details • Click on Spotify Link to Open • ESC/Ctrl-C: Exit", false, tview.AlignCenter, tcell.ColorWhite)
+	}
+
+	if status != "" {
+		ui.frame.AddText(status, false, tview.AlignCenter, tcell.ColorYellow)
+	}
+}
+
+// showStatus shows a status message, such as a rate limit wait, until the wait is over
+func (ui *ResultsUI) showStatus(message string, wait time.Duration) {
+	// Requests made on the event loop notify from it, so queue the update
+	// without waiting for the loop to run it
+	go ui.app.QueueUpdateDraw(func() {
+		ui.statusUntil = time.Now().Add(wait)
+		ui.setFrameText(message)
+	})
+	time.AfterFunc(wait, func() {
+		ui.app.QueueUpdateDraw(func() {
+			// A newer status may still apply
+			if !time.Now().Before(ui.statusUntil) {
+				ui.setFrameText("")
+			}
+		})
+	})
+}
+
+// releaseNotifier stops routing retry status messages to the results
+func (ui *ResultsUI) releaseNotifier() {
+	if ui.restoreNotifier != nil {
+		ui.restoreNotifier()
+		ui.restoreNotifier = nil
+	}
+}
+
+// stop stops the results UI. The player or menu shown next may run before
+// the event loop returns, so the notifier is released first.
+func (ui *ResultsUI) stop() {
+	ui.releaseNotifier()
+	ui.app.Stop()
+}
+
+// playButtons adds a Play button in front of the buttons, unless playback is
+// disabled because the results come from the cache
+func (ui *ResultsUI) playButtons(buttons ...string) []string {
+	if ui.offline {
+		return buttons
+	}
+	return append([]string{"Play"}, buttons...)
+}
+
 // DisplayTrackResults displays track search results in a scrollable UI
-func (ui *ResultsUI) DisplayTrackResults(ctx context.Context, client *spotify.Client, tracks []spotify.FullTrack) {
+func (ui *ResultsUI) DisplayTrackResults(ctx context.Context, client api.Client, tracks []spotify.FullTrack) {
 	ui.results = tracks
 
 	// Set up table headers
@@ -160,7 +231,7 @@ func (ui *ResultsUI) DisplayTrackResults(ctx context.Context, client *spotify.Cl
 }
 
 // DisplayAlbumResults displays album search results in a scrollable UI
-func (ui *ResultsUI) DisplayAlbumResults(ctx context.Context, client *spotify.Client, albums []spotify.SimpleAlbum) {
+func (ui *ResultsUI) DisplayAlbumResults(ctx context.Context, client api.Client, albums []spotify.SimpleAlbum) {
 	ui.results = albums
 
 	// Set up table headers
@@ -196,7 +267,7 @@ func (ui *ResultsUI) DisplayAlbumResults(ctx context.Context, client *spotify.Cl
 }
 
 // DisplayPlaylistResults displays playlist search results in a scrollable UI
-func (ui *ResultsUI) DisplayPlaylistResults(ctx context.Context, client *spotify.Client, playlists []spotify.SimplePlaylist) {
+func (ui *ResultsUI) DisplayPlaylistResults(ctx context.Context, client api.Client, playlists []spotify.SimplePlaylist) {
 	ui.results = playlists
 
 	// Set up table headers
@@ -228,22 +299,21 @@ func (ui *ResultsUI) DisplayPlaylistResults(ctx context.Context, client *spotify
 // setupLayout sets up the UI layout
 func (ui *ResultsUI) setupLayout(title string) {
 	// Create a frame to hold the table
+	ui.title = title
 	ui.frame = tview.NewFrame(ui.table).
-		SetBorders(0, 0, 0, 0, 0, 0).
-		AddText(title, true, tview.AlignCenter, tcell.ColorWhite)
+		SetBorders(0, 0, 0, 0, 0, 0)
+	ui.setFrameText("")
 
-	// Add different bottom text based on whether returnToMenu is available
-	if ui.returnToMenu != nil {
-		ui.frame.AddText("↑/↓: Navigate • Enter: Show Details • Click on Spotify Link to Open • ESC/Ctrl-C: Return to Menu", false, tview.AlignCenter, tcell.ColorWhite)
-	} else {
-		ui.frame.AddText("↑/↓: Navigate • Enter: Show Details • Click on Spotify Link to Open • ESC/Ctrl-C: Exit", false, tview.AlignCenter, tcell.ColorWhite)
-	}
+	// Show retry waits under the results while they are on screen
+	ui.restoreNotifier = retry.SetNotifier(ui.showStatus)
 
 	// Set the root and run the application
 	ui.app.SetRoot(ui.frame, true).EnableMouse(true)
 
 	// Run the application and handle errors gracefully
-	if err := ui.app.Run(); err != nil {
+	err := ui.app.Run()
+	ui.releaseNotifier()
+	if err != nil {
 		// Check if the error is an EOF error
 		if err.Error() == "EOF" {
 			// If we have a returnToMenu function, call it
@@ -262,18 +332,37 @@ func (ui *ResultsUI) setupLayout(title string) {
 	}
 }
 
+// details holds what a result's details need from Spotify, loaded off the
+// event loop so that retry waits do not freeze the results
+type details struct {
+	albumTracks *spotify.SimpleTrackPage
+	playlist    *spotify.FullPlaylist
+	err         error
+}
+
+// loadDetails loads the tracks of an album, or of a playlist when details are
+// shown, for the selected search result
+func (ui *ResultsUI) loadDetails(row int) details {
+	var loaded details
+	switch ui.resultType {
+	case "album":
+		if albums, ok := ui.results.([]spotify.SimpleAlbum); ok && row-1 < len(albums) {
+			loaded.albumTracks, loaded.err = ui.client.GetAlbumTracks(ui.ctx, albums[row-1].ID)
+		}
+	case "playlist":
+		if playlists, ok := ui.results.([]spotify.SimplePlaylist); ok && ui.showDetails && row-1 < len(playlists) {
+			loaded.playlist, loaded.err = ui.client.GetPlaylist(ui.ctx, playlists[row-1].ID)
+		}
+	}
+	return loaded
+}
+
 // displayDetails displays detailed information about the selected search result
 func (ui *ResultsUI) displayDetails(row int) {
 	if row == 0 {
 		return // Skip header row
 	}
 
-	var text string
-	var spotifyLink string
-	var spotifyURI string
-	var canPlay bool = false
-	var selectedTrack *spotify.FullTrack = nil
-
 	// Create a loading modal to show while fetching data
 	loadingModal := tview.NewModal().
 		SetText("Loading...").
@@ -283,6 +372,22 @@ func (ui *ResultsUI) displayDetails(row int) {
 	// Show the loading modal immediately
 	ui.app.SetRoot(loadingModal, true)
 
+	go func() {
+		loaded := ui.loadDetails(row)
+		ui.app.QueueUpdateDraw(func() {
+			ui.openDetails(row, loaded)
+		})
+	}()
+}
+
+// openDetails shows the details of the selected search result once they are loaded
+func (ui *ResultsUI) openDetails(row int, loaded details) {
+	var text string
+	var spotifyLink string
+	var spotifyURI string
+	var canPlay bool = false
+	var selectedTrack *spotify.FullTrack = nil
+
 	switch ui.resultType {
 	case "track":
 		if tracks, ok := ui.results.([]spotify.FullTrack); ok && row-1 < len(tracks) {
@@ -317,12 +422,12 @@ func (ui *ResultsUI) displayDetails(row int) {
 			// Create the track modal
 			modal := tview.NewModal().
 				SetText(text).
-				AddButtons([]string{"Play", "Open in Spotify", "Close"}).
+				AddButtons(ui.playButtons("Open in Spotify", "Close")).
 				SetDoneFunc(func(buttonIndex int, buttonLabel string) {
 					switch buttonLabel {
 					case "Play":
 						// Stop the current application
-						ui.app.Stop()
+						ui.stop()
 
 						// Start playback
 						playerUI.Play()
@@ -377,8 +482,8 @@ func (ui *ResultsUI) displayDetails(row int) {
 				spotifyLink,
 				album.URI)
 
-			// Get album tracks
-			albumTracks, err := ui.client.GetAlbumTracks(ui.ctx, album.ID)
+			// The album tracks were loaded off the event loop
+			albumTracks, err := loaded.albumTracks, loaded.err
 			if err == nil && albumTracks != nil && len(albumTracks.Tracks) > 0 {
 				// Create a list view for tracks
 				trackList := tview.NewList().
@@ -400,64 +505,43 @@ func (ui *ResultsUI) displayDetails(row int) {
 								// Show a modal with options for this track
 								trackModal := tview.NewModal().
 									SetText(fmt.Sprintf("Track: %s\nDuration: %s", track.Name, formatDuration(track.Duration))).
-									AddButtons([]string{"Play", "Open in Spotify", "Back"}).
+									AddButtons(ui.playButtons("Open in Spotify", "Back")).
 									SetDoneFunc(func(buttonIndex int, buttonLabel string) {
 										switch buttonLabel {
 										case "Play":
-											// Get the full track to play
-											fullTrack, err := ui.client.GetTrack(ui.ctx, spotify.ID(trackID))
-											if err != nil {
-												infoModal := tview.NewModal().
-													SetText(fmt.Sprintf("Error getting track: %v", err)).
-													AddButtons([]string{"OK"}).
-													SetDoneFunc(func(buttonIndex int, buttonLabel string) {
-														ui.app.SetRoot(trackList, true)
-													})
-												ui.app.SetRoot(infoModal, true)
-												return
-											}
-
-											// Stop the current application
-											ui.app.Stop()
-
-											// Create a new player UI for the selected track
-											playerUI := player.NewPlayerUI(ui.ctx, ui.client, *fullTrack, ui.keepPlaying, false)
-
-											// If we're in playlist mode, set the playlist tracks
-											if ui.resultType == "playlist" {
-												playlists := ui.results.([]spotify.SimplePlaylist)
-												if row-1 < len(playlists) {
-													playlist := playlists[row-1]
-													// Get the full playlist with tracks
-													fullPlaylist, err := ui.client.GetPlaylist(ui.ctx, playlist.ID)
-													if err == nil && fullPlaylist != nil {
-														playerUI.SetPlaylistTracks(fullPlaylist.Tracks.Tracks)
+											// Get the full track to play off the event loop
+											go func() {
+												fullTrack, err := ui.client.GetTrack(ui.ctx, spotify.ID(trackID))
+												ui.app.QueueUpdateDraw(func() {
+													if err != nil {
+														infoModal := tview.NewModal().
+															SetText(fmt.Sprintf("Error getting track: %v", err)).
+															AddButtons([]string{"OK"}).
+															SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+																ui.app.SetRoot(trackList, true)
+															})
+														ui.app.SetRoot(infoModal, true)
+														return
 													}
-												}
-											} else if ui.resultType == "track" {
-												// Set the search results tracks for track search mode
-												tracks := ui.results.([]spotify.FullTrack)
-												playerUI.SetSearchTracks(tracks)
-											} else if ui.resultType == "album" {
-												// Set the album tracks for album mode
-												albums := ui.results.([]spotify.SimpleAlbum)
-												if row-1 < len(albums) {
-													album := albums[row-1]
-													// Get the album tracks
-													albumTracks, err := ui.client.GetAlbumTracks(ui.ctx, album.ID)
-													if err == nil && albumTracks != nil {
-														playerUI.SetAlbumTracks(albumTracks.Tracks)
-													}
-												}
-											}
 
-											// Set up the return to results function if needed
-											if ui.returnToMenu != nil {
-												playerUI.SetReturnToMenuFunction(ui.returnToMenu)
-											}
+													// Stop the current application
+													ui.stop()
+
+													// Create a new player UI for the selected track
+													playerUI := player.NewPlayerUI(ui.ctx, ui.client, *fullTrack, ui.keepPlaying, false)
 
-											// Start playback
-											playerUI.Play()
+													// Queue the tracks around the one that plays
+													ui.queueTracks(playerUI, loaded)
+
+													// Set up the return to results function if needed
+													if ui.returnToMenu != nil {
+														playerUI.SetReturnToMenuFunction(ui.returnToMenu)
+													}
+
+													// Start playback
+													playerUI.Play()
+												})
+											}()
 
 										case "Open in Spotify":
 											// Try to open the link in the default browser
@@ -534,7 +618,7 @@ func (ui *ResultsUI) displayDetails(row int) {
 
 			// Add playlist tracks if showDetails is true
 			if ui.showDetails {
-				fullPlaylist, err := ui.client.GetPlaylist(ui.ctx, playlist.ID)
+				fullPlaylist, err := loaded.playlist, loaded.err
 				if err == nil && fullPlaylist != nil && len(fullPlaylist.Tracks.Tracks) > 0 {
 					// Create a list view for tracks
 					trackList := tview.NewList().
@@ -573,43 +657,18 @@ func (ui *ResultsUI) displayDetails(row int) {
 									trackModal := tview.NewModal().
 										SetText(fmt.Sprintf("Track: %s\nArtist: %s\nDuration: %s",
 											t.Name, t.Artists[0].Name, formatDuration(t.Duration))).
-										AddButtons([]string{"Play", "Open in Spotify", "Back"}).
+										AddButtons(ui.playButtons("Open in Spotify", "Back")).
 										SetDoneFunc(func(buttonIndex int, buttonLabel string) {
 											switch buttonLabel {
 											case "Play":
 												// Stop the current application
-												ui.app.Stop()
+												ui.stop()
 
 												// Create a new player UI for the selected track
 												playerUI := player.NewPlayerUI(ui.ctx, ui.client, t, ui.keepPlaying, false)
 
-												// If we're in playlist mode, set the playlist tracks
-												if ui.resultType == "playlist" {
-													playlists := ui.results.([]spotify.SimplePlaylist)
-													if row-1 < len(playlists) {
-														playlist := playlists[row-1]
-														// Get the full playlist with tracks
-														fullPlaylist, err := ui.client.GetPlaylist(ui.ctx, playlist.ID)
-														if err == nil && fullPlaylist != nil {
-															playerUI.SetPlaylistTracks(fullPlaylist.Tracks.Tracks)
-														}
-													}
-												} else if ui.resultType == "track" {
-													// Set the search results tracks for track search mode
-													tracks := ui.results.([]spotify.FullTrack)
-													playerUI.SetSearchTracks(tracks)
-												} else if ui.resultType == "album" {
-													// Set the album tracks for album mode
-													albums := ui.results.([]spotify.SimpleAlbum)
-													if row-1 < len(albums) {
-														album := albums[row-1]
-														// Get the album tracks
-														albumTracks, err := ui.client.GetAlbumTracks(ui.ctx, album.ID)
-														if err == nil && albumTracks != nil {
-															playerUI.SetAlbumTracks(albumTracks.Tracks)
-														}
-													}
-												}
+												// Queue the tracks around the one that plays
+												ui.queueTracks(playerUI, loaded)
 
 												// Set up the return to results function if needed
 												if ui.returnToMenu != nil {
@@ -680,13 +739,17 @@ func (ui *ResultsUI) displayDetails(row int) {
 		}
 	}
 
-	if canPlay {
+	// Results whose tracks could not be loaded still show their details
+	if text != "" {
 		// Add buttons to the modal
 		buttons := []string{"Open in Spotify", "Close"}
 
 		// Add "Return to Menu" button if returnToMenu function is set
 		if ui.returnToMenu != nil {
-			buttons = []string{"Play", "Open in Spotify", "Close", "Return to Menu"}
+			buttons = []string{"Open in Spotify", "Close", "Return to Menu"}
+			if canPlay {
+				buttons = ui.playButtons(buttons...)
+			}
 		}
 
 		// Create a modal
@@ -698,38 +761,13 @@ func (ui *ResultsUI) displayDetails(row int) {
 				switch buttonLabel {
 				case "Play":
 					// Stop the current application
-					ui.app.Stop()
+					ui.stop()
 
 					// Create a new player UI for the selected track
 					playerUI := player.NewPlayerUI(ui.ctx, ui.client, *selectedTrack, ui.keepPlaying, false)
 
-					// If we're in playlist mode, set the playlist tracks
-					if ui.resultType == "playlist" {
-						playlists := ui.results.([]spotify.SimplePlaylist)
-						if row-1 < len(playlists) {
-							playlist := playlists[row-1]
-							// Get the full playlist with tracks
-							fullPlaylist, err := ui.client.GetPlaylist(ui.ctx, playlist.ID)
-							if err == nil && fullPlaylist != nil {
-								playerUI.SetPlaylistTracks(fullPlaylist.Tracks.Tracks)
-							}
-						}
-					} else if ui.resultType == "track" {
-						// Set the search results tracks for track search mode
-						tracks := ui.results.([]spotify.FullTrack)
-						playerUI.SetSearchTracks(tracks)
-					} else if ui.resultType == "album" {
-						// Set the album tracks for album mode
-						albums := ui.results.([]spotify.SimpleAlbum)
-						if row-1 < len(albums) {
-							album := albums[row-1]
-							// Get the album tracks
-							albumTracks, err := ui.client.GetAlbumTracks(ui.ctx, album.ID)
-							if err == nil && albumTracks != nil {
-								playerUI.SetAlbumTracks(albumTracks.Tracks)
-							}
-						}
-					}
+					// Queue the tracks around the one that plays
+					ui.queueTracks(playerUI, loaded)
 
 					// Set up the return to results function if needed
 					if ui.returnToMenu != nil {
@@ -762,7 +800,7 @@ func (ui *ResultsUI) displayDetails(row int) {
 						ui.app.SetRoot(infoModal, true)
 					}
 				case "Return to Menu":
-					ui.app.Stop()
+					ui.stop()
 					ui.returnToMenu()
 				case "Close":
 					ui.app.SetRoot(ui.frame, true)
@@ -774,6 +812,19 @@ func (ui *ResultsUI) displayDetails(row int) {
 	}
 }
 
+// queueTracks gives the player the tracks around the one it plays: the
+// search results, or the album or playlist loaded for the details
+func (ui *ResultsUI) queueTracks(playerUI *player.PlayerUI, loaded details) {
+	switch {
+	case ui.resultType == "track":
+		playerUI.SetSearchTracks(ui.results.([]spotify.FullTrack))
+	case loaded.playlist != nil:
+		playerUI.SetPlaylistTracks(loaded.playlist.Tracks.Tracks)
+	case loaded.albumTracks != nil:
+		playerUI.SetAlbumTracks(loaded.albumTracks.Tracks)
+	}
+}
+
 // formatDuration formats milliseconds into a human-readable duration string (MM:SS)
 func formatDuration(ms spotify.Numeric) string {
 	totalSeconds := int(ms) / 1000
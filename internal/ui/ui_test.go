@@ -2,49 +2,74 @@ package ui
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"testing"
+	"time"
 
+	"github.com/gdamore/tcell/v2"
+	"github.com/iamgaru/gspotty/internal/api"
+	"github.com/iamgaru/gspotty/internal/fakespotify"
+	"github.com/iamgaru/gspotty/internal/retry"
 	"github.com/iamgaru/gspotty/internal/testutils"
+	"github.com/rivo/tview"
 	"github.com/stretchr/testify/assert"
 	"github.com/zmb3/spotify/v2"
 )
 
-// MockResultsUI is a mock implementation of the ResultsUI for testing
-type MockResultsUI struct {
-	keepPlaying  bool
-	returnToMenu func()
-}
-
-// NewMockResultsUI creates a new mock results UI
-func NewMockResultsUI(resultType string, ctx context.Context, client interface{}, showDetails bool) *MockResultsUI {
-	return &MockResultsUI{
-		keepPlaying: false,
-	}
-}
+// startWithSimulationScreen runs display on a simulated screen until the
+// returned function stops the application
+func startWithSimulationScreen(ui *ResultsUI, display func()) func() {
+	ui.app.SetScreen(tcell.NewSimulationScreen("UTF-8"))
 
-// SetKeepPlayingFlag sets the keep playing flag
-func (ui *MockResultsUI) SetKeepPlayingFlag(keepPlaying bool) {
-	ui.keepPlaying = keepPlaying
-}
+	done := make(chan struct{})
+	go func() {
+		display()
+		close(done)
+	}()
 
-// SetReturnToMenuFunction sets the return to menu function
-func (ui *MockResultsUI) SetReturnToMenuFunction(returnFunc func()) {
-	ui.returnToMenu = returnFunc
+	// QueueUpdate blocks until the event loop has processed it
+	ui.app.QueueUpdate(func() {})
+	return func() {
+		ui.app.Stop()
+		<-done
+	}
 }
 
-// DisplayTrackResults displays track search results
-func (ui *MockResultsUI) DisplayTrackResults(ctx context.Context, client interface{}, tracks []spotify.FullTrack) {
-	// Mock implementation
+// runWithSimulationScreen runs display on a simulated screen and stops the
+// application once its event loop is up
+func runWithSimulationScreen(ui *ResultsUI, display func()) {
+	startWithSimulationScreen(ui, display)()
 }
 
-// DisplayAlbumResults displays album search results
-func (ui *MockResultsUI) DisplayAlbumResults(ctx context.Context, client interface{}, albums []spotify.SimpleAlbum) {
-	// Mock implementation
+// onEventLoop runs f on the event loop, failing the test if the loop is stuck
+func onEventLoop(t *testing.T, ui *ResultsUI, f func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go ui.app.QueueUpdate(func() {
+		f()
+		close(done)
+	})
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the event loop is blocked")
+	}
 }
 
-// DisplayPlaylistResults displays playlist search results
-func (ui *MockResultsUI) DisplayPlaylistResults(ctx context.Context, client interface{}, playlists []spotify.SimplePlaylist) {
-	// Mock implementation
+// waitForTrackList waits until the details of a result show its track list
+func waitForTrackList(t *testing.T, ui *ResultsUI) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		var shown bool
+		onEventLoop(t, ui, func() {
+			_, shown = ui.app.GetFocus().(*tview.List)
+		})
+		if shown {
+			return
+		}
+	}
+	t.Fatal("the track list was not shown")
 }
 
 // TestResultsUI tests the ResultsUI functionality
@@ -68,7 +93,7 @@ func TestResultsUI(t *testing.T) {
 	}
 
 	// Create a new ResultsUI instance
-	ui := NewMockResultsUI("track", context.Background(), mockClient, false)
+	ui := NewResultsUI("track", context.Background(), mockClient, false)
 
 	// Test initial state
 	assert.False(t, ui.keepPlaying)
@@ -92,8 +117,13 @@ func TestResultsUI(t *testing.T) {
 	// Test track results display
 	t.Run("Track Results Display", func(t *testing.T) {
 		tracks := []spotify.FullTrack{testTrack}
-		ui.DisplayTrackResults(context.Background(), mockClient, tracks)
-		// Note: We can't easily test the visual output, but we can verify the function doesn't panic
+		runWithSimulationScreen(ui, func() {
+			ui.DisplayTrackResults(context.Background(), mockClient, tracks)
+		})
+		assert.Equal(t, 2, ui.table.GetRowCount())
+		assert.Equal(t, "Test Track", ui.table.GetCell(1, 1).Text)
+		assert.Equal(t, "Test Artist", ui.table.GetCell(1, 2).Text)
+		assert.Equal(t, "https://open.spotify.com/track/test_track_id", ui.table.GetCell(1, 5).Text)
 	})
 
 	// Test album results display
@@ -107,8 +137,17 @@ func TestResultsUI(t *testing.T) {
 				},
 			},
 		}
-		ui.DisplayAlbumResults(context.Background(), mockClient, albums)
-		// Note: We can't easily test the visual output, but we can verify the function doesn't panic
+		albumUI := NewResultsUI("album", context.Background(), mockClient, false)
+		stop := startWithSimulationScreen(albumUI, func() {
+			albumUI.DisplayAlbumResults(context.Background(), mockClient, albums)
+		})
+		defer stop()
+		assert.Equal(t, "Test Album", albumUI.table.GetCell(1, 1).Text)
+
+		// Opening an album row loads its tracks through the client
+		onEventLoop(t, albumUI, func() { albumUI.displayDetails(1) })
+		waitForTrackList(t, albumUI)
+		assert.True(t, mockClient.GetAlbumTracksCalled)
 	})
 
 	// Test playlist results display
@@ -119,9 +158,111 @@ func TestResultsUI(t *testing.T) {
 				Name: "Test Playlist",
 			},
 		}
-		ui.DisplayPlaylistResults(context.Background(), mockClient, playlists)
-		// Note: We can't easily test the visual output, but we can verify the function doesn't panic
+		playlistUI := NewResultsUI("playlist", context.Background(), mockClient, true)
+		stop := startWithSimulationScreen(playlistUI, func() {
+			playlistUI.DisplayPlaylistResults(context.Background(), mockClient, playlists)
+		})
+		defer stop()
+		assert.Equal(t, "Test Playlist", playlistUI.table.GetCell(1, 1).Text)
+
+		// Opening a playlist row with details enabled loads the playlist
+		onEventLoop(t, playlistUI, func() { playlistUI.displayDetails(1) })
+		waitForTrackList(t, playlistUI)
+		assert.True(t, mockClient.GetPlaylistCalled)
+	})
+}
+
+// TestDisplayDetailsRateLimited tests that a rate limited request while a
+// result opens leaves the UI responsive, and the result opens once retried
+func TestDisplayDetailsRateLimited(t *testing.T) {
+	server := fakespotify.NewServer()
+	defer server.Close()
+
+	album := spotify.SimpleAlbum{ID: "album1", Name: "A Night at the Opera"}
+	server.AddAlbum(album, spotify.FullTrack{SimpleTrack: spotify.SimpleTrack{ID: "track1", Name: "Bohemian Rhapsody", Duration: 354000}})
+	server.FailNextWithHeader(http.MethodGet, "/v1/albums/album1/tracks", http.StatusTooManyRequests, "API rate limit exceeded", http.Header{"Retry-After": {"0"}})
+
+	httpClient := &http.Client{Transport: retry.New(server.Server.Client().Transport)}
+	client := spotify.New(httpClient, spotify.WithBaseURL(server.APIURL()))
+
+	ui := NewResultsUI("album", context.Background(), client, false)
+	stop := startWithSimulationScreen(ui, func() {
+		ui.DisplayAlbumResults(context.Background(), client, []spotify.SimpleAlbum{album})
+	})
+	defer stop()
+
+	onEventLoop(t, ui, func() { ui.displayDetails(1) })
+	waitForTrackList(t, ui)
+
+	var albumRequests int
+	for _, request := range server.Requests() {
+		if request == "GET /v1/albums/album1/tracks" {
+			albumRequests++
+		}
+	}
+	assert.Equal(t, 2, albumRequests)
+}
+
+// offlineClient is a mock client that answers from the cache
+type offlineClient struct {
+	*testutils.MockSpotifyClient
+}
+
+func (offlineClient) Offline() bool {
+	return true
+}
+
+// TestResultsUIOffline tests that cached results are badged and cannot be played
+func TestResultsUIOffline(t *testing.T) {
+	mockClient := &testutils.MockSpotifyClient{}
+
+	online := NewResultsUI("track", context.Background(), mockClient, false)
+	assert.Equal(t, []string{"Play", "Open in Spotify", "Close"}, online.playButtons("Open in Spotify", "Close"))
+
+	ui := NewResultsUI("track", context.Background(), offlineClient{mockClient}, false)
+	assert.True(t, ui.offline)
+	assert.Equal(t, []string{"Open in Spotify", "Close"}, ui.playButtons("Open in Spotify", "Close"))
+
+	runWithSimulationScreen(ui, func() {
+		ui.DisplayTrackResults(context.Background(), ui.client, []spotify.FullTrack{{SimpleTrack: spotify.SimpleTrack{ID: "cached", Name: "Cached Track"}}})
 	})
+	assert.Equal(t, "Cached Track", ui.table.GetCell(1, 1).Text)
+}
+
+// uncachedAlbumClient is an offline client that has not cached album tracks
+type uncachedAlbumClient struct {
+	offlineClient
+}
+
+func (uncachedAlbumClient) GetAlbumTracks(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) (*spotify.SimpleTrackPage, error) {
+	return nil, fmt.Errorf("%w: album %s is not cached", api.ErrOffline, id)
+}
+
+// TestDisplayDetailsUncached tests that an album whose tracks cannot be
+// loaded still shows its details, so it can be opened in Spotify
+func TestDisplayDetailsUncached(t *testing.T) {
+	client := uncachedAlbumClient{offlineClient{&testutils.MockSpotifyClient{}}}
+	ui := NewResultsUI("album", context.Background(), client, false)
+	stop := startWithSimulationScreen(ui, func() {
+		ui.DisplayAlbumResults(context.Background(), client, []spotify.SimpleAlbum{{ID: "album1", Name: "A Night at the Opera"}})
+	})
+	defer stop()
+
+	onEventLoop(t, ui, func() { ui.displayDetails(1) })
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		var button *tview.Button
+		onEventLoop(t, ui, func() {
+			button, _ = ui.app.GetFocus().(*tview.Button)
+		})
+		// The loading modal has no buttons, and offline results cannot be played
+		if button != nil {
+			assert.Equal(t, "Open in Spotify", button.GetLabel())
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the album details were not shown")
+		}
+	}
 }
 
 // TestResultsUIWithMockContext tests the ResultsUI with a mock context
@@ -130,7 +271,7 @@ func TestResultsUIWithMockContext(t *testing.T) {
 	defer cancel()
 
 	mockClient := &testutils.MockSpotifyClient{}
-	_ = NewMockResultsUI("track", ctx, mockClient, false)
+	_ = NewResultsUI("track", ctx, mockClient, false)
 
 	// Test context cancellation
 	cancel()